@@ -3,6 +3,7 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/ipfs/testground/pkg/api"
@@ -22,6 +23,12 @@ var Commands = []cli.Command{
 	DaemonCommand,
 	CollectCommand,
 	TerminateCommand,
+	StatusCommand,
+	LogsCommand,
+	CancelCommand,
+	QueueCommand,
+	PlanCommand,
+	CompositionCommand,
 }
 
 var Flags = []cli.Flag{
@@ -42,18 +49,95 @@ var Flags = []cli.Flag{
 func setupClient(c *cli.Context) (*client.Client, error) {
 	endpoint := c.GlobalString("endpoint")
 
-	if endpoint == "" {
-		envcfg, err := config.GetEnvConfig()
-		if err != nil {
+	envcfg, err := config.GetEnvConfig()
+	if err != nil {
+		// the env config is only required if we need the endpoint from it.
+		if endpoint == "" {
 			return nil, err
 		}
+		envcfg = &config.EnvConfig{}
+	}
+
+	if endpoint == "" {
 		endpoint = envcfg.Client.Endpoint
 	}
 
-	api := client.New(endpoint)
+	api := client.New(endpoint, envcfg.Client.Token)
 	return api, nil
 }
 
+// parseDependency parses the value of a --dep flag for the given module. The
+// value is one of:
+//
+//  * a version, e.g. v0.4.22.
+//  * another module at a version, e.g. github.com/me/go-libp2p@v0.5.1-fork.
+//  * a git repository in go-getter syntax, e.g.
+//    git::https://github.com/me/go-libp2p?ref=my-branch.
+//  * a local directory, starting with /, ./ or ../.
+func parseDependency(module, val string) (api.Dependency, error) {
+	dep := api.Dependency{Module: module}
+
+	switch {
+	case strings.HasPrefix(val, "git::"):
+		dep.Git = val
+	case strings.HasPrefix(val, "/") || strings.HasPrefix(val, "./") || strings.HasPrefix(val, "../"):
+		path, err := filepath.Abs(val)
+		if err != nil {
+			return dep, fmt.Errorf("invalid path for dependency %s: %w", module, err)
+		}
+		dep.Path = path
+	case strings.Contains(val, "@"):
+		i := strings.LastIndex(val, "@")
+		dep.Target, dep.Version = val[:i], val[i+1:]
+	default:
+		dep.Version = val
+	}
+	return dep, nil
+}
+
+// loadComposition loads the composition file, resolving its templating and
+// base compositions with the variables given by --set flags.
+//
+// Templated compositions can't be written back, as that would discard their
+// templating, so --write-artifacts is rejected for them.
+func loadComposition(c *cli.Context, file string) (*api.Composition, error) {
+	vars, err := conv.ParseKeyValues(c.StringSlice("set"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse composition variables: %w", err)
+	}
+
+	comp, templated, err := api.LoadComposition(file, vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process composition file: %w", err)
+	}
+
+	if templated && c.Bool("write-artifacts") {
+		return nil, fmt.Errorf("cannot write artifacts to a templated composition; render it with `testground composition render` first")
+	}
+
+	resolveDependencyPaths(comp, file)
+	return comp, nil
+}
+
+// resolveDependencyPaths makes the local directories of dependency overrides
+// in a composition file absolute, resolving them relative to the directory of
+// the file.
+func resolveDependencyPaths(comp *api.Composition, file string) {
+	dir := filepath.Dir(file)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	for i := range comp.Groups {
+		deps := comp.Groups[i].Build.Dependencies
+		for j := range deps {
+			if p := deps[j].Path; p != "" && !filepath.IsAbs(p) {
+				deps[j].Path = filepath.Join(dir, p)
+			}
+		}
+	}
+}
+
 func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 	var (
 		testcase = c.Args().First()
@@ -130,10 +214,10 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 	}
 	comp.Groups[0].Build.Dependencies = make([]api.Dependency, 0, len(dependencies))
 
-	for name, ver := range deps {
-		dep := api.Dependency{
-			Module:  name,
-			Version: ver,
+	for name, val := range deps {
+		dep, err := parseDependency(name, val)
+		if err != nil {
+			return nil, err
 		}
 		comp.Groups[0].Build.Dependencies = append(comp.Groups[0].Build.Dependencies, dep)
 	}
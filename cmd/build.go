@@ -31,6 +31,10 @@ var BuildCommand = cli.Command{
 					Name:  "write-artifacts, w",
 					Usage: "Writes the resulting build artifacts to the composition file.",
 				},
+				cli.StringSliceFlag{
+					Name:  "set",
+					Usage: "set a composition variable; format: key=value",
+				},
 			},
 		},
 		cli.Command{
@@ -42,11 +46,11 @@ var BuildCommand = cli.Command{
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "builder, b",
-					Usage: "specifies the builder to use; values include: 'docker:go', 'exec:go'",
+					Usage: "specifies the builder to use; values include: 'docker:go', 'exec:go', 'docker:generic'",
 				},
 				cli.StringSliceFlag{
 					Name:  "dep, d",
-					Usage: "set a dependency mapping",
+					Usage: "override a dependency; values: 'module=version', 'module=fork@version', 'module=git::url?ref=ref' or 'module=./local/dir'",
 				},
 				cli.StringSliceFlag{
 					Name:  "build-cfg",
@@ -58,14 +62,14 @@ var BuildCommand = cli.Command{
 }
 
 func buildCompositionCmd(c *cli.Context) (err error) {
-	comp := new(api.Composition)
 	file := c.String("file")
 	if file == "" {
 		return fmt.Errorf("no composition file supplied")
 	}
 
-	if _, err = toml.DecodeFile(file, comp); err != nil {
-		return fmt.Errorf("failed to process composition file: %w", err)
+	comp, err := loadComposition(c, file)
+	if err != nil {
+		return err
 	}
 	if err = comp.ValidateForBuild(); err != nil {
 		return fmt.Errorf("invalid composition file: %w", err)
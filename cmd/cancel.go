@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/urfave/cli"
+)
+
+// CancelCommand is the specification of the `cancel` command.
+var CancelCommand = cli.Command{
+	Name:      "cancel",
+	Usage:     "cancels a run submitted to the daemon",
+	Action:    cancelCommand,
+	ArgsUsage: "[run_id]",
+}
+
+func cancelCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 1 {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("missing run id")
+	}
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := api.Cancel(ctx, c.Args().First())
+	if err != nil {
+		return fmt.Errorf("fatal error from daemon: %s", err)
+	}
+	defer resp.Close()
+
+	st, err := client.ParseStatusResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	printRunStatus(st)
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli"
+)
+
+// CompositionCommand is the specification of the `composition` command.
+var CompositionCommand = cli.Command{
+	Name:  "composition",
+	Usage: "manage compositions",
+	Subcommands: cli.Commands{
+		cli.Command{
+			Name:   "render",
+			Usage:  "renders a composition, resolving its templating and base compositions, and prints the resulting TOML",
+			Action: compositionRenderCommand,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "path to a composition `FILE`",
+				},
+				cli.StringSliceFlag{
+					Name:  "set",
+					Usage: "set a composition variable; format: key=value",
+				},
+				cli.BoolFlag{
+					Name:  "validate",
+					Usage: "validate the rendered composition for a run",
+				},
+			},
+		},
+	},
+}
+
+func compositionRenderCommand(c *cli.Context) error {
+	file := c.String("file")
+	if file == "" {
+		return fmt.Errorf("no composition file supplied")
+	}
+
+	comp, err := loadComposition(c, file)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("validate") {
+		if err := comp.ValidateForRun(); err != nil {
+			return fmt.Errorf("invalid composition file: %w", err)
+		}
+	}
+
+	return toml.NewEncoder(os.Stdout).Encode(comp)
+}
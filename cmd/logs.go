@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/urfave/cli"
+)
+
+// LogsCommand is the specification of the `logs` command.
+var LogsCommand = cli.Command{
+	Name:      "logs",
+	Usage:     "prints the output of a run submitted to the daemon",
+	Action:    logsCommand,
+	ArgsUsage: "[run_id]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "follow, f",
+			Usage: "keep printing output until the run finishes",
+		},
+	},
+}
+
+func logsCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 1 {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("missing run id")
+	}
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := api.Logs(ctx, c.Args().First(), c.Bool("follow"))
+	if err != nil {
+		return fmt.Errorf("fatal error from daemon: %s", err)
+	}
+	defer resp.Close()
+
+	st, err := client.ParseLogsResponse(resp, nil)
+	switch err {
+	case nil:
+	case context.Canceled:
+		return fmt.Errorf("interrupted")
+	default:
+		return err
+	}
+
+	logging.S().Infow("run status", "run_id", st.RunID, "state", st.State)
+	if st.State == client.RunStateFailed {
+		return fmt.Errorf("run failed: %s", st.Error)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/config"
+	"github.com/ipfs/testground/pkg/engine"
+	"github.com/urfave/cli"
+)
+
+// PlanCommand is the specification of the `plan` command.
+var PlanCommand = cli.Command{
+	Name:  "plan",
+	Usage: "manage test plans",
+	Subcommands: cli.Commands{
+		cli.Command{
+			Name:      "import",
+			Usage:     "imports a test plan from a git repository, an archive or a directory whose root contains a manifest.toml",
+			Action:    planImportCommand,
+			ArgsUsage: "[url]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "ref",
+					Usage: "git branch, tag or commit to import; only valid for git sources",
+				},
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "name to enroll the test plan under (default: the name in the manifest)",
+				},
+			},
+		},
+		cli.Command{
+			Name:      "lint",
+			Usage:     "validates test plan manifests; by default, all manifests known to testground",
+			Action:    planLintCommand,
+			ArgsUsage: "[manifest...]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "strict",
+					Usage: "fail on warnings too",
+				},
+			},
+		},
+	},
+}
+
+func planImportCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 1 {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("missing test plan url")
+	}
+
+	src := c.Args().First()
+
+	// local directories are fetched by the daemon, so make them absolute.
+	if strings.HasPrefix(src, "./") || strings.HasPrefix(src, "../") {
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		src = abs
+	}
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	req := &client.PlanImportRequest{
+		URL:  src,
+		Ref:  c.String("ref"),
+		Name: c.String("name"),
+	}
+
+	resp, err := api.ImportPlan(ctx, req)
+	if err != nil {
+		return fmt.Errorf("fatal error from daemon: %s", err)
+	}
+	defer resp.Close()
+
+	res, err := client.ParseImportPlanResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("name:       %s\n", res.Name)
+	fmt.Printf("url:        %s\n", res.URL)
+	if res.Ref != "" {
+		fmt.Printf("ref:        %s\n", res.Ref)
+	}
+	if res.Revision != "" {
+		fmt.Printf("revision:   %s\n", res.Revision)
+	}
+	fmt.Printf("source:     %s\n", res.SourcePath)
+	fmt.Printf("test cases: %s\n", strings.Join(res.TestCases, ", "))
+	return nil
+}
+
+func planLintCommand(c *cli.Context) error {
+	manifests := c.Args()
+	if len(manifests) == 0 {
+		envcfg, err := config.GetEnvConfig()
+		if err != nil {
+			return err
+		}
+		if manifests, err = engine.ManifestPaths(envcfg); err != nil {
+			return err
+		}
+	}
+
+	var errs, warns int
+	for _, m := range manifests {
+		_, problems := engine.LintManifest(m)
+		if len(problems) == 0 {
+			fmt.Printf("%s: ok\n", m)
+			continue
+		}
+		for _, p := range problems {
+			if p.Warning {
+				warns++
+				fmt.Printf("%s: warning: %s\n", m, p)
+			} else {
+				errs++
+				fmt.Printf("%s: error: %s\n", m, p)
+			}
+		}
+	}
+
+	if errs > 0 || (warns > 0 && c.Bool("strict")) {
+		return fmt.Errorf("linted %d manifests: %d errors, %d warnings", len(manifests), errs, warns)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/urfave/cli"
+)
+
+// QueueCommand is the specification of the `queue` command.
+var QueueCommand = cli.Command{
+	Name:   "queue",
+	Usage:  "inspects and reorders the run queue of the daemon",
+	Action: queueListCommand,
+	Subcommands: cli.Commands{
+		cli.Command{
+			Name:   "list",
+			Usage:  "lists the running and queued runs, in admission order",
+			Action: queueListCommand,
+		},
+		cli.Command{
+			Name:      "priority",
+			Usage:     "changes the priority of a queued run; higher runs first",
+			Action:    queuePriorityCommand,
+			ArgsUsage: "[run_id] [priority]",
+		},
+	},
+}
+
+func queueListCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := api.Queue(ctx)
+	if err != nil {
+		return fmt.Errorf("fatal error from daemon: %s", err)
+	}
+	defer resp.Close()
+
+	runs, err := client.ParseQueueResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 1, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POSITION\tRUN ID\tSTATE\tPRIORITY\tUSER\tRUNNER\tINSTANCES\tTEST CASE")
+	for _, r := range runs {
+		pos := "-"
+		if r.Position > 0 {
+			pos = strconv.Itoa(r.Position)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%d\t%s/%s\n", pos, r.RunID, r.State, r.Priority, r.User, r.Runner, r.Instances, r.Plan, r.Case)
+	}
+	return tw.Flush()
+}
+
+func queuePriorityCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 2 {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("expected a run id and a priority")
+	}
+
+	priority, err := strconv.Atoi(c.Args().Get(1))
+	if err != nil {
+		return fmt.Errorf("invalid priority: %w", err)
+	}
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := api.SetPriority(ctx, c.Args().First(), &client.PriorityRequest{Priority: priority})
+	if err != nil {
+		return fmt.Errorf("fatal error from daemon: %s", err)
+	}
+	defer resp.Close()
+
+	st, err := client.ParseStatusResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	printRunStatus(st)
+	return nil
+}
@@ -34,6 +34,10 @@ var RunCommand = cli.Command{
 					Name:  "write-artifacts, w",
 					Usage: "Writes the resulting build artifacts to the composition file.",
 				},
+				cli.StringSliceFlag{
+					Name:  "set",
+					Usage: "set a composition variable; format: key=value",
+				},
 				cli.BoolFlag{
 					Name:  "ignore-artifacts, i",
 					Usage: "Ignores any build artifacts present in the composition file.",
@@ -46,6 +50,14 @@ var RunCommand = cli.Command{
 					Name:  "collect-file, o",
 					Usage: "Destination for the assets if --collect is set",
 				},
+				cli.IntFlag{
+					Name:  "priority",
+					Usage: "Priority of the run in the daemon queue; higher runs first.",
+				},
+				cli.BoolFlag{
+					Name:  "detach",
+					Usage: "Return as soon as the run has been submitted; follow it with the `status` and `logs` commands.",
+				},
 			},
 		},
 		cli.Command{
@@ -76,20 +88,28 @@ var RunCommand = cli.Command{
 					Name:  "test-param, p",
 					Usage: "provide a test parameter",
 				},
+				cli.IntFlag{
+					Name:  "priority",
+					Usage: "priority of the run in the daemon queue; higher runs first",
+				},
+				cli.BoolFlag{
+					Name:  "detach",
+					Usage: "return as soon as the run has been submitted; follow it with the `status` and `logs` commands",
+				},
 			),
 		},
 	},
 }
 
 func runCompositionCmd(c *cli.Context) (err error) {
-	comp := new(api.Composition)
 	file := c.String("file")
 	if file == "" {
 		return fmt.Errorf("no composition file supplied")
 	}
 
-	if _, err = toml.DecodeFile(file, comp); err != nil {
-		return fmt.Errorf("failed to process composition file: %w", err)
+	comp, err := loadComposition(c, file)
+	if err != nil {
+		return err
 	}
 
 	if err = comp.ValidateForRun(); err != nil {
@@ -113,6 +133,11 @@ func runSingleCmd(c *cli.Context) (err error) {
 }
 
 func doRun(c *cli.Context, comp *api.Composition) (err error) {
+	detach := c.Bool("detach")
+	if detach && c.Bool("collect") {
+		return fmt.Errorf("--collect cannot be used with --detach; use the `collect` command once the run has finished")
+	}
+
 	cl, err := setupClient(c)
 	if err != nil {
 		return err
@@ -162,6 +187,8 @@ func doRun(c *cli.Context, comp *api.Composition) (err error) {
 
 	req := &client.RunRequest{
 		Composition: *comp,
+		Detach:      detach,
+		Priority:    c.Int("priority"),
 	}
 
 	resp, err := cl.Run(ctx, req)
@@ -181,7 +208,14 @@ func doRun(c *cli.Context, comp *api.Composition) (err error) {
 		return err
 	}
 
+	if detach {
+		logging.S().Infof("submitted run with ID: %s", rout.RunID)
+		fmt.Println(rout.RunID)
+		return nil
+	}
+
 	logging.S().Infof("finished run with ID: %s", rout.RunID)
+	printGroupSummaries(rout.Groups)
 
 	// if the `collect` flag is not set, we are done, just return
 	collect := c.Bool("collect")
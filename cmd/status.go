@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/urfave/cli"
+)
+
+// StatusCommand is the specification of the `status` command.
+var StatusCommand = cli.Command{
+	Name:      "status",
+	Usage:     "shows the status of a run submitted to the daemon",
+	Action:    statusCommand,
+	ArgsUsage: "[run_id]",
+}
+
+func statusCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.NArg() != 1 {
+		_ = cli.ShowSubcommandHelp(c)
+		return errors.New("missing run id")
+	}
+
+	api, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := api.Status(ctx, c.Args().First())
+	if err != nil {
+		return fmt.Errorf("fatal error from daemon: %s", err)
+	}
+	defer resp.Close()
+
+	st, err := client.ParseStatusResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	printRunStatus(st)
+	return nil
+}
+
+func printRunStatus(st client.RunStatus) {
+	ts := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 1, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "run id:\t %s\n", st.RunID)
+	fmt.Fprintf(tw, "test case:\t %s/%s\n", st.Plan, st.Case)
+	fmt.Fprintf(tw, "runner:\t %s\n", st.Runner)
+	fmt.Fprintf(tw, "user:\t %s\n", st.User)
+	fmt.Fprintf(tw, "instances:\t %d\n", st.Instances)
+	fmt.Fprintf(tw, "state:\t %s\n", st.State)
+	fmt.Fprintf(tw, "priority:\t %d\n", st.Priority)
+	if st.Position > 0 {
+		fmt.Fprintf(tw, "queue position:\t %d\n", st.Position)
+	}
+	fmt.Fprintf(tw, "created:\t %s\n", ts(st.Created))
+	fmt.Fprintf(tw, "started:\t %s\n", ts(st.Started))
+	fmt.Fprintf(tw, "ended:\t %s\n", ts(st.Ended))
+	if st.Error != "" {
+		fmt.Fprintf(tw, "error:\t %s\n", st.Error)
+	}
+	for _, r := range st.Removed {
+		fmt.Fprintf(tw, "removed:\t %s\n", r)
+	}
+	tw.Flush()
+
+	printGroupSummaries(st.Groups)
+}
+
+// printGroupSummaries prints how each group of a run was run.
+func printGroupSummaries(groups []api.GroupSummary) {
+	if len(groups) == 0 {
+		return
+	}
+
+	// only show the nodes column if the runner placed instances on nodes.
+	var placed bool
+	for _, g := range groups {
+		placed = placed || len(g.Nodes) > 0
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 1, 0, 1, ' ', 0)
+	if placed {
+		fmt.Fprintf(tw, "GROUP	 INSTANCES	 RESOURCES	 NODES\n")
+	} else {
+		fmt.Fprintf(tw, "GROUP	 INSTANCES	 RESOURCES\n")
+	}
+	for _, g := range groups {
+		keys := make([]string, 0, len(g.Resources))
+		for k := range g.Resources {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		res := make([]string, 0, len(keys))
+		for _, k := range keys {
+			res = append(res, k+"="+g.Resources[k])
+		}
+		if len(res) == 0 {
+			res = append(res, "unlimited")
+		}
+		if !placed {
+			fmt.Fprintf(tw, "%s\t %d\t %s\n", g.ID, g.Instances, strings.Join(res, ", "))
+			continue
+		}
+
+		nodes := make([]string, 0, len(g.Nodes))
+		for n, count := range g.Nodes {
+			nodes = append(nodes, fmt.Sprintf("%s=%d", n, count))
+		}
+		sort.Strings(nodes)
+		fmt.Fprintf(tw, "%s\t %d\t %s\t %s\n", g.ID, g.Instances, strings.Join(res, ", "), strings.Join(nodes, ", "))
+	}
+	tw.Flush()
+}
@@ -33,11 +33,11 @@ type BuildInput struct {
 	Directories Directories
 	// TestPlan is the metadata of the test plan being built.
 	TestPlan *TestPlanDefinition
-	// Dependencies are the versions of upstream dependencies we want to build
+	// Dependencies are the overrides of upstream dependencies we want to build
 	// against. For a go build, this could be e.g.:
 	//  github.com/ipfs/go-ipfs=v0.4.22
-	//  github.com/libp2p/go-libp2p=v0.2.8
-	Dependencies map[string]string
+	//  github.com/libp2p/go-libp2p=github.com/me/go-libp2p@v0.2.9-fork
+	Dependencies Dependencies
 	// BuildConfig is the configuration of the build job sourced from the test
 	// plan manifest, coalesced with any user-provided overrides.
 	BuildConfig interface{}
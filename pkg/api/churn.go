@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// EnvChurn is the environment variable through which runners pass the churn
+// of a group, JSON-encoded, to the sidecar that enforces it.
+const EnvChurn = "TESTGROUND_CHURN"
+
+// Churn periodically restarts, kills or pauses a fraction of the instances of
+// a group, to test how the rest of the run copes with peers coming and going.
+//
+// Time is divided in ticks of Interval, aligned on the wall clock. At every
+// tick, Fraction of the instances of the group are picked at random and the
+// Action is performed on them. The instances are picked deterministically from
+// the run ID, the group ID and the tick, so that every process enforcing the
+// churn of a group agrees on them without coordinating.
+type Churn struct {
+	// Action is the action to perform: restart, kill or pause.
+	Action string `toml:"action" json:"action"`
+
+	// Fraction is the fraction of the instances of the group to act on at
+	// every tick, between 0 and 1. At least one instance is picked.
+	Fraction float64 `toml:"fraction" json:"fraction"`
+
+	// Interval is the duration of a tick, e.g. "30s".
+	Interval string `toml:"interval" json:"interval"`
+
+	// Downtime is how long paused instances stay paused (default: half of
+	// Interval). It only applies to the pause action.
+	Downtime string `toml:"downtime" json:"downtime,omitempty"`
+}
+
+// Validate validates the churn settings.
+func (c *Churn) Validate() error {
+	switch c.Action {
+	case "restart", "kill", "pause":
+	default:
+		return fmt.Errorf("unknown churn action %q; supported: restart, kill, pause", c.Action)
+	}
+
+	if c.Fraction <= 0 || c.Fraction > 1 {
+		return fmt.Errorf("churn fraction must be in (0, 1]; got %v", c.Fraction)
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid churn interval %q: %w", c.Interval, err)
+	}
+	if interval < time.Second {
+		return fmt.Errorf("churn interval must be at least 1s; got %s", interval)
+	}
+
+	if c.Downtime != "" {
+		if c.Action != "pause" {
+			return fmt.Errorf("churn downtime only applies to the pause action")
+		}
+		downtime, err := time.ParseDuration(c.Downtime)
+		if err != nil {
+			return fmt.Errorf("invalid churn downtime %q: %w", c.Downtime, err)
+		}
+		if downtime <= 0 || downtime >= interval {
+			return fmt.Errorf("churn downtime must be positive and shorter than the interval; got %s", downtime)
+		}
+	}
+
+	return nil
+}
+
+// IntervalDuration returns the duration of a tick. Validate MUST have been
+// called.
+func (c *Churn) IntervalDuration() time.Duration {
+	d, _ := time.ParseDuration(c.Interval)
+	return d
+}
+
+// DowntimeDuration returns how long paused instances stay paused. Validate
+// MUST have been called.
+func (c *Churn) DowntimeDuration() time.Duration {
+	if d, err := time.ParseDuration(c.Downtime); err == nil {
+		return d
+	}
+	return c.IntervalDuration() / 2
+}
+
+// Tick returns the tick t falls in, and when the next tick starts.
+func (c *Churn) Tick(t time.Time) (tick int64, next time.Time) {
+	interval := int64(c.IntervalDuration())
+	tick = t.UnixNano() / interval
+	return tick, time.Unix(0, (tick+1)*interval)
+}
+
+// Selected returns the indices of the instances of the group to act on at the
+// given tick, in ascending order.
+func (c *Churn) Selected(runID, groupID string, tick int64, instances int) []int {
+	if instances <= 0 {
+		return nil
+	}
+
+	n := int(math.Round(c.Fraction * float64(instances)))
+	if n < 1 {
+		n = 1
+	}
+	if n > instances {
+		n = instances
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(runID + "/" + groupID + "/" + strconv.FormatInt(tick, 10)))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	selected := rng.Perm(instances)[:n]
+	sort.Ints(selected)
+	return selected
+}
+
+// IsSelected returns whether the instance with the given index is acted on at
+// the given tick.
+func (c *Churn) IsSelected(runID, groupID string, tick int64, instances, index int) bool {
+	for _, i := range c.Selected(runID, groupID, tick, instances) {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
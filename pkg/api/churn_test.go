@@ -0,0 +1,72 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChurnValidate(t *testing.T) {
+	cases := []struct {
+		churn    Churn
+		hasError bool
+	}{
+		{Churn{Action: "restart", Fraction: 0.1, Interval: "30s"}, false},
+		{Churn{Action: "pause", Fraction: 1, Interval: "1m", Downtime: "10s"}, false},
+		{Churn{Action: "reboot", Fraction: 0.1, Interval: "30s"}, true},
+		{Churn{Action: "kill", Fraction: 0, Interval: "30s"}, true},
+		{Churn{Action: "kill", Fraction: 1.5, Interval: "30s"}, true},
+		{Churn{Action: "kill", Fraction: 0.5, Interval: "often"}, true},
+		{Churn{Action: "kill", Fraction: 0.5, Interval: "100ms"}, true},
+		{Churn{Action: "kill", Fraction: 0.5, Interval: "30s", Downtime: "10s"}, true},
+		{Churn{Action: "pause", Fraction: 0.5, Interval: "30s", Downtime: "1m"}, true},
+	}
+
+	for _, c := range cases {
+		if err := c.churn.Validate(); (err != nil) != c.hasError {
+			t.Errorf("Validate(%+v): got error %v, expected error: %t", c.churn, err, c.hasError)
+		}
+	}
+}
+
+func TestChurnSelected(t *testing.T) {
+	c := &Churn{Action: "restart", Fraction: 0.25, Interval: "10s"}
+
+	a := c.Selected("run", "peers", 42, 10)
+	if len(a) != 3 {
+		t.Fatalf("expected 3 selected instances; got %v", a)
+	}
+	for i, idx := range a {
+		if idx < 0 || idx >= 10 || (i > 0 && a[i-1] >= idx) {
+			t.Fatalf("unexpected selection: %v", a)
+		}
+		if !c.IsSelected("run", "peers", 42, 10, idx) {
+			t.Errorf("expected instance %d to be selected", idx)
+		}
+	}
+
+	// the selection is deterministic.
+	if b := c.Selected("run", "peers", 42, 10); !reflect.DeepEqual(a, b) {
+		t.Errorf("expected the same selection; got %v and %v", a, b)
+	}
+
+	// at least one instance is picked.
+	if s := c.Selected("run", "peers", 42, 1); !reflect.DeepEqual(s, []int{0}) {
+		t.Errorf("expected instance 0 to be selected; got %v", s)
+	}
+	if s := c.Selected("run", "peers", 42, 0); s != nil {
+		t.Errorf("expected no selection from an empty group; got %v", s)
+	}
+}
+
+func TestChurnTick(t *testing.T) {
+	c := &Churn{Action: "pause", Fraction: 0.1, Interval: "10s"}
+
+	tick, next := c.Tick(time.Unix(125, 0))
+	if tick != 12 || !next.Equal(time.Unix(130, 0)) {
+		t.Errorf("unexpected tick %d, next %s", tick, next)
+	}
+	if d := c.DowntimeDuration(); d != 5*time.Second {
+		t.Errorf("expected default downtime of 5s; got %s", d)
+	}
+}
@@ -36,3 +36,21 @@ func EnumerateOverridableFields(typ reflect.Type) (out []string) {
 	}
 	return out
 }
+
+// EnumerateGroupScopedFields returns the fields from a runner configuration
+// type that can be set per group, i.e. they bear the `group:"yes"` tag, and
+// they have an explicitly defined toml key.
+func EnumerateGroupScopedFields(typ reflect.Type) (out []string) {
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if v, ok := f.Tag.Lookup("group"); ok && v == "yes" {
+			if t, ok := f.Tag.Lookup("toml"); ok {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
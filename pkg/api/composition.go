@@ -3,6 +3,8 @@ package api
 import (
 	"fmt"
 	"math"
+	"path/filepath"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -10,6 +12,7 @@ import (
 var compositionValidator = func() *validator.Validate {
 	v := validator.New()
 	v.RegisterStructValidation(ValidateInstances, &Instances{})
+	v.RegisterStructValidation(ValidateDependency, &Dependency{})
 	return v
 }()
 
@@ -29,6 +32,10 @@ type Global struct {
 	// Plan is the test plan we want to run.
 	Plan string `toml:"plan" json:"plan" validate:"required"`
 
+	// PlanRevision pins the git revision of the source of an imported test
+	// plan to build (default: the revision that was imported).
+	PlanRevision string `toml:"plan_revision" json:"plan_revision,omitempty"`
+
 	// Case is the test case we want to run.
 	Case string `toml:"case" json:"case" validate:"required"`
 
@@ -36,10 +43,11 @@ type Global struct {
 	// this composition; it is the sum of all instances in all groups.
 	TotalInstances uint `toml:"total_instances" json:"total_instances" validate:"required,gte=0"`
 
-	// Builder is the builder we're using.
-	Builder string `toml:"builder" json:"builder" validate:"required"`
+	// Builder is the builder we're using. Groups can override it.
+	Builder string `toml:"builder" json:"builder"`
 
-	// BuildConfig specifies the build configuration for this run.
+	// BuildConfig specifies the build configuration for this run. It only
+	// applies to groups built with the global builder.
 	BuildConfig map[string]interface{} `toml:"build_config" json:"build_config"`
 
 	// Runner is the runner we're using.
@@ -75,6 +83,15 @@ type Group struct {
 	calculatedInstanceCnt uint
 }
 
+// BuilderID returns the builder this group is built with: its own, or the
+// global builder if it doesn't specify one.
+func (g Group) BuilderID(global Global) string {
+	if g.Build.Builder != "" {
+		return g.Build.Builder
+	}
+	return global.Builder
+}
+
 // CalculatedInstanceCount returns the actual number of instances in this group.
 //
 // Validate MUST be called for this field to be available.
@@ -98,19 +115,21 @@ type Instances struct {
 type Dependencies []Dependency
 
 type Build struct {
+	// Builder is the builder to use for this group, overriding the global
+	// builder. This enables compositions mixing implementations built
+	// differently, e.g. with docker:go and docker:generic.
+	Builder string `toml:"builder" json:"builder,omitempty"`
+
+	// BuildConfig specifies the build configuration for this group. It's
+	// applied on top of the global build configuration, if this group uses the
+	// global builder.
+	BuildConfig map[string]interface{} `toml:"build_config" json:"build_config,omitempty"`
+
 	// Dependencies specifies any upstream dependency overrides to apply to this
 	// build.
 	Dependencies Dependencies `toml:"dependencies" json:"dependencies"`
 }
 
-func (d Dependencies) AsMap() map[string]string {
-	m := make(map[string]string, len(d))
-	for _, dep := range d {
-		m[dep.Module] = dep.Version
-	}
-	return m
-}
-
 type Run struct {
 	// Artifact specifies the build artifact to use for this run.
 	Artifact string `toml:"artifact" json:"artifact"`
@@ -118,23 +137,85 @@ type Run struct {
 	// TestParams specify the test parameters to pass down to instances of this
 	// group.
 	TestParams map[string]string `toml:"test_params" json:"test_params"`
+
+	// RunConfig specifies the run configuration for this group. It's applied
+	// on top of the global run configuration, and can only set the keys the
+	// runner declares as group-scoped (see EnumerateGroupScopedFields).
+	RunConfig map[string]interface{} `toml:"run_config" json:"run_config,omitempty"`
+
+	// Churn periodically restarts, kills or pauses a fraction of the
+	// instances of this group. Only some runners support it.
+	Churn *Churn `toml:"churn" json:"churn,omitempty"`
 }
 
+// Dependency overrides an upstream dependency of the test plan. By default, it
+// pins Module to Version. It can also replace Module with a different target,
+// which is one of:
+//
+//  * another module, e.g. a fork, at Version (Target).
+//  * a git repository, checked out at Ref (Git).
+//  * a local directory, which is copied into the build (Path).
 type Dependency struct {
 	// Module is the module name/path for the import to be overridden.
 	Module string `toml:"module" json:"module" validate:"required"`
 
-	// Version is the override version.
-	Version string `toml:"version" json:"version" validate:"required"`
+	// Version is the override version. If Target is set, it's the version of
+	// the target module.
+	Version string `toml:"version" json:"version"`
+
+	// Target is the module path that replaces Module, e.g. a fork.
+	Target string `toml:"target" json:"target,omitempty"`
+
+	// Git is the URL of a git repository whose source replaces Module.
+	Git string `toml:"git" json:"git,omitempty"`
+
+	// Ref is the branch, tag or commit of the Git repository to check out
+	// (default: the default branch).
+	Ref string `toml:"ref" json:"ref,omitempty"`
+
+	// Path is a local directory whose source replaces Module. It must be an
+	// absolute path, as it's resolved by the daemon.
+	Path string `toml:"path" json:"path,omitempty"`
 }
 
 // ValidateForBuild validates that this Composition is correct for a build.
 func (c *Composition) ValidateForBuild() error {
-	return compositionValidator.StructExcept(c,
+	err := compositionValidator.StructExcept(c,
 		"Global.Case",
 		"Global.TotalInstances",
 		"Global.Runner",
 	)
+	if err != nil {
+		return err
+	}
+
+	if err := c.validateDependencies(); err != nil {
+		return err
+	}
+	return c.validateBuilders()
+}
+
+// validateDependencies validates the dependency overrides of every group.
+// Groups are not traversed by the structural validation, so they're validated
+// explicitly.
+func (c *Composition) validateDependencies() error {
+	for _, g := range c.Groups {
+		if err := compositionValidator.Var(g.Build.Dependencies, "dive"); err != nil {
+			return fmt.Errorf("invalid dependency overrides in group %s: %w", g.ID, err)
+		}
+	}
+	return nil
+}
+
+// validateBuilders validates that every group has a builder, either its own or
+// the global one.
+func (c *Composition) validateBuilders() error {
+	for _, g := range c.Groups {
+		if g.BuilderID(c.Global) == "" {
+			return fmt.Errorf("group %s has no builder, and no global builder is set", g.ID)
+		}
+	}
+	return nil
 }
 
 // ValidateForRun validates that this Composition is correct for a run.
@@ -144,6 +225,23 @@ func (c *Composition) ValidateForRun() error {
 		return err
 	}
 
+	if err := c.validateDependencies(); err != nil {
+		return err
+	}
+
+	if err := c.validateBuilders(); err != nil {
+		return err
+	}
+
+	for _, g := range c.Groups {
+		if g.Run.Churn == nil {
+			continue
+		}
+		if err := g.Run.Churn.Validate(); err != nil {
+			return fmt.Errorf("invalid churn in group %s: %w", g.ID, err)
+		}
+	}
+
 	// Calculate instances per group, and assert that sum total matches the
 	// expected value.
 	total, cum := c.Global.TotalInstances, uint(0)
@@ -180,6 +278,59 @@ func (c Composition) PickGroups(indices ...int) (Composition, error) {
 	return c, nil
 }
 
+// ValidateDependency validates that a dependency override has exactly one
+// kind of target: a version, another module at a version, a git repository, or
+// a local directory.
+func ValidateDependency(sl validator.StructLevel) {
+	dep := sl.Current().Interface().(Dependency)
+
+	if !validModulePath(dep.Module) {
+		sl.ReportError(dep.Module, "module", "Module", "module_path", "")
+	}
+	if dep.Target != "" && !validModulePath(dep.Target) {
+		sl.ReportError(dep.Target, "target", "Target", "module_path", "")
+	}
+
+	var ok bool
+	switch {
+	case dep.Git != "":
+		ok = dep.Version == "" && dep.Target == "" && dep.Path == ""
+	case dep.Path != "":
+		ok = dep.Version == "" && dep.Target == "" && dep.Ref == "" && filepath.IsAbs(dep.Path)
+	default:
+		// plain version override, or replacement with another module.
+		ok = dep.Version != "" && dep.Ref == ""
+	}
+
+	if !ok {
+		sl.ReportError(dep.Version, "version", "Version", "version_target_git_or_path", "")
+	}
+}
+
+// validModulePath returns whether p is a well-formed module path: slash
+// separated elements of ASCII letters, digits and "-._~", none of them empty or
+// starting or ending with a dot. Module paths name directories on the daemon,
+// so they must not be able to escape them.
+func validModulePath(p string) bool {
+	if p == "" {
+		return false
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if elem == "" || elem[0] == '.' || elem[len(elem)-1] == '.' {
+			return false
+		}
+		for _, r := range elem {
+			switch {
+			case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			case r == '-', r == '.', r == '_', r == '~':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // ValidateInstances validates that either count or percentage is provided, but
 // not both.
 func ValidateInstances(sl validator.StructLevel) {
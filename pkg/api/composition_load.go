@@ -0,0 +1,255 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+)
+
+// EnvCompositionVarPrefix is the prefix of environment variables that set
+// composition variables, e.g. TESTGROUND_VAR_instances=100.
+const EnvCompositionVarPrefix = "TESTGROUND_VAR_"
+
+// LoadComposition reads the composition at file, resolving its templating and
+// its base compositions. It returns whether the file used any of those
+// features, in which case it can't be written back without losing them.
+//
+// Compositions are Go templates (see text/template), rendered with:
+//
+//   - .Vars: the composition variables, set through vars, or through
+//     TESTGROUND_VAR_<name> environment variables (vars take precedence).
+//   - .Env: all environment variables.
+//
+// Missing variables render as empty strings. The `default` function supplies a
+// fallback value (`{{ .Vars.count | default "10" }}`), and the `required`
+// function fails if the variable is empty (`{{ required "count" .Vars.count }}`).
+//
+// Once rendered, a composition can declare a base composition with `extends`,
+// and a list of compositions to include with `include`, relative to its own
+// path. The base composition is merged first, then the included ones in order,
+// then the composition itself. Tables are merged key by key, and groups are
+// merged by ID: a group with the ID of an existing group overrides its fields,
+// while a group with a new ID is appended.
+func LoadComposition(file string, vars map[string]string) (comp *Composition, templated bool, err error) {
+	data := templateData(vars)
+
+	merged, templated, err := loadCompositionLayers(file, data, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Round-trip the merged tree through TOML to decode it.
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(merged); err != nil {
+		return nil, false, fmt.Errorf("failed to encode resolved composition: %w", err)
+	}
+
+	comp = new(Composition)
+	if _, err := toml.DecodeReader(buf, comp); err != nil {
+		return nil, false, fmt.Errorf("failed to decode resolved composition: %w", err)
+	}
+	return comp, templated, nil
+}
+
+type compositionTemplateData struct {
+	Vars map[string]string
+	Env  map[string]string
+}
+
+func templateData(vars map[string]string) *compositionTemplateData {
+	data := &compositionTemplateData{
+		Vars: make(map[string]string),
+		Env:  make(map[string]string),
+	}
+	for _, kv := range os.Environ() {
+		kv := strings.SplitN(kv, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		data.Env[kv[0]] = kv[1]
+		if strings.HasPrefix(kv[0], EnvCompositionVarPrefix) {
+			data.Vars[strings.TrimPrefix(kv[0], EnvCompositionVarPrefix)] = kv[1]
+		}
+	}
+	for k, v := range vars {
+		data.Vars[k] = v
+	}
+	return data
+}
+
+var compositionFuncs = template.FuncMap{
+	"default": func(def string, v string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	},
+	"required": func(name string, v string) (string, error) {
+		if v == "" {
+			return "", fmt.Errorf("required variable %s is not set", name)
+		}
+		return v, nil
+	},
+}
+
+// loadCompositionLayers renders the composition at file, and merges it on top
+// of its base and included compositions. seen tracks the files being loaded,
+// to detect cycles.
+func loadCompositionLayers(file string, data *compositionTemplateData, seen []string) (map[string]interface{}, bool, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, s := range seen {
+		if s == abs {
+			return nil, false, fmt.Errorf("composition %s includes itself: %s", file, strings.Join(append(seen, abs), " -> "))
+		}
+	}
+	seen = append(seen, abs)
+
+	raw, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read composition: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(abs)).
+		Option("missingkey=zero").
+		Funcs(compositionFuncs).
+		Parse(string(raw))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse composition template %s: %w", file, err)
+	}
+
+	rendered := new(bytes.Buffer)
+	if err := tmpl.Execute(rendered, data); err != nil {
+		return nil, false, fmt.Errorf("failed to render composition template %s: %w", file, err)
+	}
+
+	var layer map[string]interface{}
+	if _, err := toml.DecodeReader(bytes.NewReader(rendered.Bytes()), &layer); err != nil {
+		return nil, false, fmt.Errorf("failed to process composition %s: %w", file, err)
+	}
+
+	templated := !bytes.Equal(raw, rendered.Bytes())
+
+	// Collect the compositions this one builds upon, in merge order.
+	var bases []string
+	if ext, ok := layer["extends"]; ok {
+		s, ok := ext.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("composition %s: extends must be a path", file)
+		}
+		bases = append(bases, s)
+	}
+	if inc, ok := layer["include"]; ok {
+		list, ok := inc.([]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("composition %s: include must be a list of paths", file)
+		}
+		for _, i := range list {
+			s, ok := i.(string)
+			if !ok {
+				return nil, false, fmt.Errorf("composition %s: include must be a list of paths", file)
+			}
+			bases = append(bases, s)
+		}
+	}
+	delete(layer, "extends")
+	delete(layer, "include")
+
+	merged := make(map[string]interface{})
+	for _, b := range bases {
+		if !filepath.IsAbs(b) {
+			b = filepath.Join(filepath.Dir(abs), b)
+		}
+		base, _, err := loadCompositionLayers(b, data, seen)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := mergeCompositionTrees(merged, base); err != nil {
+			return nil, false, err
+		}
+		templated = true
+	}
+
+	if err := mergeCompositionTrees(merged, layer); err != nil {
+		return nil, false, fmt.Errorf("composition %s: %w", file, err)
+	}
+	return merged, templated, nil
+}
+
+// mergeCompositionTrees merges src into dst. Tables are merged recursively,
+// groups are merged by ID, and any other value in src replaces the one in dst.
+func mergeCompositionTrees(dst, src map[string]interface{}) error {
+	for k, v := range src {
+		if k != "groups" {
+			mergeValue(dst, k, v)
+			continue
+		}
+		groups, err := mergeGroups(dst[k], v)
+		if err != nil {
+			return err
+		}
+		dst[k] = groups
+	}
+	return nil
+}
+
+func mergeValue(dst map[string]interface{}, k string, v interface{}) {
+	sm, ok := v.(map[string]interface{})
+	dm, ok2 := dst[k].(map[string]interface{})
+	if !ok || !ok2 {
+		dst[k] = v
+		return
+	}
+	for sk, sv := range sm {
+		mergeValue(dm, sk, sv)
+	}
+}
+
+func mergeGroups(dst, src interface{}) ([]map[string]interface{}, error) {
+	toGroups := func(v interface{}) ([]map[string]interface{}, error) {
+		switch g := v.(type) {
+		case nil:
+			return nil, nil
+		case []map[string]interface{}:
+			return g, nil
+		default:
+			return nil, errors.New("groups must be an array of tables")
+		}
+	}
+
+	res, err := toGroups(dst)
+	if err != nil {
+		return nil, err
+	}
+	add, err := toGroups(src)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range add {
+		id, _ := g["id"].(string)
+		merged := false
+		for _, r := range res {
+			if rid, _ := r["id"].(string); id != "" && rid == id {
+				for k, v := range g {
+					mergeValue(r, k, v)
+				}
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			res = append(res, g)
+		}
+	}
+	return res, nil
+}
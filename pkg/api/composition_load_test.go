@@ -0,0 +1,80 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCompositionExtends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "composition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := `
+[global]
+plan = "dht"
+case = "find-peers"
+builder = "docker:go"
+runner = "local:docker"
+total_instances = {{ .Vars.total | default "10" }}
+
+[[groups]]
+id = "bootstrappers"
+instances = { count = 1 }
+  [groups.run]
+  test_params = { n = "1", bucket_size = "4" }
+
+[[groups]]
+id = "peers"
+instances = { count = 9 }
+`
+	child := `
+extends = "base.toml"
+
+[[groups]]
+id = "bootstrappers"
+  [groups.run]
+  test_params = { bucket_size = "{{ .Vars.bucket }}" }
+
+[[groups]]
+id = "extra"
+instances = { count = 2 }
+`
+	for name, content := range map[string]string{"base.toml": base, "child.toml": child} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	comp, templated, err := LoadComposition(filepath.Join(dir, "child.toml"), map[string]string{"total": "12", "bucket": "8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !templated {
+		t.Error("expected the composition to be reported as templated")
+	}
+
+	if comp.Global.Plan != "dht" || comp.Global.TotalInstances != 12 {
+		t.Errorf("unexpected global section: %+v", comp.Global)
+	}
+
+	var ids []string
+	for _, g := range comp.Groups {
+		ids = append(ids, g.ID)
+	}
+	if len(ids) != 3 || ids[0] != "bootstrappers" || ids[1] != "peers" || ids[2] != "extra" {
+		t.Fatalf("unexpected groups: %v", ids)
+	}
+
+	params := comp.Groups[0].Run.TestParams
+	if params["n"] != "1" || params["bucket_size"] != "8" {
+		t.Errorf("group fields were not merged: %v", params)
+	}
+	if err := comp.ValidateForRun(); err != nil {
+		t.Errorf("resolved composition is invalid: %s", err)
+	}
+}
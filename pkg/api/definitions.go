@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"text/tabwriter"
+	"time"
 
 	"github.com/ipfs/testground/pkg/config"
 	"github.com/mitchellh/go-wordwrap"
@@ -18,6 +19,23 @@ type TestPlanDefinition struct {
 	RunStrategies   map[string]config.ConfigMap `toml:"run_strategies"`
 	TestCases       []*TestCase                 `toml:"testcases"`
 	Defaults        TestPlanDefaults
+
+	// Origin is set for test plans imported from an external source, and
+	// records where they were fetched from.
+	Origin *PlanOrigin `toml:"origin,omitempty"`
+}
+
+// PlanOrigin records the external source of an imported test plan.
+type PlanOrigin struct {
+	// URL is the go-getter URL the test plan was imported from.
+	URL string `toml:"url"`
+	// Ref is the git branch, tag or commit requested on import, if any.
+	Ref string `toml:"ref,omitempty"`
+	// Revision is the git commit the source was at when it was imported. It's
+	// empty if the source is not a git repository.
+	Revision string `toml:"revision,omitempty"`
+	// ImportedAt is the time of the import.
+	ImportedAt time.Time `toml:"imported_at"`
 }
 
 // TestPlanDefaults represents the builder and runner defaults for
@@ -77,6 +95,10 @@ func (tp *TestPlanDefinition) Describe(w io.Writer) {
 
 	p(w, "Its source code is picked up from %q.", tp.SourcePath)
 
+	if o := tp.Origin; o != nil {
+		p(w, "It was imported from %q on %s (ref: %q, revision: %q).", o.URL, o.ImportedAt.Format(time.RFC3339), o.Ref, o.Revision)
+	}
+
 	bs := func() (res []string) {
 		for k := range tp.BuildStrategies {
 			res = append(res, k)
@@ -17,9 +17,14 @@ type Engine interface {
 	ListRunners() map[string]Runner
 
 	DoBuild(context.Context, *Composition, io.Writer) ([]*BuildOutput, error)
-	DoRun(context.Context, *Composition, io.Writer) (*RunOutput, error)
+	// DoRun runs a composition under the supplied run ID. If the run ID is
+	// empty, the engine generates one.
+	DoRun(ctx context.Context, runID string, comp *Composition, output io.Writer) (*RunOutput, error)
 	DoCollectOutputs(ctx context.Context, runner string, runID string, w io.Writer) error
 	DoTerminate(ctx context.Context, runner string, w io.Writer) error
+	// DoImportPlan fetches a test plan from an external source, and enrolls
+	// it in the census. It replaces a previous import of the same test plan.
+	DoImportPlan(ctx context.Context, src string, ref string, name string, w io.Writer) (*TestPlanDefinition, error)
 
 	EnvConfig() config.EnvConfig
 	Context() context.Context
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"io"
+	"time"
+
+	"github.com/ipfs/testground/sdk/runtime"
+)
+
+// EventType identifies the kind of a structured Event.
+type EventType string
+
+const (
+	EventTypeBuildStep         = EventType("build-step")
+	EventTypeInstanceStart     = EventType("instance-start")
+	EventTypeInstanceFinish    = EventType("instance-finish")
+	EventTypeMetric            = EventType("metric")
+	EventTypeMessage           = EventType("message")
+	EventTypeNetworkConfigured = EventType("network-configured")
+	EventTypeRunComplete       = EventType("run-complete")
+	EventTypeTeardown          = EventType("teardown")
+)
+
+// Event is a structured event emitted by the engine, builders and runners
+// while performing a job. Exactly one of the typed payloads is set, depending
+// on the Type.
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"ts"`
+
+	BuildStep   *BuildStepEvent   `json:"build_step,omitempty"`
+	Instance    *InstanceEvent    `json:"instance,omitempty"`
+	Network     *NetworkEvent     `json:"network,omitempty"`
+	RunComplete *RunCompleteEvent `json:"run_complete,omitempty"`
+	Teardown    *TeardownEvent    `json:"teardown,omitempty"`
+}
+
+// BuildStepEvent reports the progress of the build of a group.
+type BuildStepEvent struct {
+	BuildID string `json:"build_id"`
+	GroupID string `json:"group_id"`
+	Builder string `json:"builder"`
+	// Step is one of "started", "succeeded" or "failed".
+	Step         string `json:"step"`
+	ArtifactPath string `json:"artifact_path,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// InstanceEvent carries instance-start, instance-finish, metric and message
+// events originating from a test plan instance.
+type InstanceEvent struct {
+	// Instance is the runner-specific identifier of the instance.
+	Instance string `json:"instance"`
+	GroupID  string `json:"group_id,omitempty"`
+	// Outcome is only set for instance-finish events, and is one of "ok",
+	// "failed", "crashed" or "incomplete".
+	Outcome string               `json:"outcome,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	Message string               `json:"message,omitempty"`
+	Metric  *runtime.MetricValue `json:"metric,omitempty"`
+	Runenv  *runtime.RunParams   `json:"runenv,omitempty"`
+}
+
+// NetworkEvent reports that a data network has been set up for a run.
+type NetworkEvent struct {
+	RunID   string `json:"run_id"`
+	Name    string `json:"name"`
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// RunCompleteEvent is emitted once a run has finished, successfully or not.
+type RunCompleteEvent struct {
+	RunID     string `json:"run_id"`
+	Runner    string `json:"runner"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error,omitempty"`
+	Instances int    `json:"instances"`
+}
+
+// TeardownEvent reports the resources that were removed after a run was
+// canceled.
+type TeardownEvent struct {
+	RunID   string   `json:"run_id"`
+	Runner  string   `json:"runner"`
+	Removed []string `json:"removed"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// EventWriter is implemented by output writers that are capable of carrying
+// structured events to the client, alongside unstructured progress output.
+type EventWriter interface {
+	WriteEvent(evt *Event) error
+}
+
+// WriteEvent sends the event through w if it implements EventWriter, and
+// drops it otherwise. A zero timestamp is set to the current time.
+func WriteEvent(w io.Writer, evt *Event) {
+	ew, ok := w.(EventWriter)
+	if !ok {
+		return
+	}
+	if evt.Timestamp.IsZero() {
+		evt.Timestamp = time.Now()
+	}
+	_ = ew.WriteEvent(evt)
+}
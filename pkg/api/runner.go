@@ -76,11 +76,37 @@ type RunGroup struct {
 
 	// Parameters are the runtime parameters to the test case.
 	Parameters map[string]string
+
+	// RunnerConfig is the configuration of the runner for this group: the
+	// RunInput configuration, coalesced with the run configuration of the
+	// group. It's of the same type as RunInput.RunnerConfig. Runners must read
+	// group-scoped keys from here.
+	RunnerConfig interface{}
+
+	// Churn is the churn of the group, if any. Only runners implementing
+	// Churner are handed groups with churn.
+	Churn *Churn
 }
 
 type RunOutput struct {
 	// RunnerID is the ID of the runner used.
 	RunID string
+
+	// Groups summarises how each group was run. Runners that have nothing to
+	// report leave it empty.
+	Groups []GroupSummary
+}
+
+// GroupSummary describes how the instances of a group were run.
+type GroupSummary struct {
+	ID        string
+	Instances int
+	// Resources are the resource limits applied to each instance, in a
+	// runner-specific, human-readable form, e.g. "memory": "512MiB".
+	Resources map[string]string
+	// Nodes counts the instances of the group placed on each node, for
+	// runners that schedule instances on a cluster.
+	Nodes map[string]int
 }
 
 type CollectionInput struct {
@@ -100,3 +126,39 @@ type CollectionInput struct {
 type Terminatable interface {
 	TerminateAll() error
 }
+
+// Churner is the interface to be implemented by a runner that enforces the
+// churn of groups, and answers the lifecycle requests of test instances (pause,
+// kill, restart) sent through the sync service.
+type Churner interface {
+	// SupportsChurn is a marker method.
+	SupportsChurn()
+}
+
+// Teardownable is the interface to be implemented by a runner that can tear
+// down all resources belonging to a single run. The engine calls it when a run
+// is canceled, to guarantee that nothing is left behind.
+type Teardownable interface {
+	// TeardownRun removes all resources labelled with the run ID, and reports
+	// what was removed. It must be idempotent.
+	TeardownRun(ctx context.Context, input *TeardownInput) (*TeardownOutput, error)
+}
+
+// TeardownInput encapsulates the input options for tearing down a run.
+type TeardownInput struct {
+	// EnvConfig is the env configuration of the engine. Not a pointer to force
+	// a copy.
+	EnvConfig config.EnvConfig
+	RunID     string
+
+	// RunnerConfig is the configuration of the runner the run was scheduled
+	// with.
+	RunnerConfig interface{}
+}
+
+// TeardownOutput reports the resources removed by a teardown.
+type TeardownOutput struct {
+	// Removed describes each removed resource, as "<kind> <name>", e.g.
+	// "container tg-dht-find-peers-a1b2c3-single-0".
+	Removed []string
+}
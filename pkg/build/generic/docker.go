@@ -0,0 +1,205 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/docker"
+	"github.com/ipfs/testground/pkg/logging"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/archive"
+
+	"github.com/hashicorp/go-getter"
+)
+
+var (
+	_ api.Builder = &DockerGenericBuilder{}
+)
+
+// DockerGenericBuilder (id: "docker:generic") builds the test plan with the
+// Dockerfile it ships with. It's language-agnostic, so it can be used for
+// non-Go test plans, or for Go test plans with system dependencies that the
+// docker:go builder can't satisfy.
+type DockerGenericBuilder struct{}
+
+type DockerGenericBuilderConfig struct {
+	Enabled bool
+
+	// BuildContext is the directory to use as the docker build context,
+	// relative to the root of the test plan source (default: the root).
+	BuildContext string `toml:"build_context" overridable:"yes"`
+
+	// Dockerfile is the path to the Dockerfile, relative to the build context.
+	// It must be inside the build context (default: "Dockerfile").
+	Dockerfile string `toml:"dockerfile" overridable:"yes"`
+
+	// BuildArgs are passed to the docker build as build-time variables.
+	BuildArgs map[string]string `toml:"build_args" overridable:"yes"`
+
+	// Target is the stage to build in a multi-stage Dockerfile (default: the
+	// last stage).
+	Target string `toml:"target" overridable:"yes"`
+
+	// PushRegistry, if true, will push the resulting image to a Docker
+	// registry.
+	PushRegistry bool `toml:"push_registry" overridable:"yes"`
+
+	// RegistryType is the type of registry this builder will push the generated
+	// Docker image to, if PushRegistry is true.
+	RegistryType string `toml:"registry_type" overridable:"yes"`
+}
+
+// Build builds the test plan's Dockerfile, and outputs a Docker image tagged
+// with the build ID.
+func (b *DockerGenericBuilder) Build(ctx context.Context, in *api.BuildInput, output io.Writer) (*api.BuildOutput, error) {
+	cfg, ok := in.BuildConfig.(*DockerGenericBuilderConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected configuration type DockerGenericBuilderConfig, was: %T", in.BuildConfig)
+	}
+
+	// We don't know how to inject dependency overrides into an arbitrary
+	// build; fail instead of silently ignoring them.
+	if len(in.Dependencies) > 0 {
+		return nil, fmt.Errorf("dependency overrides are not supported by the docker:generic builder; use build_args instead")
+	}
+
+	var (
+		id  = in.BuildID
+		log = logging.S().With("build_id", id)
+	)
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	// Create a temp dir, and fetch the source into it.
+	tmp, err := ioutil.TempDir("", in.TestPlan.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed while creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// go-getter will create the dir. Local sources are symlinked, so resolve
+	// the link to tar the actual source.
+	plandst := filepath.Join(tmp, "plan")
+	if err := getter.Get(plandst, in.TestPlan.SourcePath, getter.WithContext(ctx)); err != nil {
+		return nil, err
+	}
+	root, err := filepath.EvalSymlinks(plandst)
+	if err != nil {
+		return nil, err
+	}
+
+	buildctx, dockerfile, err := resolveBuildContext(root, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]*string, len(cfg.BuildArgs))
+	for k, v := range cfg.BuildArgs {
+		v := v
+		args[k] = &v
+	}
+
+	opts := types.ImageBuildOptions{
+		Tags:       []string{id},
+		Dockerfile: dockerfile,
+		BuildArgs:  args,
+		Target:     cfg.Target,
+	}
+
+	tar, err := archive.TarWithOptions(buildctx, &archive.TarOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infow("building image", "context", buildctx, "dockerfile", dockerfile, "target", cfg.Target)
+
+	// Build the image.
+	resp, err := cli.ImageBuild(ctx, tar, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Pipe the docker output to stdout.
+	if err := docker.PipeOutput(resp.Body, output); err != nil {
+		return nil, err
+	}
+
+	out := &api.BuildOutput{
+		ArtifactPath: id,
+	}
+
+	if cfg.PushRegistry {
+		switch cfg.RegistryType {
+		case "aws":
+			err := docker.PushToAWSRegistry(ctx, log, cli, in, out)
+			return out, err
+		case "dockerhub":
+			err := docker.PushToDockerHubRegistry(ctx, log, cli, in, out)
+			return out, err
+		default:
+			return nil, fmt.Errorf("no registry type specified, or unrecognised value: %s", cfg.RegistryType)
+		}
+	}
+
+	return out, nil
+}
+
+// resolveBuildContext returns the absolute path of the build context, and the
+// path of the Dockerfile relative to it. The build context is overridable, so it
+// must not escape the root of the test plan. Only the build context is sent to
+// the docker daemon, so the Dockerfile must be inside it.
+func resolveBuildContext(root string, cfg *DockerGenericBuilderConfig) (buildctx string, dockerfile string, err error) {
+	buildctx = filepath.Join(root, cfg.BuildContext)
+	if err := confined(root, buildctx); err != nil {
+		return "", "", fmt.Errorf("invalid build context %q: %w", cfg.BuildContext, err)
+	}
+
+	if dockerfile = cfg.Dockerfile; dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	path := filepath.Join(buildctx, dockerfile)
+	if err := confined(buildctx, path); err != nil {
+		return "", "", fmt.Errorf("invalid dockerfile %q: it must be inside the build context", cfg.Dockerfile)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", "", fmt.Errorf("dockerfile not found in build context: %w", err)
+	}
+	return buildctx, dockerfile, nil
+}
+
+// confined errors if path is not root, or a path under it.
+func confined(root, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("path escapes the test plan directory")
+	}
+	return nil
+}
+
+func (*DockerGenericBuilder) ID() string {
+	return "docker:generic"
+}
+
+func (*DockerGenericBuilder) ConfigType() reflect.Type {
+	return reflect.TypeOf(DockerGenericBuilderConfig{})
+}
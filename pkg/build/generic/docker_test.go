@@ -0,0 +1,79 @@
+package generic
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+)
+
+func TestResolveBuildContext(t *testing.T) {
+	root, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, f := range []string{"Dockerfile", "docker/Dockerfile.test", "sub/Dockerfile"} {
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("FROM scratch\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name       string
+		cfg        DockerGenericBuilderConfig
+		buildctx   string
+		dockerfile string
+		fails      bool
+	}{
+		{name: "defaults", buildctx: root, dockerfile: "Dockerfile"},
+		{name: "custom dockerfile", cfg: DockerGenericBuilderConfig{Dockerfile: "docker/Dockerfile.test"}, buildctx: root, dockerfile: "docker/Dockerfile.test"},
+		{name: "custom context", cfg: DockerGenericBuilderConfig{BuildContext: "sub"}, buildctx: filepath.Join(root, "sub"), dockerfile: "Dockerfile"},
+		{name: "dockerfile in subdir of context", cfg: DockerGenericBuilderConfig{Dockerfile: "sub/Dockerfile"}, buildctx: root, dockerfile: "sub/Dockerfile"},
+		{name: "absolute context is rooted", cfg: DockerGenericBuilderConfig{BuildContext: "/sub"}, buildctx: filepath.Join(root, "sub"), dockerfile: "Dockerfile"},
+		{name: "missing dockerfile", cfg: DockerGenericBuilderConfig{Dockerfile: "Nope"}, fails: true},
+		{name: "context escapes", cfg: DockerGenericBuilderConfig{BuildContext: ".."}, fails: true},
+		{name: "context escapes through subdir", cfg: DockerGenericBuilderConfig{BuildContext: "sub/../../other"}, fails: true},
+		{name: "dockerfile escapes", cfg: DockerGenericBuilderConfig{Dockerfile: "../Dockerfile"}, fails: true},
+		{name: "dockerfile in parent of context", cfg: DockerGenericBuilderConfig{BuildContext: "sub", Dockerfile: "../Dockerfile"}, fails: true},
+		{name: "dockerfile escapes from context", cfg: DockerGenericBuilderConfig{BuildContext: "sub", Dockerfile: "../../etc/passwd"}, fails: true},
+	}
+
+	for _, c := range cases {
+		cfg := c.cfg
+		buildctx, dockerfile, err := resolveBuildContext(root, &cfg)
+		if c.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if buildctx != c.buildctx || dockerfile != c.dockerfile {
+			t.Errorf("%s: got context %s and dockerfile %s; expected %s and %s", c.name, buildctx, dockerfile, c.buildctx, c.dockerfile)
+		}
+	}
+}
+
+func TestBuildRejectsDependencies(t *testing.T) {
+	in := &api.BuildInput{
+		BuildID:      "test",
+		BuildConfig:  &DockerGenericBuilderConfig{},
+		Dependencies: api.Dependencies{{Module: "example.com/module", Version: "v1.0.0"}},
+	}
+
+	if _, err := new(DockerGenericBuilder).Build(context.Background(), in, ioutil.Discard); err == nil {
+		t.Fatal("expected dependency overrides to be rejected")
+	}
+}
@@ -2,18 +2,96 @@ package golang
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
+	"github.com/ipfs/testground/pkg/api"
+
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
+	"github.com/hashicorp/go-getter"
 	"go.uber.org/zap"
 )
 
+// depsDir is the directory of the build context, next to the plan, where
+// dependency overrides that point to source are placed.
+const depsDir = "deps"
+
+// replaceDirectives returns the arguments to `go mod edit` that apply the
+// dependency overrides to the plan. Overrides pointing to a git repository or
+// a local directory are fetched into the deps directory under basedir, so that
+// they're part of the build context, and the plan is pointed to them.
+func replaceDirectives(ctx context.Context, deps api.Dependencies, basedir string) ([]string, error) {
+	var replaces []string
+	for _, dep := range deps {
+		switch {
+		case dep.Git != "" || dep.Path != "":
+			src := dep.Path
+			if dep.Git != "" {
+				src = gitSource(dep.Git, dep.Ref)
+			}
+
+			// go-getter will create the dir.
+			dst := filepath.Join(basedir, depsDir, filepath.FromSlash(dep.Module))
+			if err := confined(filepath.Join(basedir, depsDir), dst); err != nil {
+				return nil, fmt.Errorf("invalid module path of dependency %s: %w", dep.Module, err)
+			}
+			if err := getter.Get(dst, src, getter.WithContext(ctx)); err != nil {
+				return nil, fmt.Errorf("failed to fetch the source of dependency %s: %w", dep.Module, err)
+			}
+			if err := materializeSymlink(dst); err != nil {
+				return nil, err
+			}
+			if _, err := os.Stat(filepath.Join(dst, "go.mod")); err != nil {
+				return nil, fmt.Errorf("the source of dependency %s has no go.mod file", dep.Module)
+			}
+
+			replaces = append(replaces, fmt.Sprintf("-replace=%s=../%s/%s", dep.Module, depsDir, dep.Module))
+
+		case dep.Target != "":
+			replaces = append(replaces, fmt.Sprintf("-replace=%s=%s@%s", dep.Module, dep.Target, dep.Version))
+
+		default:
+			replaces = append(replaces, fmt.Sprintf("-replace=%s=%s@%s", dep.Module, dep.Module, dep.Version))
+		}
+	}
+	return replaces, nil
+}
+
+// confined returns an error if path is not strictly inside root.
+func confined(root, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("path escapes the deps directory")
+	}
+	return nil
+}
+
+// gitSource returns the go-getter source of a git repository, checked out at
+// ref if not empty.
+func gitSource(url, ref string) string {
+	if !strings.HasPrefix(url, "git::") {
+		url = "git::" + url
+	}
+	if ref == "" {
+		return url
+	}
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	return url + sep + "ref=" + ref
+}
+
 func parseDependencies(raw string) map[string]string {
 	rawModules := strings.Split(raw, "\n")
 	modules := map[string]string{}
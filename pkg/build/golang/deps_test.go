@@ -1,9 +1,17 @@
 package golang
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
 )
 
 var testParseDependencies = []struct {
@@ -49,3 +57,176 @@ func TestParseDependencies(t *testing.T) {
 		}
 	}
 }
+
+func TestGitSource(t *testing.T) {
+	cases := []struct {
+		url, ref, expected string
+	}{
+		{"https://example.com/repo.git", "", "git::https://example.com/repo.git"},
+		{"https://example.com/repo.git", "v1.0.0", "git::https://example.com/repo.git?ref=v1.0.0"},
+		{"git::https://example.com/repo.git", "main", "git::https://example.com/repo.git?ref=main"},
+		{"https://example.com/repo.git?depth=1", "main", "git::https://example.com/repo.git?depth=1&ref=main"},
+	}
+
+	for _, c := range cases {
+		if got := gitSource(c.url, c.ref); got != c.expected {
+			t.Errorf("gitSource(%q, %q) = %q; expected %q", c.url, c.ref, got, c.expected)
+		}
+	}
+}
+
+// writeModule writes a go module with the given path to dir.
+func writeModule(t *testing.T, dir, module string) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gomod := []byte("module " + module + "\n")
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), gomod, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplaceDirectives(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "deps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// a local directory override.
+	local := filepath.Join(tmp, "local")
+	writeModule(t, local, "example.com/local")
+
+	// a git repository override, with the module at a tagged commit.
+	repo := filepath.Join(tmp, "repo")
+	writeModule(t, repo, "example.com/git")
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "go.mod"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+		{"tag", "v1.0.0"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git unavailable: %s: %s", err, out)
+		}
+	}
+
+	deps := api.Dependencies{
+		{Module: "example.com/pinned", Version: "v1.2.3"},
+		{Module: "example.com/upstream", Target: "example.com/fork", Version: "v0.1.0"},
+		{Module: "example.com/git", Git: repo, Ref: "v1.0.0"},
+		{Module: "example.com/local", Path: local},
+	}
+
+	basedir := filepath.Join(tmp, "build")
+	replaces, err := replaceDirectives(context.Background(), deps, basedir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"-replace=example.com/pinned=example.com/pinned@v1.2.3",
+		"-replace=example.com/upstream=example.com/fork@v0.1.0",
+		"-replace=example.com/git=../deps/example.com/git",
+		"-replace=example.com/local=../deps/example.com/local",
+	}
+	if !reflect.DeepEqual(replaces, expected) {
+		t.Fatalf("unexpected replace directives: %v", replaces)
+	}
+
+	// the sources must have been fetched into the build context, as copies.
+	for _, module := range []string{"example.com/git", "example.com/local"} {
+		dir := filepath.Join(basedir, depsDir, filepath.FromSlash(module))
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			t.Fatalf("expected the source of %s to be fetched: %s", module, err)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			t.Fatalf("expected the source of %s to be copied, got a symlink", module)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+			t.Fatalf("expected the source of %s to have a go.mod: %s", module, err)
+		}
+	}
+
+	// a source without a go.mod is rejected.
+	nomod := filepath.Join(tmp, "nomod")
+	if err := os.MkdirAll(nomod, 0755); err != nil {
+		t.Fatal(err)
+	}
+	deps = api.Dependencies{{Module: "example.com/nomod", Path: nomod}}
+	if _, err := replaceDirectives(context.Background(), deps, basedir); err == nil || !strings.Contains(err.Error(), "no go.mod") {
+		t.Fatalf("expected an error for a source without a go.mod, got: %v", err)
+	}
+
+	// sources are never fetched outside of the deps directory.
+	for _, module := range []string{"../escaped", ".."} {
+		deps = api.Dependencies{{Module: module, Path: local}}
+		if _, err := replaceDirectives(context.Background(), deps, basedir); err == nil || !strings.Contains(err.Error(), "escapes") {
+			t.Fatalf("expected an error for module %s, got: %v", module, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(basedir, "escaped")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be fetched outside of the deps directory: %v", err)
+	}
+}
+
+func TestValidateDependency(t *testing.T) {
+	cases := []struct {
+		name  string
+		dep   api.Dependency
+		valid bool
+	}{
+		{"version", api.Dependency{Module: "m", Version: "v1.0.0"}, true},
+		{"target", api.Dependency{Module: "m", Target: "fork", Version: "v1.0.0"}, true},
+		{"git", api.Dependency{Module: "m", Git: "https://example.com/repo.git"}, true},
+		{"git at ref", api.Dependency{Module: "m", Git: "https://example.com/repo.git", Ref: "main"}, true},
+		{"path", api.Dependency{Module: "m", Path: "/src/m"}, true},
+		{"nothing", api.Dependency{Module: "m"}, false},
+		{"target without version", api.Dependency{Module: "m", Target: "fork"}, false},
+		{"version with ref", api.Dependency{Module: "m", Version: "v1.0.0", Ref: "main"}, false},
+		{"git and version", api.Dependency{Module: "m", Git: "https://example.com/repo.git", Version: "v1.0.0"}, false},
+		{"git and target", api.Dependency{Module: "m", Git: "https://example.com/repo.git", Target: "fork"}, false},
+		{"git and path", api.Dependency{Module: "m", Git: "https://example.com/repo.git", Path: "/src/m"}, false},
+		{"path and version", api.Dependency{Module: "m", Path: "/src/m", Version: "v1.0.0"}, false},
+		{"path and ref", api.Dependency{Module: "m", Path: "/src/m", Ref: "main"}, false},
+		{"relative path", api.Dependency{Module: "m", Path: "src/m"}, false},
+		{"module path", api.Dependency{Module: "github.com/ipfs/go-ipfs_v2~x", Version: "v1.0.0"}, true},
+		{"module escaping", api.Dependency{Module: "../../../../tmp/x", Path: "/src/m"}, false},
+		{"absolute module", api.Dependency{Module: "/tmp/x", Path: "/src/m"}, false},
+		{"dot module element", api.Dependency{Module: "m/./x", Path: "/src/m"}, false},
+		{"empty module element", api.Dependency{Module: "m//x", Path: "/src/m"}, false},
+		{"module with backslash", api.Dependency{Module: `m\..\x`, Path: "/src/m"}, false},
+		{"target escaping", api.Dependency{Module: "m", Target: "../fork", Version: "v1.0.0"}, false},
+	}
+
+	for _, c := range cases {
+		comp := &api.Composition{
+			Global: api.Global{
+				Plan:           "plan",
+				Case:           "case",
+				Builder:        "docker:go",
+				Runner:         "local:docker",
+				TotalInstances: 1,
+			},
+			Groups: []api.Group{{
+				ID:        "a",
+				Instances: api.Instances{Count: 1},
+				Build:     api.Build{Dependencies: api.Dependencies{c.dep}},
+			}},
+		}
+
+		for name, validate := range map[string]func() error{
+			"build": comp.ValidateForBuild,
+			"run":   comp.ValidateForRun,
+		} {
+			if err := validate(); (err == nil) != c.valid {
+				t.Errorf("%s: validation for %s: expected valid=%t, got: %v", c.name, name, c.valid, err)
+			}
+		}
+	}
+}
@@ -2,8 +2,6 @@ package golang
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,7 +16,6 @@ import (
 	gobuild "go/build"
 
 	"github.com/ipfs/testground/pkg/api"
-	"github.com/ipfs/testground/pkg/aws"
 	"github.com/ipfs/testground/pkg/docker"
 	"github.com/ipfs/testground/pkg/logging"
 
@@ -176,11 +173,14 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 		}
 	}
 
-	// If we have version overrides, apply them.
-	var replaces []string
-	for mod, ver := range in.Dependencies {
-		// TODO(RK): allow to override target of replaces, so we can test against forks.
-		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s@%s", mod, mod, ver))
+	// If we have dependency overrides, apply them. The deps dir must exist even
+	// if empty, as the Dockerfile copies it.
+	if err := os.MkdirAll(filepath.Join(tmp, depsDir), 0755); err != nil {
+		return nil, err
+	}
+	replaces, err := replaceDirectives(ctx, in.Dependencies, tmp)
+	if err != nil {
+		return nil, err
 	}
 
 	// Inject replace directives for the SDK modules.
@@ -239,12 +239,12 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, output
 
 	if cfg.PushRegistry {
 		if cfg.RegistryType == "aws" {
-			err := pushToAWSRegistry(ctx, log, cli, in, out)
+			err := docker.PushToAWSRegistry(ctx, log, cli, in, out)
 			return out, err
 		}
 
 		if cfg.RegistryType == "dockerhub" {
-			err := pushToDockerHubRegistry(ctx, log, cli, in, out)
+			err := docker.PushToDockerHubRegistry(ctx, log, cli, in, out)
 			return out, err
 		}
 
@@ -262,89 +262,6 @@ func (*DockerGoBuilder) ConfigType() reflect.Type {
 	return reflect.TypeOf(DockerGoBuilderConfig{})
 }
 
-func pushToAWSRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
-	// Get a Docker registry authentication token from AWS ECR.
-	auth, err := aws.ECR.GetAuthToken(in.EnvConfig.AWS)
-	if err != nil {
-		return err
-	}
-
-	// AWS ECR repository name is testground-<region>-<plan_name>.
-	repo := fmt.Sprintf("testground-%s-%s", in.EnvConfig.AWS.Region, in.TestPlan.Name)
-
-	// Ensure the repo exists, or create it. Get the full URI to the repo, so we
-	// can tag images.
-	uri, err := aws.ECR.EnsureRepository(in.EnvConfig.AWS, repo)
-	if err != nil {
-		return err
-	}
-
-	// Tag the image under the AWS ECR repository.
-	tag := uri + ":" + in.BuildID
-	log.Infow("tagging image", "tag", tag)
-	if err = client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
-		return err
-	}
-
-	// TODO for some reason, this push is way slower than the equivalent via the
-	// docker CLI. Needs investigation.
-	log.Infow("pushing image", "tag", tag)
-	rc, err := client.ImagePush(ctx, tag, types.ImagePushOptions{
-		RegistryAuth: aws.ECR.EncodeAuthToken(auth),
-	})
-	if err != nil {
-		return err
-	}
-
-	// Pipe the docker output to stdout.
-	if err := docker.PipeOutput(rc, os.Stdout); err != nil {
-		return err
-	}
-
-	// replace the artifact path by the pushed image.
-	out.ArtifactPath = tag
-	return nil
-}
-
-func pushToDockerHubRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
-	uri := in.EnvConfig.DockerHub.Repo + "/testground"
-
-	tag := uri + ":" + in.BuildID
-	log.Infow("tagging image", "source", out.ArtifactPath, "repo", uri, "tag", tag)
-
-	if err := client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
-		return err
-	}
-
-	auth := types.AuthConfig{
-		Username: in.EnvConfig.DockerHub.Username,
-		Password: in.EnvConfig.DockerHub.AccessToken,
-	}
-	authBytes, err := json.Marshal(auth)
-	if err != nil {
-		return err
-	}
-	authBase64 := base64.URLEncoding.EncodeToString(authBytes)
-
-	rc, err := client.ImagePush(ctx, uri, types.ImagePushOptions{
-		RegistryAuth: authBase64,
-	})
-	if err != nil {
-		return err
-	}
-
-	log.Infow("pushed image", "source", out.ArtifactPath, "tag", tag, "repo", uri)
-
-	// Pipe the docker output to stdout.
-	if err := docker.PipeOutput(rc, os.Stdout); err != nil {
-		return err
-	}
-
-	// replace the artifact path by the pushed image.
-	out.ArtifactPath = tag
-	return nil
-}
-
 // setupGoProxy sets up a goproxy container, if and only if the build
 // configuration requires it.
 //
@@ -95,11 +95,10 @@ func (b *ExecGoBuilder) Build(ctx context.Context, input *api.BuildInput, output
 		}
 	}
 
-	// If we have version overrides, apply them.
-	var replaces []string
-	for mod, ver := range input.Dependencies {
-		// TODO(RK): allow to override target of replaces, so we can test against forks.
-		replaces = append(replaces, fmt.Sprintf("-replace=%s=%s@%s", mod, mod, ver))
+	// If we have dependency overrides, apply them.
+	replaces, err := replaceDirectives(ctx, input.Dependencies, tmp)
+	if err != nil {
+		return nil, err
 	}
 
 	// Inject replace directives for the SDK modules.
@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/ipfs/testground/pkg/logging"
 	"github.com/ipfs/testground/pkg/tgwriter"
@@ -22,15 +25,19 @@ type Client struct {
 	// client used to send and receive http requests.
 	client   *http.Client
 	endpoint string
+	// token is sent as a bearer token with every request, if set.
+	token string
 }
 
-// New initializes a new API client
-func New(endpoint string) *Client {
+// New initializes a new API client. If token is not empty, it is used to
+// authenticate against the daemon.
+func New(endpoint string, token string) *Client {
 	logging.S().Infow("testground client initialized", "addr", endpoint)
 
 	return &Client{
 		client:   &http.Client{},
 		endpoint: endpoint,
+		token:    token,
 	}
 }
 
@@ -91,6 +98,54 @@ func (c *Client) Run(ctx context.Context, r *RunRequest) (io.ReadCloser, error)
 	return c.request(ctx, "POST", "/run", bytes.NewReader(body.Bytes()))
 }
 
+// Status sends a `status` request to the daemon, for the run with the given ID.
+//
+// The Body in the response implement an io.ReadCloser and it's up to the caller
+// to close it. See `ParseStatusResponse()` for specifics.
+func (c *Client) Status(ctx context.Context, runID string) (io.ReadCloser, error) {
+	return c.request(ctx, "GET", "/runs/"+url.PathEscape(runID)+"/status", nil)
+}
+
+// Logs sends a `logs` request to the daemon, for the run with the given ID. If
+// follow is true, the daemon keeps streaming output until the run finishes.
+//
+// The Body in the response implement an io.ReadCloser and it's up to the caller
+// to close it. See `ParseLogsResponse()` for specifics.
+func (c *Client) Logs(ctx context.Context, runID string, follow bool) (io.ReadCloser, error) {
+	return c.request(ctx, "GET", "/runs/"+url.PathEscape(runID)+"/logs?follow="+strconv.FormatBool(follow), nil)
+}
+
+// Cancel sends a `cancel` request to the daemon, for the run with the given ID.
+//
+// The Body in the response implement an io.ReadCloser and it's up to the caller
+// to close it. The result is the final status of the run.
+func (c *Client) Cancel(ctx context.Context, runID string) (io.ReadCloser, error) {
+	return c.request(ctx, "POST", "/runs/"+url.PathEscape(runID)+"/cancel", nil)
+}
+
+// Queue sends a `queue` request to the daemon.
+//
+// The Body in the response implement an io.ReadCloser and it's up to the caller
+// to close it. See `ParseQueueResponse()` for specifics.
+func (c *Client) Queue(ctx context.Context) (io.ReadCloser, error) {
+	return c.request(ctx, "GET", "/queue", nil)
+}
+
+// SetPriority sends a `priority` request to the daemon, changing the priority
+// of a queued run.
+//
+// The Body in the response implement an io.ReadCloser and it's up to the caller
+// to close it. The result is the updated status of the run.
+func (c *Client) SetPriority(ctx context.Context, runID string, r *PriorityRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/runs/"+url.PathEscape(runID)+"/priority", bytes.NewReader(body.Bytes()))
+}
+
 // CollectOutputs sends a `collectOutputs` request to the daemon.
 //
 // The Body in the response implement an io.ReadCloser and it's up to the caller
@@ -116,10 +171,24 @@ func (c *Client) Terminate(ctx context.Context, r *TerminateRequest) (io.ReadClo
 	return c.request(ctx, "POST", "/terminate", bytes.NewReader(body.Bytes()))
 }
 
-func parseGeneric(r io.ReadCloser, fnProgress, fnResult func(interface{}) error) error {
-	var msg tgwriter.Msg
+// ImportPlan sends a `plan import` request to the daemon, which fetches the
+// test plan from an external source, and enrolls it.
+//
+// The Body in the response implement an io.ReadCloser and it's up to the caller
+// to close it. See `ParseImportPlanResponse()` for specifics.
+func (c *Client) ImportPlan(ctx context.Context, r *PlanImportRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/plans/import", bytes.NewReader(body.Bytes()))
+}
 
+func parseGeneric(r io.ReadCloser, fnProgress func(interface{}) error, handlers *EventHandlers, fnResult func(interface{}) error) error {
 	for dec := json.NewDecoder(r); ; {
+		var msg tgwriter.Msg
 		err := dec.Decode(&msg)
 		if err != nil {
 			return err
@@ -132,6 +201,12 @@ func parseGeneric(r io.ReadCloser, fnProgress, fnResult func(interface{}) error)
 				return err
 			}
 
+		case "event":
+			err = handlers.dispatch(msg.Event)
+			if err != nil {
+				return err
+			}
+
 		case "error":
 			return errors.New(msg.Error.Message)
 
@@ -156,10 +231,17 @@ func printProgress(progress interface{}) error {
 
 // ParseRunResponse parses a response from a `run` call
 func ParseRunResponse(r io.ReadCloser) (RunResponse, error) {
+	return ParseRunResponseWithHandlers(r, nil)
+}
+
+// ParseRunResponseWithHandlers parses a response from a `run` call, invoking
+// the supplied handlers as structured events arrive.
+func ParseRunResponseWithHandlers(r io.ReadCloser, handlers *EventHandlers) (RunResponse, error) {
 	var resp RunResponse
 	err := parseGeneric(
 		r,
 		printProgress,
+		handlers,
 		func(result interface{}) error {
 			return mapstructure.Decode(result, &resp)
 		},
@@ -172,6 +254,7 @@ func ParseListResponse(r io.ReadCloser) error {
 	return parseGeneric(
 		r,
 		printProgress,
+		nil,
 		func(result interface{}) error {
 			return nil
 		},
@@ -180,10 +263,17 @@ func ParseListResponse(r io.ReadCloser) error {
 
 // ParseBuildResponse parses a response from a `build` call
 func ParseBuildResponse(r io.ReadCloser) (BuildResponse, error) {
+	return ParseBuildResponseWithHandlers(r, nil)
+}
+
+// ParseBuildResponseWithHandlers parses a response from a `build` call,
+// invoking the supplied handlers as structured events arrive.
+func ParseBuildResponseWithHandlers(r io.ReadCloser, handlers *EventHandlers) (BuildResponse, error) {
 	var resp BuildResponse
 	err := parseGeneric(
 		r,
 		printProgress,
+		handlers,
 		func(result interface{}) error {
 			return mapstructure.Decode(result, &resp)
 		},
@@ -196,6 +286,7 @@ func ParseDescribeResponse(r io.ReadCloser) error {
 	return parseGeneric(
 		r,
 		printProgress,
+		nil,
 		func(result interface{}) error {
 			return nil
 		},
@@ -207,18 +298,94 @@ func ParseTerminateRequest(r io.ReadCloser) error {
 	return parseGeneric(
 		r,
 		printProgress,
+		nil,
 		func(result interface{}) error {
 			return nil
 		},
 	)
 }
 
+// ParseStatusResponse parses a response from a `status` or `cancel` call.
+func ParseStatusResponse(r io.ReadCloser) (RunStatus, error) {
+	var resp RunStatus
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		func(result interface{}) error {
+			return decodeResult(result, &resp)
+		},
+	)
+	return resp, err
+}
+
+// ParseQueueResponse parses a response from a `queue` call.
+func ParseQueueResponse(r io.ReadCloser) (QueueResponse, error) {
+	var resp QueueResponse
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		func(result interface{}) error {
+			return decodeResult(result, &resp)
+		},
+	)
+	return resp, err
+}
+
+// ParseLogsResponse parses a response from a `logs` call, printing the output
+// of the run, and invoking the supplied handlers as structured events arrive.
+// It returns the status of the run at the time the stream ended.
+func ParseLogsResponse(r io.ReadCloser, handlers *EventHandlers) (RunStatus, error) {
+	var resp RunStatus
+	err := parseGeneric(
+		r,
+		printProgress,
+		handlers,
+		func(result interface{}) error {
+			return decodeResult(result, &resp)
+		},
+	)
+	return resp, err
+}
+
+// ParseImportPlanResponse parses a response from a `plan import` call.
+func ParseImportPlanResponse(r io.ReadCloser) (PlanImportResponse, error) {
+	var resp PlanImportResponse
+	err := parseGeneric(
+		r,
+		printProgress,
+		nil,
+		func(result interface{}) error {
+			return decodeResult(result, &resp)
+		},
+	)
+	return resp, err
+}
+
+// decodeResult decodes a generic result payload into out, honouring json tags
+// and parsing timestamps.
+func decodeResult(result interface{}, out interface{}) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeHookFunc(time.RFC3339Nano),
+		TagName:    "json",
+		Result:     out,
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(result)
+}
+
 func (c *Client) request(ctx context.Context, method string, path string, body io.Reader) (io.ReadCloser, error) {
 	req, err := http.NewRequest(method, "http://"+c.endpoint+path, body)
-	req = req.WithContext(ctx)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
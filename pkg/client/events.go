@@ -0,0 +1,74 @@
+package client
+
+import (
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+)
+
+// EventHandlers groups the typed callbacks that are invoked as structured
+// events arrive from the daemon. Callbacks receive the timestamp of the event
+// along with its typed payload. Nil callbacks are skipped, and a nil
+// *EventHandlers ignores all events. Returning an error from a callback aborts
+// the parsing of the response.
+type EventHandlers struct {
+	OnBuildStep         func(ts time.Time, evt *api.BuildStepEvent) error
+	OnInstanceStart     func(ts time.Time, evt *api.InstanceEvent) error
+	OnInstanceFinish    func(ts time.Time, evt *api.InstanceEvent) error
+	OnMetric            func(ts time.Time, evt *api.InstanceEvent) error
+	OnMessage           func(ts time.Time, evt *api.InstanceEvent) error
+	OnNetworkConfigured func(ts time.Time, evt *api.NetworkEvent) error
+	OnRunComplete       func(ts time.Time, evt *api.RunCompleteEvent) error
+	OnTeardown          func(ts time.Time, evt *api.TeardownEvent) error
+
+	// OnEvent, if set, is invoked for every event, before the typed callback.
+	OnEvent func(evt *api.Event) error
+}
+
+func (h *EventHandlers) dispatch(evt *api.Event) error {
+	if h == nil || evt == nil {
+		return nil
+	}
+
+	if h.OnEvent != nil {
+		if err := h.OnEvent(evt); err != nil {
+			return err
+		}
+	}
+
+	switch evt.Type {
+	case api.EventTypeBuildStep:
+		if h.OnBuildStep != nil && evt.BuildStep != nil {
+			return h.OnBuildStep(evt.Timestamp, evt.BuildStep)
+		}
+	case api.EventTypeInstanceStart:
+		if h.OnInstanceStart != nil && evt.Instance != nil {
+			return h.OnInstanceStart(evt.Timestamp, evt.Instance)
+		}
+	case api.EventTypeInstanceFinish:
+		if h.OnInstanceFinish != nil && evt.Instance != nil {
+			return h.OnInstanceFinish(evt.Timestamp, evt.Instance)
+		}
+	case api.EventTypeMetric:
+		if h.OnMetric != nil && evt.Instance != nil {
+			return h.OnMetric(evt.Timestamp, evt.Instance)
+		}
+	case api.EventTypeMessage:
+		if h.OnMessage != nil && evt.Instance != nil {
+			return h.OnMessage(evt.Timestamp, evt.Instance)
+		}
+	case api.EventTypeNetworkConfigured:
+		if h.OnNetworkConfigured != nil && evt.Network != nil {
+			return h.OnNetworkConfigured(evt.Timestamp, evt.Network)
+		}
+	case api.EventTypeRunComplete:
+		if h.OnRunComplete != nil && evt.RunComplete != nil {
+			return h.OnRunComplete(evt.Timestamp, evt.RunComplete)
+		}
+	case api.EventTypeTeardown:
+		if h.OnTeardown != nil && evt.Teardown != nil {
+			return h.OnTeardown(evt.Timestamp, evt.Teardown)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package client
 
-import "github.com/ipfs/testground/pkg/api"
+import (
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+)
 
 // DescribeRequest is the request struct for the `describe` function.
 type DescribeRequest struct {
@@ -18,10 +22,73 @@ type BuildResponse = []api.BuildOutput
 // RunRequest is the request struct for the `run` function.
 type RunRequest struct {
 	Composition api.Composition `json:"composition"`
+
+	// Detach, if true, makes the daemon return as soon as the run has been
+	// accepted, with the run ID as a result, instead of streaming the output
+	// of the run until it completes.
+	Detach bool `json:"detach"`
+
+	// Priority is the priority of this run in the daemon queue. Runs with a
+	// higher priority are admitted first; the default is 0.
+	Priority int `json:"priority"`
 }
 
 type RunResponse = api.RunOutput
 
+// RunState is the state of a run tracked by the daemon.
+type RunState string
+
+const (
+	RunStateQueued    = RunState("queued")
+	RunStateRunning   = RunState("running")
+	RunStateSucceeded = RunState("succeeded")
+	RunStateFailed    = RunState("failed")
+	RunStateCanceled  = RunState("canceled")
+)
+
+// RunStatus is the response struct for the `status` function.
+type RunStatus struct {
+	RunID    string   `json:"run_id"`
+	Plan     string   `json:"plan"`
+	Case     string   `json:"case"`
+	Runner   string   `json:"runner"`
+	User     string   `json:"user"`
+	State    RunState `json:"state"`
+	Priority int      `json:"priority"`
+	// Position is the 1-based position of the run in the queue; it's only set
+	// while the run is queued.
+	Position  int       `json:"position,omitempty"`
+	Instances int       `json:"instances"`
+	Created   time.Time `json:"created"`
+	Started   time.Time `json:"started"`
+	Ended     time.Time `json:"ended"`
+	Error     string    `json:"error,omitempty"`
+	// Removed lists the resources the runner tore down after the run was
+	// canceled.
+	Removed []string `json:"removed,omitempty"`
+	// Groups summarises how each group was run, once the run has finished.
+	Groups []api.GroupSummary `json:"groups,omitempty"`
+}
+
+// Finished returns whether the run has reached a final state.
+func (s RunStatus) Finished() bool {
+	switch s.State {
+	case RunStateSucceeded, RunStateFailed, RunStateCanceled:
+		return true
+	}
+	return false
+}
+
+// QueueResponse is the response struct for the `queue` function. It lists the
+// running runs, followed by the queued runs in the order they will be
+// considered for admission.
+type QueueResponse = []RunStatus
+
+// PriorityRequest is the request struct for the `priority` function.
+type PriorityRequest struct {
+	Priority int `json:"priority"`
+}
+
 type OutputsRequest struct {
 	Runner string `json:"runner"`
 	RunID  string `json:"run_id"`
@@ -30,3 +97,24 @@ type OutputsRequest struct {
 type TerminateRequest struct {
 	Runner string `json:"runner"`
 }
+
+// PlanImportRequest is the request struct for the `plan import` function.
+type PlanImportRequest struct {
+	// URL is the source of the test plan, in go-getter syntax.
+	URL string `json:"url"`
+	// Ref is the git branch, tag or commit to import; only valid for git
+	// sources.
+	Ref string `json:"ref,omitempty"`
+	// Name overrides the name of the test plan declared in its manifest.
+	Name string `json:"name,omitempty"`
+}
+
+// PlanImportResponse is the response struct for the `plan import` function.
+type PlanImportResponse struct {
+	Name       string   `json:"name"`
+	SourcePath string   `json:"source_path"`
+	URL        string   `json:"url"`
+	Ref        string   `json:"ref,omitempty"`
+	Revision   string   `json:"revision,omitempty"`
+	TestCases  []string `json:"test_cases"`
+}
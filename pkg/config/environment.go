@@ -58,11 +58,88 @@ type DockerHubConfig struct {
 }
 
 type DaemonConfig struct {
-	Listen string `toml:"listen"`
+	Listen    string          `toml:"listen"`
+	Scheduler SchedulerConfig `toml:"scheduler"`
+
+	// Tokens enumerates the tokens accepted by the daemon, along with the
+	// permission they grant. If no tokens are configured, authentication is
+	// disabled, and every request is granted all permissions.
+	Tokens []TokenConfig `toml:"tokens"`
+
+	// AuditLog is the path of the file where the daemon records who performed
+	// which mutating operation (default: $TESTGROUND_WORKDIR/daemon/audit.log).
+	AuditLog string `toml:"audit_log"`
+}
+
+// Permission is a level of access to the daemon API. Each permission implies
+// the ones below it: terminate > run > read-only.
+type Permission string
+
+const (
+	// PermissionReadOnly grants access to listing, describing, and inspecting
+	// runs, their logs and their outputs.
+	PermissionReadOnly = Permission("read-only")
+	// PermissionRun grants access to building, running, and canceling or
+	// reprioritising one's own runs.
+	PermissionRun = Permission("run")
+	// PermissionTerminate grants access to terminating all jobs on a runner,
+	// and to canceling or reprioritising anyone's runs.
+	PermissionTerminate = Permission("terminate")
+)
+
+var permissionLevels = map[Permission]int{
+	PermissionReadOnly:  1,
+	PermissionRun:       2,
+	PermissionTerminate: 3,
+}
+
+// Valid returns whether this is a known permission.
+func (p Permission) Valid() bool {
+	_, ok := permissionLevels[p]
+	return ok
+}
+
+// Allows returns whether this permission grants the required one.
+func (p Permission) Allows(required Permission) bool {
+	return permissionLevels[p] >= permissionLevels[required]
+}
+
+// TokenConfig is a token accepted by the daemon.
+type TokenConfig struct {
+	// Name identifies the holder of the token in logs and in the audit log.
+	Name       string     `toml:"name"`
+	Token      string     `toml:"token"`
+	Permission Permission `toml:"permission"`
+}
+
+// SchedulerConfig configures how the daemon admits queued runs.
+type SchedulerConfig struct {
+	// Runners maps runner IDs to the admission limits that apply to them.
+	// Runners without an entry are not limited.
+	Runners map[string]RunnerLimits `toml:"runners"`
+
+	// RetainRuns is the number of finished runs, along with their logs, that
+	// the daemon keeps in memory for clients to inspect. The oldest finished
+	// runs are evicted first (default: 100).
+	RetainRuns int `toml:"retain_runs"`
+}
+
+// RunnerLimits are the admission limits of a runner. Zero values mean no
+// limit.
+type RunnerLimits struct {
+	// MaxConcurrentRuns is the maximum number of runs that can execute on the
+	// runner at the same time.
+	MaxConcurrentRuns int `toml:"max_concurrent_runs"`
+	// MaxInstances is the capacity of the runner, expressed as the maximum
+	// number of instances that can be running at the same time, across all
+	// runs.
+	MaxInstances int `toml:"max_instances"`
 }
 
 type ClientConfig struct {
 	Endpoint string `toml:"endpoint"`
+	// Token is sent to the daemon to authenticate requests.
+	Token string `toml:"token"`
 }
 
 type ConfigMap map[string]interface{}
@@ -99,6 +176,9 @@ func applyDefaults(ec *EnvConfig) {
 	if ec.Client.Endpoint == "" {
 		ec.Client.Endpoint = DefaultListenAddr
 	}
+	if ec.Daemon.AuditLog == "" {
+		ec.Daemon.AuditLog = filepath.Join(ec.WrkDir, "daemon", "audit.log")
+	}
 }
 
 // locateSrcDir attempts to locate the source directory for the testground. We
@@ -0,0 +1,194 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/testground/pkg/config"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+// anonymous is the identity assigned to all requests when authentication is
+// disabled.
+var anonymous = &identity{Name: "anonymous", Permission: config.PermissionTerminate}
+
+// identity is the authenticated holder of a token.
+type identity struct {
+	Name       string
+	Permission config.Permission
+}
+
+type identityKey struct{}
+
+// identityFrom returns the identity attached to the request by the
+// authenticator.
+func identityFrom(r *http.Request) *identity {
+	if id, ok := r.Context().Value(identityKey{}).(*identity); ok {
+		return id
+	}
+	return anonymous
+}
+
+// authenticator checks the bearer tokens of incoming requests against the
+// tokens configured in the [daemon] section of .env.toml.
+type authenticator struct {
+	tokens []config.TokenConfig
+}
+
+func newAuthenticator(tokens []config.TokenConfig) (*authenticator, error) {
+	seen := make(map[string]struct{}, len(tokens))
+	for i, t := range tokens {
+		switch {
+		case t.Token == "":
+			return nil, fmt.Errorf("daemon token %d (%q) is empty", i, t.Name)
+		case t.Name == "":
+			return nil, fmt.Errorf("daemon token %d has no name", i)
+		case !t.Permission.Valid():
+			return nil, fmt.Errorf("daemon token %q has invalid permission %q; allowed: %s, %s, %s",
+				t.Name, t.Permission, config.PermissionReadOnly, config.PermissionRun, config.PermissionTerminate)
+		}
+		if _, ok := seen[t.Token]; ok {
+			return nil, fmt.Errorf("daemon token %q is duplicated", t.Name)
+		}
+		seen[t.Token] = struct{}{}
+	}
+
+	if len(tokens) == 0 {
+		logging.S().Warnw("no daemon tokens configured; authentication is disabled")
+	}
+	return &authenticator{tokens: tokens}, nil
+}
+
+// authenticate resolves the identity behind the request, or returns nil if the
+// request carries no valid token.
+func (a *authenticator) authenticate(r *http.Request) *identity {
+	if len(a.tokens) == 0 {
+		return anonymous
+	}
+
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return nil
+	}
+	token := []byte(strings.TrimPrefix(h, "Bearer "))
+
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(token, []byte(t.Token)) == 1 {
+			return &identity{Name: t.Name, Permission: t.Permission}
+		}
+	}
+	return nil
+}
+
+// require wraps a handler, only letting requests through if they're
+// authenticated with a token that grants the required permission.
+func (a *authenticator) require(perm config.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		id := a.authenticate(r)
+		if id == nil {
+			tgw := tgwriter.New(w, r, log)
+			w.WriteHeader(http.StatusUnauthorized)
+			tgw.WriteError("unauthorized: missing or invalid token", "path", r.URL.Path)
+			return
+		}
+
+		if !id.Permission.Allows(perm) {
+			tgw := tgwriter.New(w, r, log)
+			w.WriteHeader(http.StatusForbidden)
+			tgw.WriteError("forbidden", "user", id.Name, "permission", id.Permission, "required", perm)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), identityKey{}, id)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// authorizeRunChange checks that the identity behind the request is allowed to
+// modify the run: holders of the run permission can only modify their own
+// runs, while holders of the terminate permission can modify any run.
+func authorizeRunChange(r *http.Request, tr *trackedRun) error {
+	id := identityFrom(r)
+	if owner := tr.Status().User; owner != id.Name && !id.Permission.Allows(config.PermissionTerminate) {
+		return fmt.Errorf("forbidden: run %s belongs to %s; user %s needs the %s permission to modify it",
+			tr.id, owner, id.Name, config.PermissionTerminate)
+	}
+	return nil
+}
+
+// auditEntry is a line of the audit log.
+type auditEntry struct {
+	Time      time.Time              `json:"ts"`
+	User      string                 `json:"user"`
+	Action    string                 `json:"action"`
+	Remote    string                 `json:"remote"`
+	RequestID string                 `json:"ruid"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// auditLog records who performed which mutating operation against the daemon,
+// as newline-delimited JSON.
+type auditLog struct {
+	lk   sync.Mutex
+	file *os.File
+}
+
+func newAuditLog(path string) (*auditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return nil, fmt.Errorf("failed to create audit log dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &auditLog{file: f}, nil
+}
+
+// record appends an entry for the request to the audit log. keysAndValues are
+// alternating keys and values detailing the operation.
+func (l *auditLog) record(r *http.Request, action string, keysAndValues ...interface{}) {
+	entry := auditEntry{
+		Time:      time.Now(),
+		User:      identityFrom(r).Name,
+		Action:    action,
+		Remote:    r.RemoteAddr,
+		RequestID: r.Header.Get("X-Request-ID"),
+		Details:   make(map[string]interface{}, len(keysAndValues)/2),
+	}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		entry.Details[fmt.Sprint(keysAndValues[i])] = keysAndValues[i+1]
+	}
+
+	logging.S().Infow("audit", append([]interface{}{"user", entry.User, "action", action}, keysAndValues...)...)
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		logging.S().Errorw("failed to encode audit entry", "err", err)
+		return
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		logging.S().Errorw("failed to write audit entry", "err", err)
+	}
+}
+
+func (l *auditLog) Close() error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	return l.file.Close()
+}
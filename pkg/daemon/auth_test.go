@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/config"
+)
+
+func TestAuthenticatorPermissions(t *testing.T) {
+	auth, err := newAuthenticator([]config.TokenConfig{
+		{Name: "viewer", Token: "t-ro", Permission: config.PermissionReadOnly},
+		{Name: "ci", Token: "t-run", Permission: config.PermissionRun},
+		{Name: "admin", Token: "t-admin", Permission: config.PermissionTerminate},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var called *identity
+	handler := auth.require(config.PermissionRun, func(w http.ResponseWriter, r *http.Request) {
+		called = identityFrom(r)
+	})
+
+	cases := []struct {
+		token  string
+		status int
+		user   string
+	}{
+		{"", http.StatusUnauthorized, ""},
+		{"bogus", http.StatusUnauthorized, ""},
+		{"t-ro", http.StatusForbidden, ""},
+		{"t-run", http.StatusOK, "ci"},
+		{"t-admin", http.StatusOK, "admin"},
+	}
+
+	for _, c := range cases {
+		called = nil
+
+		r := httptest.NewRequest("POST", "/run", nil)
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if w.Code != c.status {
+			t.Errorf("token %q: expected status %d, got %d", c.token, c.status, w.Code)
+		}
+		switch {
+		case c.user == "" && called != nil:
+			t.Errorf("token %q: handler should not have been called", c.token)
+		case c.user != "" && (called == nil || called.Name != c.user):
+			t.Errorf("token %q: expected handler to be called as %s, got %v", c.token, c.user, called)
+		}
+	}
+}
+
+func TestAuthenticatorRejectsInvalidTokens(t *testing.T) {
+	invalid := [][]config.TokenConfig{
+		{{Name: "a", Token: "", Permission: config.PermissionRun}},
+		{{Name: "", Token: "x", Permission: config.PermissionRun}},
+		{{Name: "a", Token: "x", Permission: "admin"}},
+		{
+			{Name: "a", Token: "x", Permission: config.PermissionRun},
+			{Name: "b", Token: "x", Permission: config.PermissionReadOnly},
+		},
+	}
+
+	for i, tokens := range invalid {
+		if _, err := newAuthenticator(tokens); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
@@ -18,7 +18,7 @@ func (srv *Daemon) buildHandler(engine api.Engine) func(w http.ResponseWriter, r
 		log.Debugw("handle request", "command", "build")
 		defer log.Debugw("request handled", "command", "build")
 
-		tgw := tgwriter.New(w, log)
+		tgw := tgwriter.New(w, r, log)
 
 		var req client.BuildRequest
 		err := json.NewDecoder(r.Body).Decode(&req)
@@ -27,6 +27,12 @@ func (srv *Daemon) buildHandler(engine api.Engine) func(w http.ResponseWriter, r
 			return
 		}
 
+		srv.audit.record(r, "build",
+			"plan", req.Composition.Global.Plan,
+			"builder", req.Composition.Global.Builder,
+			"groups", len(req.Composition.Groups),
+		)
+
 		out, err := engine.DoBuild(r.Context(), &req.Composition, tgw)
 		if err != nil {
 			tgw.WriteError(fmt.Sprintf("engine build error: %s", err))
@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+func (srv *Daemon) runCancelHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "cancel")
+		defer log.Debugw("request handled", "command", "cancel")
+
+		tgw := tgwriter.New(w, r, log)
+
+		tr, err := srv.runs.get(mux.Vars(r)["id"])
+		if err != nil {
+			tgw.WriteError(err.Error())
+			return
+		}
+
+		if err := authorizeRunChange(r, tr); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			tgw.WriteError(err.Error())
+			return
+		}
+
+		if st := tr.Status(); st.Finished() {
+			tgw.WriteError("run already finished", "run_id", tr.id, "state", st.State)
+			return
+		}
+
+		log.Infow("canceling run", "run_id", tr.id)
+		srv.audit.record(r, "cancel", "run_id", tr.id, "owner", tr.Status().User)
+		srv.runs.cancel(tr)
+
+		// Wait until the engine has returned, so that the reported status is
+		// final.
+		select {
+		case <-tr.Done():
+		case <-r.Context().Done():
+			return
+		}
+
+		tgw.WriteResult(tr.Status())
+	}
+}
@@ -8,12 +8,16 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/ipfs/testground/pkg/config"
 	"github.com/ipfs/testground/pkg/engine"
 	"github.com/ipfs/testground/pkg/logging"
 	"github.com/pborman/uuid"
 )
 
 type Daemon struct {
+	runs   *runTracker
+	auth   *authenticator
+	audit  *auditLog
 	server *http.Server
 	l      net.Listener
 	doneCh chan struct{}
@@ -25,6 +29,24 @@ type Daemon struct {
 // * GET /describe: sends a `describe` request to the daemon. describes a test plan or test case.
 // * POST /build: sends a `build` request to the daemon. builds a test plan.
 // * POST /run: sends a `run` request to the daemon. (builds and) runs test case with name `<testplan>/<testcase>`.
+// If the request is marked as detached, it returns the run ID as soon as the run has been accepted.
+// * GET /runs/{id}/status: returns the status of a run.
+// * GET /runs/{id}/logs: returns the output of a run; with `?follow=true`, it keeps streaming until the run ends.
+// * POST /runs/{id}/cancel: cancels a run, and returns its final status.
+// * POST /runs/{id}/priority: changes the priority of a queued run, reordering the queue.
+// * GET /queue: lists the running and queued runs, in admission order.
+// * POST /plans/import: fetches a test plan from an external source, and enrolls it.
+//
+// Responses are streams of protocol messages (see tgwriter.Msg), framed as
+// newline-delimited JSON, or as Server-Sent Events if the request carries an
+// `Accept: text/event-stream` header. Besides unstructured progress output,
+// /build and /run stream typed events (see api.Event).
+//
+// If tokens are configured in the [daemon] section of .env.toml, requests must
+// carry an `Authorization: Bearer <token>` header, and each endpoint requires
+// a permission (see config.Permission). Mutating operations are recorded in
+// the audit log.
+//
 // A type-safe client for this server can be found in the `pkg/client` package.
 func New(listenAddr string) (srv *Daemon, err error) {
 	srv = new(Daemon)
@@ -34,7 +56,26 @@ func New(listenAddr string) (srv *Daemon, err error) {
 		return nil, err
 	}
 
-	r := mux.NewRouter()
+	envcfg := engine.EnvConfig()
+
+	srv.auth, err = newAuthenticator(envcfg.Daemon.Tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	srv.audit, err = newAuditLog(envcfg.Daemon.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+
+	srv.runs = newRunTracker(engine)
+
+	var (
+		r         = mux.NewRouter()
+		readOnly  = func(h http.HandlerFunc) http.HandlerFunc { return srv.auth.require(config.PermissionReadOnly, h) }
+		run       = func(h http.HandlerFunc) http.HandlerFunc { return srv.auth.require(config.PermissionRun, h) }
+		terminate = func(h http.HandlerFunc) http.HandlerFunc { return srv.auth.require(config.PermissionTerminate, h) }
+	)
 
 	// Set a unique request ID.
 	r.Use(func(next http.Handler) http.Handler {
@@ -44,18 +85,25 @@ func New(listenAddr string) (srv *Daemon, err error) {
 		})
 	})
 
-	r.HandleFunc("/list", srv.listHandler(engine)).Methods("GET")
-	r.HandleFunc("/describe", srv.describeHandler(engine)).Methods("GET")
-	r.HandleFunc("/build", srv.buildHandler(engine)).Methods("POST")
-	r.HandleFunc("/run", srv.runHandler(engine)).Methods("POST")
-	r.HandleFunc("/outputs", srv.outputsHandler(engine)).Methods("POST")
-	r.HandleFunc("/terminate", srv.terminateHandler(engine)).Methods("POST")
+	r.HandleFunc("/list", readOnly(srv.listHandler(engine))).Methods("GET")
+	r.HandleFunc("/describe", readOnly(srv.describeHandler(engine))).Methods("GET")
+	r.HandleFunc("/build", run(srv.buildHandler(engine))).Methods("POST")
+	r.HandleFunc("/run", run(srv.runHandler(engine))).Methods("POST")
+	r.HandleFunc("/outputs", readOnly(srv.outputsHandler(engine))).Methods("POST")
+	r.HandleFunc("/terminate", terminate(srv.terminateHandler(engine))).Methods("POST")
+	r.HandleFunc("/runs/{id}/status", readOnly(srv.runStatusHandler(engine))).Methods("GET")
+	r.HandleFunc("/runs/{id}/logs", readOnly(srv.runLogsHandler(engine))).Methods("GET")
+	r.HandleFunc("/runs/{id}/cancel", run(srv.runCancelHandler(engine))).Methods("POST")
+	r.HandleFunc("/runs/{id}/priority", run(srv.runPriorityHandler(engine))).Methods("POST")
+	r.HandleFunc("/queue", readOnly(srv.queueHandler(engine))).Methods("GET")
+	r.HandleFunc("/plans/import", run(srv.importPlanHandler(engine))).Methods("POST")
 
 	srv.doneCh = make(chan struct{})
 	srv.server = &http.Server{
-		Handler:      r,
-		WriteTimeout: 600 * time.Second,
-		ReadTimeout:  600 * time.Second,
+		Handler: r,
+		// No WriteTimeout: attached runs and followed logs stream for as long
+		// as the run lasts.
+		ReadTimeout: 600 * time.Second,
 	}
 
 	srv.l, err = net.Listen("tcp", listenAddr)
@@ -90,5 +138,6 @@ func (s *Daemon) Port() int {
 
 func (s *Daemon) Shutdown(ctx context.Context) error {
 	defer close(s.doneCh)
+	defer s.audit.Close()
 	return s.server.Shutdown(ctx)
 }
@@ -21,7 +21,7 @@ func (srv *Daemon) describeHandler(engine api.Engine) func(w http.ResponseWriter
 		log.Debugw("handle request", "command", "describe")
 		defer log.Debugw("request handled", "command", "describe")
 
-		tgw := tgwriter.New(w, log)
+		tgw := tgwriter.New(w, r, log)
 
 		var req client.DescribeRequest
 		err := json.NewDecoder(r.Body).Decode(&req)
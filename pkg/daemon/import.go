@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+func (srv *Daemon) importPlanHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "plan import")
+		defer log.Debugw("request handled", "command", "plan import")
+
+		tgw := tgwriter.New(w, r, log)
+
+		var req client.PlanImportRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("cannot json decode request body", "err", err)
+			return
+		}
+
+		if req.URL == "" {
+			tgw.WriteError("missing test plan source url")
+			return
+		}
+
+		srv.audit.record(r, "plan_import", "url", req.URL, "ref", req.Ref, "name", req.Name)
+
+		plan, err := engine.DoImportPlan(r.Context(), req.URL, req.Ref, req.Name, tgw)
+		if err != nil {
+			tgw.WriteError(fmt.Sprintf("engine plan import error: %s", err))
+			return
+		}
+
+		res := client.PlanImportResponse{
+			Name:       plan.Name,
+			SourcePath: plan.SourcePath,
+			URL:        plan.Origin.URL,
+			Ref:        plan.Origin.Ref,
+			Revision:   plan.Origin.Revision,
+		}
+		for _, tc := range plan.TestCases {
+			res.TestCases = append(res.TestCases, tc.Name)
+		}
+
+		tgw.WriteResult(res)
+	}
+}
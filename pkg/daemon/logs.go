@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+func (srv *Daemon) runLogsHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "logs")
+		defer log.Debugw("request handled", "command", "logs")
+
+		tgw := tgwriter.New(w, r, log)
+
+		tr, err := srv.runs.get(mux.Vars(r)["id"])
+		if err != nil {
+			tgw.WriteError(err.Error())
+			return
+		}
+
+		follow := r.URL.Query().Get("follow") == "true"
+		if err := tr.Replay(r.Context(), tgw, follow); err != nil {
+			log.Debugw("stopped replaying logs", "run_id", tr.id, "err", err)
+			return
+		}
+
+		tgw.WriteResult(tr.Status())
+	}
+}
@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+func (srv *Daemon) runPriorityHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "priority")
+		defer log.Debugw("request handled", "command", "priority")
+
+		tgw := tgwriter.New(w, r, log)
+
+		var req client.PriorityRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("cannot json decode request body", "err", err)
+			return
+		}
+
+		tr, err := srv.runs.get(mux.Vars(r)["id"])
+		if err != nil {
+			tgw.WriteError(err.Error())
+			return
+		}
+
+		if err := authorizeRunChange(r, tr); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			tgw.WriteError(err.Error())
+			return
+		}
+
+		srv.audit.record(r, "priority", "run_id", tr.id, "owner", tr.Status().User, "priority", req.Priority)
+
+		if err := srv.runs.setPriority(tr, req.Priority); err != nil {
+			tgw.WriteError(err.Error())
+			return
+		}
+
+		tgw.WriteResult(tr.Status())
+	}
+}
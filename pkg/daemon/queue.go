@@ -0,0 +1,21 @@
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+func (srv *Daemon) queueHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "queue")
+		defer log.Debugw("request handled", "command", "queue")
+
+		tgw := tgwriter.New(w, r, log)
+		tgw.WriteResult(srv.runs.list())
+	}
+}
@@ -18,7 +18,7 @@ func (srv *Daemon) runHandler(engine api.Engine) func(w http.ResponseWriter, r *
 		log.Debugw("handle request", "command", "run")
 		defer log.Debugw("request handled", "command", "run")
 
-		tgw := tgwriter.New(w, log)
+		tgw := tgwriter.New(w, r, log)
 
 		var req client.RunRequest
 		err := json.NewDecoder(r.Body).Decode(&req)
@@ -27,7 +27,43 @@ func (srv *Daemon) runHandler(engine api.Engine) func(w http.ResponseWriter, r *
 			return
 		}
 
-		out, err := engine.DoRun(r.Context(), &req.Composition, tgw)
+		if err := req.Composition.ValidateForRun(); err != nil {
+			tgw.WriteError(fmt.Sprintf("engine run error: invalid composition: %s", err))
+			return
+		}
+
+		user := identityFrom(r).Name
+		tr, err := srv.runs.submit(&req.Composition, req.Priority, user)
+		if err != nil {
+			tgw.WriteError(fmt.Sprintf("run rejected: %s", err))
+			return
+		}
+
+		srv.audit.record(r, "run",
+			"run_id", tr.id,
+			"plan", req.Composition.Global.Plan,
+			"case", req.Composition.Global.Case,
+			"runner", tr.runner,
+			"instances", req.Composition.Global.TotalInstances,
+			"priority", req.Priority,
+			"detach", req.Detach,
+		)
+		log.Infow("run submitted", "run_id", tr.id, "detach", req.Detach, "priority", req.Priority)
+
+		if req.Detach {
+			tgw.WriteResult(&api.RunOutput{RunID: tr.id})
+			return
+		}
+
+		// Stream the output of the run until it finishes. Attached runs are
+		// bound to the request, so we cancel the run if the client goes away.
+		if err := tr.Replay(r.Context(), tgw, true); err != nil {
+			log.Infow("client went away; canceling attached run", "run_id", tr.id, "err", err)
+			srv.runs.cancel(tr)
+			return
+		}
+
+		out, err := tr.Result()
 		if err != nil {
 			tgw.WriteError(fmt.Sprintf("engine run error: %s", err))
 			return
@@ -0,0 +1,462 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/config"
+	"github.com/ipfs/testground/pkg/engine"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+var errRunNotFound = errors.New("run not found")
+
+// defaultRetainRuns is the number of finished runs kept by the tracker when
+// the scheduler config doesn't specify it.
+const defaultRetainRuns = 100
+
+// runTracker keeps track of the runs submitted to this daemon, along with
+// their output, so that clients can detach from a run and come back later to
+// poll its status or follow its logs.
+//
+// It also acts as the scheduler of the daemon. Runs are queued, ordered by
+// priority (highest first) and submission order, and admitted as soon as the
+// limits of their runner allow (see config.RunnerLimits). Runs are considered
+// in order for each runner, so a large run at the head of the queue is not
+// starved by smaller runs submitted after it.
+//
+// Only the most recent finished runs are retained (see
+// config.SchedulerConfig.RetainRuns); older ones are forgotten, along with
+// their output.
+//
+// TODO: runs are only tracked in memory, and are lost when the daemon
+// restarts. Persist them in the state db once we have one.
+type runTracker struct {
+	engine api.Engine
+	limits map[string]config.RunnerLimits
+	retain int
+
+	lk       sync.RWMutex
+	runs     map[string]*trackedRun
+	queue    []*trackedRun
+	finished []*trackedRun
+	usage    map[string]*runnerUsage
+	seq      uint64
+}
+
+// runnerUsage accounts for the runs currently executing on a runner.
+type runnerUsage struct {
+	runs      int
+	instances int
+}
+
+// trackedRun is a run that was submitted to the daemon. Its output is recorded
+// as a sequence of protocol messages, which can be replayed and followed.
+type trackedRun struct {
+	id     string
+	seq    uint64
+	runner string
+	comp   api.Composition
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lk      sync.Mutex
+	cond    *sync.Cond
+	status  client.RunStatus
+	msgs    []tgwriter.Msg
+	out     *api.RunOutput
+	err     error
+	doneCh  chan struct{}
+	stopped bool
+}
+
+var _ api.EventWriter = (*trackedRun)(nil)
+
+func newRunTracker(engine api.Engine) *runTracker {
+	cfg := engine.EnvConfig().Daemon.Scheduler
+
+	retain := cfg.RetainRuns
+	if retain <= 0 {
+		retain = defaultRetainRuns
+	}
+
+	return &runTracker{
+		engine: engine,
+		limits: cfg.Runners,
+		retain: retain,
+		runs:   make(map[string]*trackedRun),
+		usage:  make(map[string]*runnerUsage),
+	}
+}
+
+// submit enqueues the composition to be run in the background, and returns the
+// tracked run immediately. user is the name of the submitter. The run is not
+// bound to the lifetime of the request that submitted it; it ends when it
+// completes or is canceled.
+//
+// It errors if the run could never be admitted, because it requests more
+// instances than the capacity of its runner.
+func (t *runTracker) submit(comp *api.Composition, priority int, user string) (*trackedRun, error) {
+	runner := t.resolveRunner(comp)
+	instances := int(comp.Global.TotalInstances)
+
+	if l := t.limits[runner]; l.MaxInstances > 0 && instances > l.MaxInstances {
+		return nil, fmt.Errorf("run requests %d instances, but the capacity of runner %s is %d", instances, runner, l.MaxInstances)
+	}
+
+	ctx, cancel := context.WithCancel(t.engine.Context())
+
+	id := engine.NewRunID()
+	tr := &trackedRun{
+		id:     id,
+		runner: runner,
+		comp:   *comp,
+		ctx:    ctx,
+		cancel: cancel,
+		doneCh: make(chan struct{}),
+		status: client.RunStatus{
+			RunID:     id,
+			Plan:      comp.Global.Plan,
+			Case:      comp.Global.Case,
+			Runner:    runner,
+			User:      user,
+			State:     client.RunStateQueued,
+			Priority:  priority,
+			Instances: instances,
+			Created:   time.Now(),
+		},
+	}
+	tr.cond = sync.NewCond(&tr.lk)
+
+	t.lk.Lock()
+	t.seq++
+	tr.seq = t.seq
+	t.runs[id] = tr
+	t.queue = append(t.queue, tr)
+	t.scheduleLocked()
+	t.lk.Unlock()
+
+	return tr, nil
+}
+
+// resolveRunner returns the runner the composition will execute on, applying
+// the test plan default if the composition doesn't specify one.
+func (t *runTracker) resolveRunner(comp *api.Composition) string {
+	if comp.Global.Runner != "" {
+		return comp.Global.Runner
+	}
+	if plan := t.engine.TestCensus().PlanByName(comp.Global.Plan); plan != nil {
+		return plan.Defaults.Runner
+	}
+	return ""
+}
+
+// scheduleLocked admits as many queued runs as the runner limits allow. It
+// must be called with the lock held.
+func (t *runTracker) scheduleLocked() {
+	sort.SliceStable(t.queue, func(i, j int) bool {
+		a, b := t.queue[i], t.queue[j]
+		if pa, pb := a.priority(), b.priority(); pa != pb {
+			return pa > pb
+		}
+		return a.seq < b.seq
+	})
+
+	var (
+		blocked = make(map[string]bool)
+		pending = t.queue[:0]
+	)
+	for _, tr := range t.queue {
+		if blocked[tr.runner] || !t.admissibleLocked(tr) {
+			// preserve the order for this runner; runs behind this one must
+			// wait for it to be admitted.
+			blocked[tr.runner] = true
+			pending = append(pending, tr)
+			continue
+		}
+		t.startLocked(tr)
+	}
+	t.queue = pending
+
+	for i, tr := range t.queue {
+		tr.setPosition(i + 1)
+	}
+}
+
+func (t *runTracker) admissibleLocked(tr *trackedRun) bool {
+	limits := t.limits[tr.runner]
+	usage := t.usage[tr.runner]
+	if usage == nil {
+		return true
+	}
+	if limits.MaxConcurrentRuns > 0 && usage.runs >= limits.MaxConcurrentRuns {
+		return false
+	}
+	if limits.MaxInstances > 0 && usage.instances+tr.status.Instances > limits.MaxInstances {
+		return false
+	}
+	return true
+}
+
+func (t *runTracker) startLocked(tr *trackedRun) {
+	usage, ok := t.usage[tr.runner]
+	if !ok {
+		usage = new(runnerUsage)
+		t.usage[tr.runner] = usage
+	}
+	usage.runs++
+	usage.instances += tr.status.Instances
+
+	tr.lk.Lock()
+	tr.status.State = client.RunStateRunning
+	tr.status.Position = 0
+	tr.status.Started = time.Now()
+	tr.lk.Unlock()
+
+	logging.S().Infow("run admitted", "run_id", tr.id, "runner", tr.runner, "instances", tr.status.Instances)
+
+	go func() {
+		defer tr.cancel()
+
+		out, err := t.engine.DoRun(tr.ctx, tr.id, &tr.comp, tr)
+		tr.finish(out, err)
+
+		t.lk.Lock()
+		usage.runs--
+		usage.instances -= tr.status.Instances
+		t.retireLocked(tr)
+		t.scheduleLocked()
+		t.lk.Unlock()
+	}()
+}
+
+// retireLocked records that the run has finished, and evicts the oldest
+// finished runs beyond the retention limit. It must be called with the lock
+// held.
+func (t *runTracker) retireLocked(tr *trackedRun) {
+	t.finished = append(t.finished, tr)
+	for len(t.finished) > t.retain {
+		old := t.finished[0]
+		t.finished[0] = nil
+		t.finished = t.finished[1:]
+		delete(t.runs, old.id)
+
+		logging.S().Debugw("evicted finished run", "run_id", old.id)
+	}
+}
+
+// get returns the tracked run with the given ID.
+func (t *runTracker) get(id string) (*trackedRun, error) {
+	t.lk.RLock()
+	defer t.lk.RUnlock()
+
+	tr, ok := t.runs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errRunNotFound, id)
+	}
+	return tr, nil
+}
+
+// cancel cancels the run. Queued runs are removed from the queue right away;
+// running runs have their context canceled.
+func (t *runTracker) cancel(tr *trackedRun) {
+	t.lk.Lock()
+	for i, q := range t.queue {
+		if q == tr {
+			t.queue = append(t.queue[:i], t.queue[i+1:]...)
+			t.retireLocked(tr)
+			t.scheduleLocked()
+			t.lk.Unlock()
+
+			tr.cancel()
+			tr.finish(nil, context.Canceled)
+			return
+		}
+	}
+	t.lk.Unlock()
+
+	tr.cancel()
+}
+
+// setPriority changes the priority of a queued run, and reorders the queue.
+func (t *runTracker) setPriority(tr *trackedRun, priority int) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if st := tr.Status(); st.State != client.RunStateQueued {
+		return fmt.Errorf("run %s is not queued; state: %s", tr.id, st.State)
+	}
+
+	tr.lk.Lock()
+	tr.status.Priority = priority
+	tr.lk.Unlock()
+
+	t.scheduleLocked()
+	return nil
+}
+
+// list returns the status of all runs that haven't finished yet: running runs
+// first, followed by queued runs in queue order.
+func (t *runTracker) list() []client.RunStatus {
+	t.lk.RLock()
+	defer t.lk.RUnlock()
+
+	var running []client.RunStatus
+	for _, tr := range t.runs {
+		if st := tr.Status(); st.State == client.RunStateRunning {
+			running = append(running, st)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].Started.Before(running[j].Started)
+	})
+
+	res := running
+	for _, tr := range t.queue {
+		res = append(res, tr.Status())
+	}
+	return res
+}
+
+func (tr *trackedRun) priority() int {
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	return tr.status.Priority
+}
+
+func (tr *trackedRun) setPosition(pos int) {
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	tr.status.Position = pos
+}
+
+// Write records unstructured progress output of the run.
+func (tr *trackedRun) Write(p []byte) (n int, err error) {
+	// the caller may reuse p, so we need to copy it.
+	cp := make([]byte, len(p))
+	copy(cp, p)
+	tr.record(tgwriter.Msg{Type: "progress", Payload: cp})
+	return len(p), nil
+}
+
+// WriteEvent records a structured event of the run.
+func (tr *trackedRun) WriteEvent(evt *api.Event) error {
+	if evt.Type == api.EventTypeTeardown && evt.Teardown != nil {
+		tr.lk.Lock()
+		tr.status.Removed = append(tr.status.Removed, evt.Teardown.Removed...)
+		tr.lk.Unlock()
+	}
+	tr.record(tgwriter.Msg{Type: "event", Event: evt})
+	return nil
+}
+
+func (tr *trackedRun) record(msg tgwriter.Msg) {
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	tr.msgs = append(tr.msgs, msg)
+	tr.cond.Broadcast()
+}
+
+func (tr *trackedRun) finish(out *api.RunOutput, err error) {
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	tr.out, tr.err = out, err
+	tr.status.Position = 0
+	tr.status.Ended = time.Now()
+	if out != nil {
+		tr.status.Groups = out.Groups
+	}
+
+	switch {
+	case err == nil:
+		tr.status.State = client.RunStateSucceeded
+	case errors.Is(err, context.Canceled):
+		tr.status.State = client.RunStateCanceled
+		tr.status.Error = err.Error()
+	default:
+		tr.status.State = client.RunStateFailed
+		tr.status.Error = err.Error()
+	}
+
+	logging.S().Infow("tracked run finished", "run_id", tr.id, "state", tr.status.State)
+
+	tr.stopped = true
+	close(tr.doneCh)
+	tr.cond.Broadcast()
+}
+
+// Status returns a snapshot of the status of this run.
+func (tr *trackedRun) Status() client.RunStatus {
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	return tr.status
+}
+
+// Result returns the output and error of the run. It must only be called
+// after the run has finished.
+func (tr *trackedRun) Result() (*api.RunOutput, error) {
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	return tr.out, tr.err
+}
+
+// Done returns a channel that is closed when the run finishes.
+func (tr *trackedRun) Done() <-chan struct{} {
+	return tr.doneCh
+}
+
+// Replay writes the recorded output of the run to tgw, starting at the
+// beginning. If follow is true, it keeps writing output as it's produced,
+// until the run finishes or ctx is done.
+func (tr *trackedRun) Replay(ctx context.Context, tgw *tgwriter.TgWriter, follow bool) error {
+	// wake up the waiter below if the context fires.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			tr.lk.Lock()
+			tr.cond.Broadcast()
+			tr.lk.Unlock()
+		case <-stop:
+		}
+	}()
+
+	for next := 0; ; {
+		tr.lk.Lock()
+		for follow && next == len(tr.msgs) && !tr.stopped && ctx.Err() == nil {
+			tr.cond.Wait()
+		}
+		pending := tr.msgs[next:]
+		stopped := tr.stopped
+		tr.lk.Unlock()
+
+		for i := range pending {
+			if err := tgw.WriteMsg(&pending[i]); err != nil {
+				return err
+			}
+		}
+		next += len(pending)
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !follow || (stopped && len(pending) == 0) {
+			return nil
+		}
+	}
+}
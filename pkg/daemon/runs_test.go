@@ -0,0 +1,225 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/client"
+	"github.com/ipfs/testground/pkg/config"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+// blockingEngine is an api.Engine whose runs print a line and block until
+// they're canceled or released.
+type blockingEngine struct {
+	api.Engine
+
+	envcfg  config.EnvConfig
+	release chan struct{}
+}
+
+func (e *blockingEngine) Context() context.Context {
+	return context.Background()
+}
+
+func (e *blockingEngine) EnvConfig() config.EnvConfig {
+	return e.envcfg
+}
+
+func (e *blockingEngine) TestCensus() api.TestCensus {
+	return emptyCensus{}
+}
+
+type emptyCensus struct {
+	api.TestCensus
+}
+
+func (emptyCensus) PlanByName(string) *api.TestPlanDefinition {
+	return nil
+}
+
+func (e *blockingEngine) DoRun(ctx context.Context, runID string, comp *api.Composition, output io.Writer) (*api.RunOutput, error) {
+	_, _ = output.Write([]byte("hello from " + runID + "\n"))
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-e.release:
+		return &api.RunOutput{RunID: runID}, nil
+	}
+}
+
+func TestTrackedRunCompletes(t *testing.T) {
+	e := &blockingEngine{release: make(chan struct{})}
+	runs := newRunTracker(e)
+
+	tr, err := runs.submit(&api.Composition{}, 0, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := runs.get(tr.id); err != nil || got != tr {
+		t.Fatalf("expected to find run %s: %v", tr.id, err)
+	}
+
+	if st := tr.Status(); st.State != client.RunStateRunning {
+		t.Fatalf("expected run to be running, was: %s", st.State)
+	}
+
+	close(e.release)
+
+	// following the logs must return once the run is done.
+	rec := httptest.NewRecorder()
+	tgw := tgwriter.New(rec, httptest.NewRequest("GET", "/", nil), logging.S())
+	if err := tr.Replay(context.Background(), tgw, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg tgwriter.Msg
+	if err := json.NewDecoder(strings.NewReader(rec.Body.String())).Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "progress" {
+		t.Fatalf("expected a progress message, got: %s", msg.Type)
+	}
+
+	if st := tr.Status(); st.State != client.RunStateSucceeded || st.Ended.IsZero() {
+		t.Fatalf("expected run to have succeeded, was: %+v", st)
+	}
+}
+
+func TestTrackedRunCancel(t *testing.T) {
+	e := &blockingEngine{release: make(chan struct{})}
+	runs := newRunTracker(e)
+
+	tr, err := runs.submit(&api.Composition{}, 0, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs.cancel(tr)
+
+	select {
+	case <-tr.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not finish after cancellation")
+	}
+
+	if st := tr.Status(); st.State != client.RunStateCanceled {
+		t.Fatalf("expected run to be canceled, was: %s", st.State)
+	}
+
+	if _, err := runs.get("unknown"); err == nil {
+		t.Fatal("expected an error for an unknown run")
+	}
+}
+
+func testComposition(runner string, instances uint) *api.Composition {
+	return &api.Composition{
+		Global: api.Global{
+			Runner:         runner,
+			TotalInstances: instances,
+		},
+	}
+}
+
+func TestQueueAdmission(t *testing.T) {
+	e := &blockingEngine{release: make(chan struct{})}
+	e.envcfg.Daemon.Scheduler.Runners = map[string]config.RunnerLimits{
+		"local:docker": {MaxConcurrentRuns: 2, MaxInstances: 10},
+	}
+	runs := newRunTracker(e)
+	defer close(e.release)
+
+	if _, err := runs.submit(testComposition("local:docker", 11), 0, "test"); err == nil {
+		t.Fatal("expected a run exceeding the runner capacity to be rejected")
+	}
+
+	a, _ := runs.submit(testComposition("local:docker", 6), 0, "test")
+	b, _ := runs.submit(testComposition("local:docker", 6), 0, "test") // exceeds capacity while a runs.
+	c, _ := runs.submit(testComposition("local:docker", 2), 0, "test") // fits, but must wait behind b.
+	d, _ := runs.submit(testComposition("local:exec", 100), 0, "test") // unlimited runner.
+
+	states := func() []client.RunState {
+		return []client.RunState{a.Status().State, b.Status().State, c.Status().State, d.Status().State}
+	}
+	expect := []client.RunState{client.RunStateRunning, client.RunStateQueued, client.RunStateQueued, client.RunStateRunning}
+	for i, s := range states() {
+		if s != expect[i] {
+			t.Fatalf("unexpected states: %v", states())
+		}
+	}
+
+	if err := runs.setPriority(c, 10); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.Status(); st.State != client.RunStateRunning {
+		t.Fatalf("expected prioritized run to be admitted, was: %s", st.State)
+	}
+	if st := b.Status(); st.State != client.RunStateQueued || st.Position != 1 {
+		t.Fatalf("expected run to be first in the queue, was: %+v", st)
+	}
+
+	if err := runs.setPriority(a, 1); err == nil {
+		t.Fatal("expected an error when changing the priority of a running run")
+	}
+
+	runs.cancel(b)
+	<-b.Done()
+	if st := b.Status(); st.State != client.RunStateCanceled {
+		t.Fatalf("expected queued run to be canceled, was: %s", st.State)
+	}
+
+	if l := runs.list(); len(l) != 3 {
+		t.Fatalf("expected 3 active runs, got: %d", len(l))
+	}
+}
+
+func TestFinishedRunsEvicted(t *testing.T) {
+	e := &blockingEngine{release: make(chan struct{})}
+	e.envcfg.Daemon.Scheduler.RetainRuns = 2
+	runs := newRunTracker(e)
+	close(e.release)
+
+	// runs are retired right after they finish; wait for that to happen, so
+	// they're retired in submission order.
+	retired := func(tr *trackedRun) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			runs.lk.RLock()
+			done := len(runs.finished) > 0 && runs.finished[len(runs.finished)-1] == tr
+			runs.lk.RUnlock()
+			if done {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected run %s to be retired", tr.id)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		tr, err := runs.submit(&api.Composition{}, 0, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-tr.Done()
+		retired(tr)
+		ids = append(ids, tr.id)
+	}
+
+	if _, err := runs.get(ids[0]); err == nil {
+		t.Fatal("expected the oldest finished run to be evicted")
+	}
+	for _, id := range ids[1:] {
+		if _, err := runs.get(id); err != nil {
+			t.Fatalf("expected run %s to be retained: %v", id, err)
+		}
+	}
+}
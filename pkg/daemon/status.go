@@ -0,0 +1,30 @@
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/pkg/tgwriter"
+)
+
+func (srv *Daemon) runStatusHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("ruid", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "status")
+		defer log.Debugw("request handled", "command", "status")
+
+		tgw := tgwriter.New(w, r, log)
+
+		tr, err := srv.runs.get(mux.Vars(r)["id"])
+		if err != nil {
+			tgw.WriteError(err.Error())
+			return
+		}
+
+		tgw.WriteResult(tr.Status())
+	}
+}
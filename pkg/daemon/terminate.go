@@ -17,7 +17,7 @@ func (srv *Daemon) terminateHandler(engine api.Engine) func(w http.ResponseWrite
 		log.Debugw("handle request", "command", "terminate")
 		defer log.Debugw("request handled", "command", "terminate")
 
-		tgw := tgwriter.New(w, log)
+		tgw := tgwriter.New(w, r, log)
 
 		var req client.TerminateRequest
 		err := json.NewDecoder(r.Body).Decode(&req)
@@ -27,6 +27,8 @@ func (srv *Daemon) terminateHandler(engine api.Engine) func(w http.ResponseWrite
 			return
 		}
 
+		srv.audit.record(r, "terminate", "runner", req.Runner)
+
 		err = engine.DoTerminate(r.Context(), req.Runner, tgw)
 		if err != nil {
 			tgw.WriteError("terminate error", "err", err.Error())
@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/aws"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+)
+
+// PushToAWSRegistry tags the image produced by a build under the AWS ECR
+// repository of the test plan, and pushes it. On success, the artifact path of
+// the build output is replaced by the pushed tag.
+func PushToAWSRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
+	// Get a Docker registry authentication token from AWS ECR.
+	auth, err := aws.ECR.GetAuthToken(in.EnvConfig.AWS)
+	if err != nil {
+		return err
+	}
+
+	// AWS ECR repository name is testground-<region>-<plan_name>.
+	repo := fmt.Sprintf("testground-%s-%s", in.EnvConfig.AWS.Region, in.TestPlan.Name)
+
+	// Ensure the repo exists, or create it. Get the full URI to the repo, so we
+	// can tag images.
+	uri, err := aws.ECR.EnsureRepository(in.EnvConfig.AWS, repo)
+	if err != nil {
+		return err
+	}
+
+	// Tag the image under the AWS ECR repository.
+	tag := uri + ":" + in.BuildID
+	log.Infow("tagging image", "tag", tag)
+	if err = client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
+		return err
+	}
+
+	// TODO for some reason, this push is way slower than the equivalent via the
+	// docker CLI. Needs investigation.
+	log.Infow("pushing image", "tag", tag)
+	rc, err := client.ImagePush(ctx, tag, types.ImagePushOptions{
+		RegistryAuth: aws.ECR.EncodeAuthToken(auth),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pipe the docker output to stdout.
+	if err := PipeOutput(rc, os.Stdout); err != nil {
+		return err
+	}
+
+	// replace the artifact path by the pushed image.
+	out.ArtifactPath = tag
+	return nil
+}
+
+// PushToDockerHubRegistry tags the image produced by a build under the
+// configured Docker Hub repository, and pushes it. On success, the artifact
+// path of the build output is replaced by the pushed tag.
+func PushToDockerHubRegistry(ctx context.Context, log *zap.SugaredLogger, client *client.Client, in *api.BuildInput, out *api.BuildOutput) error {
+	uri := in.EnvConfig.DockerHub.Repo + "/testground"
+
+	tag := uri + ":" + in.BuildID
+	log.Infow("tagging image", "source", out.ArtifactPath, "repo", uri, "tag", tag)
+
+	if err := client.ImageTag(ctx, out.ArtifactPath, tag); err != nil {
+		return err
+	}
+
+	auth := types.AuthConfig{
+		Username: in.EnvConfig.DockerHub.Username,
+		Password: in.EnvConfig.DockerHub.AccessToken,
+	}
+	authBytes, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+	authBase64 := base64.URLEncoding.EncodeToString(authBytes)
+
+	rc, err := client.ImagePush(ctx, uri, types.ImagePushOptions{
+		RegistryAuth: authBase64,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infow("pushed image", "source", out.ArtifactPath, "tag", tag, "repo", uri)
+
+	// Pipe the docker output to stdout.
+	if err := PipeOutput(rc, os.Stdout); err != nil {
+		return err
+	}
+
+	// replace the artifact path by the pushed image.
+	out.ArtifactPath = tag
+	return nil
+}
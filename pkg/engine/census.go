@@ -2,6 +2,7 @@ package engine
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"sync"
 
@@ -38,6 +39,21 @@ func (c *TestCensus) EnrollTestPlan(tp *api.TestPlanDefinition) error {
 	return nil
 }
 
+// replaceImportedTestPlan registers this test plan in the census, replacing an
+// enrolled test plan with the same name only if it was imported too.
+func (c *TestCensus) replaceImportedTestPlan(tp *api.TestPlanDefinition) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if prev, ok := c.m[tp.Name]; ok && prev.Origin == nil {
+		return fmt.Errorf("test plan %s already exists, and was not imported", tp.Name)
+	}
+
+	tp.SourcePath = os.ExpandEnv(tp.SourcePath)
+	c.m[tp.Name] = tp
+	return nil
+}
+
 // ByName returns the test plan with the specified name, or nil if
 // inexistent.
 func (c *TestCensus) PlanByName(name string) *api.TestPlanDefinition {
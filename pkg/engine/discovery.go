@@ -5,25 +5,31 @@ import (
 	"path/filepath"
 
 	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
 	"github.com/ipfs/testground/pkg/logging"
-
-	"github.com/BurntSushi/toml"
 )
 
-// discoverTestPlans scans the manifest directory for test plans, enrolls them
-// all into the engine, and returns a slice of all hits.
+// discoverTestPlans scans the manifest directory and the directory of
+// imported test plans for test plans, enrolls them all into the engine, and
+// returns a slice of all hits.
 func (e *Engine) discoverTestPlans() ([]*api.TestPlanDefinition, error) {
-	glob := filepath.Join(e.envcfg.SrcDir, "/manifests/*.toml")
-	manifests, err := filepath.Glob(glob)
+	manifests, err := ManifestPaths(e.envcfg)
 	if err != nil {
 		return nil, err
 	}
 
 	defs := make([]*api.TestPlanDefinition, 0, len(manifests))
 	for _, m := range manifests {
-		def := new(api.TestPlanDefinition)
-		if _, err := toml.DecodeFile(m, def); err != nil {
-			logging.S().Errorf("failed to parse file %s: %s; skipping", m, err)
+		def, problems := lintManifest(m, e.builders, e.runners)
+		for _, p := range problems {
+			if p.Warning {
+				logging.S().Warnw("test plan manifest warning", "manifest", m, "field", p.Field, "warning", p.Message)
+			} else {
+				logging.S().Errorw("invalid test plan manifest", "manifest", m, "field", p.Field, "error", p.Message)
+			}
+		}
+		if HasManifestErrors(problems) {
+			logging.S().Errorf("test plan manifest %s is invalid; skipping (run `testground plan lint` for details)", m)
 			continue
 		}
 
@@ -36,3 +42,20 @@ func (e *Engine) discoverTestPlans() ([]*api.TestPlanDefinition, error) {
 
 	return defs, nil
 }
+
+// ManifestPaths returns the paths of the manifests of all test plans in the
+// manifest directory and the directory of imported test plans.
+func ManifestPaths(envcfg *config.EnvConfig) ([]string, error) {
+	glob := filepath.Join(envcfg.SrcDir, "/manifests/*.toml")
+	manifests, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, err
+	}
+
+	glob = filepath.Join(importedPlansDir(envcfg), "*", "manifest.toml")
+	imported, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, err
+	}
+	return append(manifests, imported...), nil
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/build/generic"
 	"github.com/ipfs/testground/pkg/build/golang"
 	"github.com/ipfs/testground/pkg/config"
 	"github.com/ipfs/testground/pkg/logging"
@@ -23,6 +25,7 @@ import (
 var AllBuilders = []api.Builder{
 	&golang.DockerGoBuilder{},
 	&golang.ExecGoBuilder{},
+	&generic.DockerGenericBuilder{},
 }
 
 // AllRunners enumerates all runners known to the system.
@@ -31,6 +34,7 @@ var AllRunners = []api.Runner{
 	&runner.LocalExecutableRunner{},
 	&runner.ClusterSwarmRunner{},
 	&runner.ClusterK8sRunner{},
+	&runner.ClusterNomadRunner{},
 }
 
 // Engine is the central runtime object of the system. It knows about all test
@@ -154,57 +158,84 @@ func (e *Engine) DoBuild(ctx context.Context, comp *api.Composition, output io.W
 		return nil, fmt.Errorf("invalid composition: %w", err)
 	}
 
-	var (
-		testplan = comp.Global.Plan
-		builder  = comp.Global.Builder
-	)
+	testplan := comp.Global.Plan
 
 	plan := e.TestCensus().PlanByName(testplan)
 	if plan == nil {
 		return nil, fmt.Errorf("unknown test plan: %s", testplan)
 	}
 
-	if builder == "" {
-		// TODO remove plan-specified runners and builders. Now that we have
-		// compositions, everything must be explicit.
-		builder = plan.Defaults.Builder
+	// Build a specific revision of an imported test plan, if requested.
+	if rev := comp.Global.PlanRevision; rev != "" {
+		pinned, err := pinPlanRevision(plan, rev)
+		if err != nil {
+			return nil, err
+		}
+		plan = pinned
 	}
 
-	// Find the builder.
-	bm, ok := e.builders[builder]
-	if !ok {
-		return nil, fmt.Errorf("unrecognized builder: %s", builder)
+	// Resolve the builder and its configuration for each group upfront, so
+	// that we fail before starting any build.
+	type groupBuild struct {
+		builder string
+		bm      api.Builder
+		cfg     interface{}
 	}
 
-	// This var compiles all configurations to coalesce.
-	//
-	// Precedence (highest to lowest):
-	//
-	//  1. CLI --run-param, --build-param flags.
-	//  2. .env.toml.
-	//  3. Test plan definition.
-	//  4. Builder defaults (applied by the builder itself, nothing to do here).
-	//
-	var cfg config.CoalescedConfig
+	builds := make([]groupBuild, len(comp.Groups))
+	for i, grp := range comp.Groups {
+		builder := grp.BuilderID(comp.Global)
+		if builder == "" {
+			// TODO remove plan-specified runners and builders. Now that we have
+			// compositions, everything must be explicit.
+			builder = plan.Defaults.Builder
+		}
 
-	// 3. Add the base configuration of the build strategy.
-	if c, ok := plan.BuildStrategies[builder]; !ok {
-		return nil, fmt.Errorf("test plan does not support builder: %s", builder)
-	} else {
-		cfg = cfg.Append(c)
-	}
+		// Find the builder.
+		bm, ok := e.builders[builder]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized builder for group %s: %s", grp.ID, builder)
+		}
 
-	// 2. Get the env config for the builder.
-	cfg = cfg.Append(e.envcfg.BuildStrategies[builder])
+		// This var compiles all configurations to coalesce.
+		//
+		// Precedence (highest to lowest):
+		//
+		//  1. Group build configuration.
+		//  2. CLI --build-cfg flags, or the global build configuration, if
+		//     this group uses the global builder.
+		//  3. .env.toml.
+		//  4. Test plan definition.
+		//  5. Builder defaults (applied by the builder itself, nothing to do here).
+		//
+		var cfg config.CoalescedConfig
+
+		// 4. Add the base configuration of the build strategy.
+		if c, ok := plan.BuildStrategies[builder]; !ok {
+			return nil, fmt.Errorf("test plan does not support builder: %s", builder)
+		} else {
+			cfg = cfg.Append(c)
+		}
 
-	// 1. Get overrides from the CLI.
-	cfg = cfg.Append(comp.Global.BuildConfig)
+		// 3. Get the env config for the builder.
+		cfg = cfg.Append(e.envcfg.BuildStrategies[builder])
 
-	// Coalesce all configurations and deserialise into the config type
-	// mandated by the builder.
-	obj, err := cfg.CoalesceIntoType(bm.ConfigType())
-	if err != nil {
-		return nil, fmt.Errorf("error while coalescing configuration values: %w", err)
+		// 2. Get overrides from the CLI, or the global configuration.
+		if builder == comp.Global.Builder {
+			cfg = cfg.Append(comp.Global.BuildConfig)
+		}
+
+		// 1. Get the group overrides.
+		cfg = cfg.Append(grp.Build.BuildConfig)
+
+		// Coalesce all configurations and deserialise into the config type
+		// mandated by the builder.
+		obj, err := cfg.CoalesceIntoType(bm.ConfigType())
+		if err != nil {
+			return nil, fmt.Errorf("error while coalescing configuration values for group %s: %w", grp.ID, err)
+		}
+
+		builds[i] = groupBuild{builder: builder, bm: bm, cfg: obj}
 	}
 
 	var (
@@ -223,27 +254,54 @@ func (e *Engine) DoBuild(ctx context.Context, comp *api.Composition, output io.W
 	// Trigger a build for each group, and wait until all of them are done.
 	for i, grp := range comp.Groups {
 		i, grp := i, grp // captures
+		builder, bm := builds[i].builder, builds[i].bm
 
 		errgrp.Go(func() (err error) {
 			logging.S().Infow("performing build for group", "plan", testplan, "group", grp.ID, "builder", builder)
 
+			buildID := uuid.New().String()[24:]
+			step := &api.BuildStepEvent{
+				BuildID: buildID,
+				GroupID: grp.ID,
+				Builder: builder,
+				Step:    "started",
+			}
+			api.WriteEvent(output, &api.Event{Type: api.EventTypeBuildStep, BuildStep: step})
+
 			in := &api.BuildInput{
-				BuildID:      uuid.New().String()[24:],
-				BuildConfig:  obj,
+				BuildID:      buildID,
+				BuildConfig:  builds[i].cfg,
 				EnvConfig:    *e.envcfg,
 				Directories:  e.envcfg,
 				TestPlan:     plan,
-				Dependencies: grp.Build.Dependencies.AsMap(),
+				Dependencies: grp.Build.Dependencies,
 			}
 
 			res, err := bm.Build(ctx, in, output)
 			if err != nil {
 				logging.S().Infow("build failed", "plan", testplan, "group", grp.ID, "builder", builder, "error", err)
+				step = &api.BuildStepEvent{
+					BuildID: buildID,
+					GroupID: grp.ID,
+					Builder: builder,
+					Step:    "failed",
+					Error:   err.Error(),
+				}
+				api.WriteEvent(output, &api.Event{Type: api.EventTypeBuildStep, BuildStep: step})
 				return err
 			}
 
 			res.BuilderID = bm.ID()
 			ress[i] = res
+
+			step = &api.BuildStepEvent{
+				BuildID:      buildID,
+				GroupID:      grp.ID,
+				Builder:      builder,
+				Step:         "succeeded",
+				ArtifactPath: res.ArtifactPath,
+			}
+			api.WriteEvent(output, &api.Event{Type: api.EventTypeBuildStep, BuildStep: step})
 			logging.S().Infow("build succeeded", "plan", testplan, "group", grp.ID, "builder", builder, "artifact", res.ArtifactPath)
 			return nil
 		})
@@ -257,7 +315,15 @@ func (e *Engine) DoBuild(ctx context.Context, comp *api.Composition, output io.W
 	return ress, nil
 }
 
-func (e *Engine) DoRun(ctx context.Context, comp *api.Composition, output io.Writer) (*api.RunOutput, error) {
+// NewRunID generates a new run ID.
+//
+// TODO generate the run id with a mononotically increasing counter; persist
+// the run ID in the state db.
+func NewRunID() string {
+	return uuid.New().String()[24:]
+}
+
+func (e *Engine) DoRun(ctx context.Context, runid string, comp *api.Composition, output io.Writer) (*api.RunOutput, error) {
 	if err := comp.ValidateForRun(); err != nil {
 		return nil, fmt.Errorf("invalid composition: %w", err)
 	}
@@ -265,7 +331,6 @@ func (e *Engine) DoRun(ctx context.Context, comp *api.Composition, output io.Wri
 	var (
 		testplan = comp.Global.Plan
 		testcase = comp.Global.Case
-		builder  = comp.Global.Builder
 		runner   = comp.Global.Runner
 	)
 
@@ -287,21 +352,23 @@ func (e *Engine) DoRun(ctx context.Context, comp *api.Composition, output io.Wri
 		runner = plan.Defaults.Runner
 	}
 
-	if builder == "" {
-		// TODO remove plan-specified runners and builders. Now that we have
-		// compositions, everything must be explicit.
-		runner = plan.Defaults.Builder
-	}
-
 	// Get the runner.
 	run, ok := e.runners[runner]
 	if !ok {
 		return nil, fmt.Errorf("unknown runner: %s", runner)
 	}
 
-	// Check if builder and runner are compatible
-	if !stringInSlice(comp.Global.Builder, run.CompatibleBuilders()) {
-		return nil, fmt.Errorf("runner %s is incompatible with builder %s", runner, builder)
+	// Check that the runner can work with the artifacts of every group.
+	for _, grp := range comp.Groups {
+		builder := grp.BuilderID(comp.Global)
+		if builder == "" {
+			// TODO remove plan-specified runners and builders. Now that we have
+			// compositions, everything must be explicit.
+			builder = plan.Defaults.Builder
+		}
+		if !stringInSlice(builder, run.CompatibleBuilders()) {
+			return nil, fmt.Errorf("runner %s is incompatible with builder %s of group %s", runner, builder, grp.ID)
+		}
 	}
 
 	// Validate the desired number of instances is within bounds.
@@ -311,36 +378,46 @@ func (e *Engine) DoRun(ctx context.Context, comp *api.Composition, output io.Wri
 		return nil, err
 	}
 
-	// TODO generate the run id with a mononotically increasing counter; persist
-	// the run ID in the state db.
-	//
 	// This Run ID is shared by all groups in the composition.
-	runid := uuid.New().String()[24:]
+	if runid == "" {
+		runid = NewRunID()
+	}
 
 	// This var compiles all configurations to coalesce.
 	//
 	// Precedence (highest to lowest):
 	//
-	//  1. CLI --run-param, --build-param flags.
-	//  2. .env.toml.
-	//  3. Test plan definition.
-	//  4. Builder defaults (applied by the builder itself, nothing to do here).
+	//  1. Group run configuration (group-scoped keys only).
+	//  2. CLI --run-param, --build-param flags.
+	//  3. .env.toml.
+	//  4. Test plan definition.
+	//  5. Builder defaults (applied by the builder itself, nothing to do here).
 	//
 	var cfg config.CoalescedConfig
 
-	// Add the base configuration of the run strategy (point 3 above).
+	// Add the base configuration of the run strategy (point 4 above).
 	if c, ok := plan.RunStrategies[runner]; !ok {
-		return nil, fmt.Errorf("test plan does not support builder: %s", builder)
+		return nil, fmt.Errorf("test plan does not support runner: %s", runner)
 	} else {
 		cfg = cfg.Append(c)
 	}
 
-	// 2. Get the env config for the runner.
+	// 3. Get the env config for the runner.
 	cfg = cfg.Append(e.envcfg.RunStrategies[runner])
 
-	// 1. Get overrides from the CLI.
+	// 2. Get overrides from the CLI.
 	cfg = cfg.Append(comp.Global.RunConfig)
 
+	// 1. Groups can only override the keys that the runner applies per group.
+	scoped := api.EnumerateGroupScopedFields(run.ConfigType())
+	for _, grp := range comp.Groups {
+		for k := range grp.Run.RunConfig {
+			if !stringInSlice(k, scoped) {
+				return nil, fmt.Errorf("run_config key %s of group %s is not group-scoped for runner %s; group-scoped keys: %v", k, grp.ID, runner, scoped)
+			}
+		}
+	}
+
 	// Coalesce all configurations and deserialise into the config type
 	// mandated by the runner.
 	obj, err := cfg.CoalesceIntoType(run.ConfigType())
@@ -380,28 +457,98 @@ func (e *Engine) DoRun(ctx context.Context, comp *api.Composition, output io.Wri
 			params[k] = v
 		}
 
+		gobj := obj
+		if len(grp.Run.RunConfig) > 0 {
+			gobj, err = cfg.Append(grp.Run.RunConfig).CoalesceIntoType(run.ConfigType())
+			if err != nil {
+				return nil, fmt.Errorf("error while coalescing configuration values of group %s: %w", grp.ID, err)
+			}
+		}
+
 		g := api.RunGroup{
 			ID:           grp.ID,
 			Instances:    int(grp.CalculatedInstanceCount()),
 			ArtifactPath: grp.Run.Artifact,
 			Parameters:   params,
+			RunnerConfig: gobj,
+			Churn:        grp.Run.Churn,
+		}
+
+		if g.Churn != nil {
+			if _, ok := run.(api.Churner); !ok {
+				return nil, fmt.Errorf("group %s has churn, but runner %s doesn't support it", grp.ID, runner)
+			}
 		}
 
 		in.Groups = append(in.Groups, g)
 	}
 
 	out, err := run.Run(ctx, &in, output)
+
+	// If the run was canceled, make sure the runner leaves nothing behind.
+	if ctx.Err() != nil {
+		if err == nil {
+			err = ctx.Err()
+		}
+		e.teardownRun(run, &in, output)
+	}
+
+	complete := &api.RunCompleteEvent{
+		RunID:     runid,
+		Runner:    runner,
+		Instances: in.TotalInstances,
+	}
 	if err == nil {
 		logging.S().Infow("run finished successfully", "plan", testplan, "case", testcase, "runner", runner, "instances", in.TotalInstances)
-	} else if errors.Is(err, context.Canceled) {
+		complete.Outcome = "ok"
+	} else if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
 		logging.S().Infow("run canceled", "plan", testplan, "case", testcase, "runner", runner, "instances", in.TotalInstances)
+		complete.Outcome, complete.Error = "canceled", err.Error()
 	} else {
 		logging.S().Warnw("run finished in error", "plan", testplan, "case", testcase, "runner", runner, "instances", in.TotalInstances, "error", err)
+		complete.Outcome, complete.Error = "failed", err.Error()
 	}
+	api.WriteEvent(output, &api.Event{Type: api.EventTypeRunComplete, RunComplete: complete})
 
 	return out, err
 }
 
+// teardownRun removes all resources of a canceled run, if the runner supports
+// it, and reports them through an event.
+func (e *Engine) teardownRun(run api.Runner, in *api.RunInput, output io.Writer) {
+	teardownable, ok := run.(api.Teardownable)
+	if !ok {
+		logging.S().Warnw("runner does not support tearing down runs; resources may be left behind", "runner", run.ID(), "run_id", in.RunID)
+		return
+	}
+
+	// the run context is done; use a fresh one, bounded so that an unreachable
+	// backend doesn't block the run forever.
+	ctx, cancel := context.WithTimeout(e.ctx, 2*time.Minute)
+	defer cancel()
+
+	logging.S().Infow("tearing down run", "runner", run.ID(), "run_id", in.RunID)
+
+	out, err := teardownable.TeardownRun(ctx, &api.TeardownInput{
+		EnvConfig:    in.EnvConfig,
+		RunID:        in.RunID,
+		RunnerConfig: in.RunnerConfig,
+	})
+
+	evt := &api.TeardownEvent{RunID: in.RunID, Runner: run.ID()}
+	if out != nil {
+		evt.Removed = out.Removed
+	}
+	if err != nil {
+		logging.S().Errorw("failed to tear down run", "runner", run.ID(), "run_id", in.RunID, "err", err)
+		evt.Error = err.Error()
+	} else {
+		logging.S().Infow("run torn down", "runner", run.ID(), "run_id", in.RunID, "removed", len(evt.Removed))
+	}
+
+	api.WriteEvent(output, &api.Event{Type: api.EventTypeTeardown, Teardown: evt})
+}
+
 func (e *Engine) DoCollectOutputs(ctx context.Context, runner string, runID string, w io.Writer) error {
 	run, ok := e.runners[runner]
 	if !ok {
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
+)
+
+type fakeBuilderConfig struct {
+	Flavour string `toml:"flavour"`
+	Size    string `toml:"size"`
+}
+
+// fakeBuilder is an api.Builder whose artifacts identify the builder and the
+// configuration they were built with.
+type fakeBuilder struct {
+	id string
+}
+
+func (b *fakeBuilder) ID() string {
+	return b.id
+}
+
+func (b *fakeBuilder) ConfigType() reflect.Type {
+	return reflect.TypeOf(fakeBuilderConfig{})
+}
+
+func (b *fakeBuilder) Build(_ context.Context, in *api.BuildInput, _ io.Writer) (*api.BuildOutput, error) {
+	cfg := in.BuildConfig.(*fakeBuilderConfig)
+	return &api.BuildOutput{ArtifactPath: fmt.Sprintf("%s/%s/%s", b.id, cfg.Flavour, cfg.Size)}, nil
+}
+
+func newMixedBuildEngine(t *testing.T) *Engine {
+	t.Helper()
+
+	envcfg := &config.EnvConfig{
+		BuildStrategies: map[string]config.ConfigMap{
+			"fake:b": {"size": "m"},
+		},
+	}
+	e, err := NewEngine(&EngineConfig{
+		Builders:  []api.Builder{&fakeBuilder{id: "fake:a"}, &fakeBuilder{id: "fake:b"}, &fakeBuilder{id: "fake:c"}},
+		EnvConfig: envcfg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := &api.TestPlanDefinition{
+		Name: "mixed",
+		BuildStrategies: map[string]config.ConfigMap{
+			"fake:a": {"flavour": "plan-a", "size": "s"},
+			"fake:b": {"flavour": "plan-b", "size": "s"},
+		},
+	}
+	if err := e.census.EnrollTestPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestDoBuildMixedBuilders(t *testing.T) {
+	e := newMixedBuildEngine(t)
+
+	comp := &api.Composition{
+		Global: api.Global{
+			Plan:        "mixed",
+			Builder:     "fake:a",
+			BuildConfig: map[string]interface{}{"flavour": "global", "size": "xl"},
+		},
+		Groups: []api.Group{
+			// uses the global builder and configuration.
+			{ID: "default"},
+			// uses its own builder; the global configuration doesn't apply.
+			{ID: "other", Build: api.Build{
+				Builder:     "fake:b",
+				BuildConfig: map[string]interface{}{"flavour": "group"},
+			}},
+			// uses the global builder, and overrides part of its configuration.
+			{ID: "override", Build: api.Build{
+				Builder:     "fake:a",
+				BuildConfig: map[string]interface{}{"size": "xs"},
+			}},
+		},
+	}
+
+	if id := comp.Groups[0].BuilderID(comp.Global); id != "fake:a" {
+		t.Fatalf("expected group to use the global builder, got: %s", id)
+	}
+	if id := comp.Groups[1].BuilderID(comp.Global); id != "fake:b" {
+		t.Fatalf("expected group to use its own builder, got: %s", id)
+	}
+
+	outs, err := e.DoBuild(context.Background(), comp, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ builder, artifact string }{
+		{"fake:a", "fake:a/global/xl"},
+		{"fake:b", "fake:b/group/m"},
+		{"fake:a", "fake:a/global/xs"},
+	}
+	if len(outs) != len(expected) {
+		t.Fatalf("expected %d build outputs, got: %d", len(expected), len(outs))
+	}
+	for i, exp := range expected {
+		if outs[i].BuilderID != exp.builder || outs[i].ArtifactPath != exp.artifact {
+			t.Errorf("group %s: expected %s built by %s, got %s built by %s",
+				comp.Groups[i].ID, exp.artifact, exp.builder, outs[i].ArtifactPath, outs[i].BuilderID)
+		}
+	}
+}
+
+func TestDoBuildInvalidBuilders(t *testing.T) {
+	e := newMixedBuildEngine(t)
+
+	cases := []struct {
+		name   string
+		global string
+		group  string
+	}{
+		{"no builder", "", ""},
+		{"unknown builder", "fake:a", "fake:unknown"},
+		{"builder unsupported by the plan", "fake:a", "fake:c"},
+	}
+
+	for _, c := range cases {
+		comp := &api.Composition{
+			Global: api.Global{Plan: "mixed", Builder: c.global},
+			Groups: []api.Group{
+				{ID: "a", Build: api.Build{Builder: "fake:a"}},
+				{ID: "b", Build: api.Build{Builder: c.group}},
+			},
+		}
+		if _, err := e.DoBuild(context.Background(), comp, ioutil.Discard); err == nil {
+			t.Errorf("%s: expected the build to fail", c.name)
+		}
+	}
+}
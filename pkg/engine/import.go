@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
+	"github.com/ipfs/testground/pkg/logging"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/go-getter"
+)
+
+// importedPlansDir is the directory where imported test plans are stored. Each
+// test plan has a directory named after it, containing the manifest and a src
+// directory with the source.
+func importedPlansDir(envcfg *config.EnvConfig) string {
+	return filepath.Join(envcfg.WorkDir(), "plans")
+}
+
+// DoImportPlan fetches a test plan from src, a go-getter URL pointing to a git
+// repository, an archive, or a directory, whose root contains a manifest.toml
+// file. Subdirectories can be selected with the go-getter `//` syntax, e.g.
+// github.com/org/repo//plans/myplan.
+//
+// If ref is set, src must be a git repository, and ref is the branch, tag or
+// commit to check out. If name is set, it overrides the name of the test plan
+// declared in the manifest.
+func (e *Engine) DoImportPlan(ctx context.Context, src string, ref string, name string, w io.Writer) (*api.TestPlanDefinition, error) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	// Detect the kind of source, so we know whether it's a git repository.
+	detected, err := getter.Detect(src, pwd, getter.Detectors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid test plan source %s: %w", src, err)
+	}
+
+	var (
+		git    = strings.HasPrefix(detected, "git::")
+		fetch  = detected
+		subdir string
+	)
+	switch {
+	case git:
+		// Fetch the whole repository, so that we can resolve the revision
+		// that was checked out.
+		fetch, subdir = getter.SourceDirSubdir(detected)
+		if fetch, err = withGitRef(fetch, ref); err != nil {
+			return nil, err
+		}
+	case ref != "":
+		return nil, fmt.Errorf("a ref can only be specified for git sources; source: %s", detected)
+	}
+
+	basedir := importedPlansDir(e.envcfg)
+	if err := os.MkdirAll(basedir, 0777); err != nil {
+		return nil, err
+	}
+
+	// Fetch into a temp dir first, so that a failed import doesn't clobber a
+	// previous one.
+	tmp, err := ioutil.TempDir(basedir, ".import-")
+	if err != nil {
+		return nil, fmt.Errorf("failed while creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fmt.Fprintf(w, "fetching test plan from %s\n", fetch)
+
+	// Local directories are copied instead of symlinked, so that the import
+	// is a snapshot of the source.
+	getters := make(map[string]getter.Getter, len(getter.Getters))
+	for k, g := range getter.Getters {
+		getters[k] = g
+	}
+	getters["file"] = &getter.FileGetter{Copy: true}
+
+	srcdir := filepath.Join(tmp, "src")
+	client := &getter.Client{
+		Ctx:     ctx,
+		Src:     fetch,
+		Dst:     srcdir,
+		Pwd:     pwd,
+		Mode:    getter.ClientModeDir,
+		Getters: getters,
+	}
+	if err := client.Get(); err != nil {
+		if ref != "" {
+			return nil, fmt.Errorf("failed to fetch revision %s of test plan; does it exist? %w", ref, err)
+		}
+		return nil, fmt.Errorf("failed to fetch test plan: %w", err)
+	}
+
+	def, problems := lintManifest(filepath.Join(srcdir, subdir, "manifest.toml"), e.builders, e.runners)
+	for _, p := range problems {
+		if p.Warning {
+			fmt.Fprintf(w, "manifest warning: %s\n", p)
+		}
+	}
+	if HasManifestErrors(problems) {
+		var msgs []string
+		for _, p := range problems {
+			if !p.Warning {
+				msgs = append(msgs, p.Error())
+			}
+		}
+		return nil, fmt.Errorf("invalid test plan manifest: %s", strings.Join(msgs, "; "))
+	}
+
+	if name != "" {
+		def.Name = name
+	}
+	if def.Name == "" || strings.ContainsAny(def.Name, `/\`) || strings.HasPrefix(def.Name, ".") {
+		return nil, fmt.Errorf("invalid test plan name: %q", def.Name)
+	}
+
+	def.Origin = &api.PlanOrigin{
+		URL:        detected,
+		Ref:        ref,
+		ImportedAt: time.Now().UTC(),
+	}
+
+	if git {
+		rev, err := gitRevision(ctx, srcdir)
+		if err != nil {
+			return nil, err
+		}
+		def.Origin.Revision = rev
+	}
+
+	// Move the source to its final location, and write the manifest, pointing
+	// to the source.
+	dst := filepath.Join(basedir, def.Name)
+	def.SourcePath = "file://" + filepath.Join(dst, "src", subdir)
+
+	f, err := os.Create(filepath.Join(tmp, "manifest.toml"))
+	if err != nil {
+		return nil, err
+	}
+	err = toml.NewEncoder(f).Encode(def)
+	_ = f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write the manifest of the test plan: %w", err)
+	}
+
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	if prev := e.census.PlanByName(def.Name); prev != nil && prev.Origin == nil {
+		return nil, fmt.Errorf("test plan %s already exists, and was not imported", def.Name)
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return nil, fmt.Errorf("failed to remove the previous import: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return nil, err
+	}
+
+	if err := e.census.replaceImportedTestPlan(def); err != nil {
+		return nil, err
+	}
+
+	logging.S().Infow("imported test plan", "name", def.Name, "url", def.Origin.URL, "ref", ref, "revision", def.Origin.Revision)
+	fmt.Fprintf(w, "imported test plan %s at revision %q\n", def.Name, def.Origin.Revision)
+
+	return def, nil
+}
+
+// pinPlanRevision returns a copy of the test plan definition whose source
+// points to the given revision of the git repository it was imported from.
+func pinPlanRevision(plan *api.TestPlanDefinition, revision string) (*api.TestPlanDefinition, error) {
+	switch {
+	case plan.Origin == nil:
+		return nil, fmt.Errorf("test plan %s was not imported; only imported test plans can be pinned to a revision", plan.Name)
+	case !strings.HasPrefix(plan.Origin.URL, "git::"):
+		return nil, fmt.Errorf("test plan %s was not imported from a git repository; it can't be pinned to a revision", plan.Name)
+	}
+
+	src, err := withGitRef(plan.Origin.URL, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := *plan
+	pinned.SourcePath = src
+	return &pinned, nil
+}
+
+// withGitRef sets the ref parameter of a go-getter git URL, preserving the
+// subdirectory selected with `//`, if any.
+func withGitRef(src, ref string) (string, error) {
+	src, subdir := getter.SourceDirSubdir(strings.TrimPrefix(src, "git::"))
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("invalid git URL %s: %w", src, err)
+	}
+
+	q := u.Query()
+	if ref == "" {
+		q.Del("ref")
+	} else {
+		q.Set("ref", ref)
+	}
+	u.RawQuery = ""
+
+	res := "git::" + u.String()
+	if subdir != "" {
+		res += "//" + subdir
+	}
+	if len(q) > 0 {
+		res += "?" + q.Encode()
+	}
+	return res, nil
+}
+
+// gitRevision returns the commit checked out in a git repository.
+func gitRevision(ctx context.Context, dir string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the git revision of the test plan: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
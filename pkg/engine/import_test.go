@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
+
+	"github.com/hashicorp/go-getter"
+)
+
+const importManifest = `
+name = "imported"
+source_path = "file:///unused"
+
+[defaults]
+builder = "exec:go"
+runner = "local:exec"
+
+[build_strategies."exec:go"]
+enabled = true
+
+[run_strategies."local:exec"]
+enabled = true
+
+[[testcases]]
+name = "ping"
+instances = { min = 1, max = 10, default = 1 }
+`
+
+func TestWithGitRef(t *testing.T) {
+	cases := []struct {
+		src, ref, expected string
+	}{
+		{"git::https://example.com/repo.git", "v1.0.0", "git::https://example.com/repo.git?ref=v1.0.0"},
+		{"git::https://example.com/repo.git?ref=main", "v1.0.0", "git::https://example.com/repo.git?ref=v1.0.0"},
+		{"git::https://example.com/repo.git?ref=main", "", "git::https://example.com/repo.git"},
+		{"git::https://example.com/repo.git//plans/ping", "abc123", "git::https://example.com/repo.git//plans/ping?ref=abc123"},
+		{"git::https://example.com/repo.git//plans/ping?depth=1", "abc123", "git::https://example.com/repo.git//plans/ping?depth=1&ref=abc123"},
+	}
+
+	for _, c := range cases {
+		got, err := withGitRef(c.src, c.ref)
+		if err != nil {
+			t.Errorf("withGitRef(%q, %q): %s", c.src, c.ref, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("withGitRef(%q, %q) = %q; expected %q", c.src, c.ref, got, c.expected)
+		}
+	}
+}
+
+func TestPinPlanRevision(t *testing.T) {
+	plan := &api.TestPlanDefinition{
+		Name:       "imported",
+		SourcePath: "file:///plans/imported/src/plans/ping",
+		Origin:     &api.PlanOrigin{URL: "git::https://example.com/repo.git//plans/ping?ref=main", Revision: "abc"},
+	}
+
+	pinned, err := pinPlanRevision(plan, "def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "git::https://example.com/repo.git//plans/ping?ref=def"; pinned.SourcePath != expected {
+		t.Fatalf("expected source %s, got: %s", expected, pinned.SourcePath)
+	}
+	if plan.SourcePath != "file:///plans/imported/src/plans/ping" {
+		t.Fatal("expected the enrolled test plan to be left untouched")
+	}
+
+	if _, err := pinPlanRevision(&api.TestPlanDefinition{Name: "local"}, "def"); err == nil {
+		t.Fatal("expected an error pinning a test plan that was not imported")
+	}
+
+	archive := &api.TestPlanDefinition{Name: "archive", Origin: &api.PlanOrigin{URL: "https://example.com/plan.tar.gz"}}
+	if _, err := pinPlanRevision(archive, "def"); err == nil {
+		t.Fatal("expected an error pinning a test plan not imported from git")
+	}
+}
+
+// git runs a git command in dir, and returns its trimmed output.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Skipf("git unavailable: %s: %s", err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestDoImportPlan(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// a repository with the test plan in a subdirectory, at two revisions.
+	repo := filepath.Join(tmp, "repo")
+	plandir := filepath.Join(repo, "plans", "ping")
+	if err := os.MkdirAll(plandir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(plandir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("manifest.toml", importManifest)
+	write("main.go", "package main // v1\n")
+	git(t, repo, "init", "-q")
+	git(t, repo, "add", ".")
+	git(t, repo, "commit", "-q", "-m", "v1")
+	git(t, repo, "tag", "v1")
+	v1 := git(t, repo, "rev-parse", "HEAD")
+
+	write("main.go", "package main // v2\n")
+	git(t, repo, "commit", "-q", "-am", "v2")
+	v2 := git(t, repo, "rev-parse", "HEAD")
+
+	e, err := NewEngine(&EngineConfig{
+		Builders:  AllBuilders,
+		Runners:   AllRunners,
+		EnvConfig: &config.EnvConfig{WrkDir: filepath.Join(tmp, "work")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := "git::" + repo + "//plans/ping"
+	def, err := e.DoImportPlan(context.Background(), src, "v1", "", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.Name != "imported" || def.Origin == nil {
+		t.Fatalf("unexpected test plan definition: %+v", def)
+	}
+	if def.Origin.Revision != v1 || def.Origin.Ref != "v1" {
+		t.Fatalf("expected the import to be pinned to %s (v1), got: %+v", v1, def.Origin)
+	}
+	if e.TestCensus().PlanByName("imported") != def {
+		t.Fatal("expected the imported test plan to be enrolled")
+	}
+
+	// the source is a snapshot of the requested revision.
+	srcdir := strings.TrimPrefix(def.SourcePath, "file://")
+	if b, err := ioutil.ReadFile(filepath.Join(srcdir, "main.go")); err != nil || !strings.Contains(string(b), "v1") {
+		t.Fatalf("expected the source at v1, got: %q (%v)", b, err)
+	}
+
+	// builds can be pinned to another revision of the imported source.
+	pinned, err := pinPlanRevision(def, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "git::file://" + repo + "//plans/ping?ref=" + v2; pinned.SourcePath != expected {
+		t.Fatalf("expected pinned source %s, got: %s", expected, pinned.SourcePath)
+	}
+	dst := filepath.Join(tmp, "pinned")
+	if err := getter.Get(dst, pinned.SourcePath); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dst, "main.go")); err != nil || !strings.Contains(string(b), "v2") {
+		t.Fatalf("expected the pinned source at v2, got: %q (%v)", b, err)
+	}
+
+	// a build pinned to an unknown revision can't fetch the source.
+	unknown, err := pinPlanRevision(def, "nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getter.Get(filepath.Join(tmp, "unknown"), unknown.SourcePath); err == nil {
+		t.Fatal("expected an error fetching an unknown revision")
+	}
+
+	// importing an unknown revision fails, and leaves the previous import in
+	// place.
+	if _, err := e.DoImportPlan(context.Background(), src, "nope", "", ioutil.Discard); err == nil || !strings.Contains(err.Error(), "revision nope") {
+		t.Fatalf("expected an error importing an unknown revision, got: %v", err)
+	}
+	if e.TestCensus().PlanByName("imported") != def {
+		t.Fatal("expected the previous import to remain enrolled")
+	}
+	if _, err := os.Stat(filepath.Join(srcdir, "main.go")); err != nil {
+		t.Fatalf("expected the previous import to remain on disk: %s", err)
+	}
+
+	// refs are only supported for git sources.
+	if _, err := e.DoImportPlan(context.Background(), plandir, "v1", "", ioutil.Discard); err == nil {
+		t.Fatal("expected an error importing a ref of a local directory")
+	}
+
+	// the name can be overridden.
+	def2, err := e.DoImportPlan(context.Background(), plandir, "", "renamed", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def2.Name != "renamed" || def2.Origin.Revision != "" {
+		t.Fatalf("unexpected test plan definition: %+v", def2)
+	}
+}
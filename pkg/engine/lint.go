@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ParamTypes enumerates the types a test case parameter can declare.
+var ParamTypes = []string{"int", "float", "bool", "string", "duration", "int array", "string array", "object"}
+
+// ManifestError is a problem found in a test plan manifest. Field is the
+// dotted path of the offending field, or empty if the problem concerns the
+// manifest as a whole, e.g. a syntax error.
+//
+// Warnings flag fields that are ignored, such as strategies for builders or
+// runners this build of testground doesn't know about; they don't prevent the
+// test plan from being used.
+type ManifestError struct {
+	Field   string
+	Message string
+	Warning bool
+}
+
+func (e ManifestError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// HasManifestErrors returns whether any of the problems is not a warning.
+func HasManifestErrors(errs []ManifestError) bool {
+	for _, e := range errs {
+		if !e.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// LintManifest parses the test plan manifest at path, and validates it against
+// the builders and runners known to the system. It returns the parsed
+// definition, which is nil if the manifest couldn't be parsed, along with all
+// problems found.
+func LintManifest(path string) (*api.TestPlanDefinition, []ManifestError) {
+	builders := make(map[string]api.Builder, len(AllBuilders))
+	for _, b := range AllBuilders {
+		builders[b.ID()] = b
+	}
+	runners := make(map[string]api.Runner, len(AllRunners))
+	for _, r := range AllRunners {
+		runners[r.ID()] = r
+	}
+	return lintManifest(path, builders, runners)
+}
+
+func lintManifest(path string, builders map[string]api.Builder, runners map[string]api.Runner) (*api.TestPlanDefinition, []ManifestError) {
+	def := new(api.TestPlanDefinition)
+	md, err := toml.DecodeFile(path, def)
+	if err != nil {
+		return nil, []ManifestError{{Message: fmt.Sprintf("failed to parse: %s", err)}}
+	}
+
+	var errs []ManifestError
+	for _, k := range md.Undecoded() {
+		// parameter defaults are free-form.
+		if len(k) > 3 && k[0] == "testcases" && k[1] == "params" && k[3] == "default" {
+			continue
+		}
+		errs = append(errs, ManifestError{Field: k.String(), Message: "unknown field; ignored", Warning: true})
+	}
+	return def, append(errs, validateTestPlan(def, builders, runners)...)
+}
+
+// validateTestPlan checks the consistency of a test plan definition.
+func validateTestPlan(def *api.TestPlanDefinition, builders map[string]api.Builder, runners map[string]api.Runner) (errs []ManifestError) {
+	add := func(field, format string, a ...interface{}) {
+		errs = append(errs, ManifestError{Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+	warn := func(field, format string, a ...interface{}) {
+		errs = append(errs, ManifestError{Field: field, Message: fmt.Sprintf(format, a...), Warning: true})
+	}
+
+	if def.Name == "" {
+		add("name", "missing test plan name")
+	}
+	if def.SourcePath == "" {
+		add("source_path", "missing source path")
+	}
+
+	// Strategies must refer to known builders and runners, and their
+	// configuration must match the configuration type of the component.
+	for _, id := range sortedKeys(def.BuildStrategies) {
+		field := fmt.Sprintf("build_strategies.%q", id)
+		b, ok := builders[id]
+		if !ok {
+			warn(field, "unknown builder; known builders: %s", strings.Join(sortedKeys(builders), ", "))
+			continue
+		}
+		errs = append(errs, validateStrategy(field, def.BuildStrategies[id], b.ConfigType())...)
+	}
+
+	for _, id := range sortedKeys(def.RunStrategies) {
+		field := fmt.Sprintf("run_strategies.%q", id)
+		r, ok := runners[id]
+		if !ok {
+			warn(field, "unknown runner; known runners: %s", strings.Join(sortedKeys(runners), ", "))
+			continue
+		}
+		errs = append(errs, validateStrategy(field, def.RunStrategies[id], r.ConfigType())...)
+	}
+
+	// Defaults must refer to enabled strategies.
+	if b := def.Defaults.Builder; b != "" && !strategyEnabled(def.BuildStrategies, b) {
+		add("defaults.builder", "%s is not an enabled build strategy", b)
+	}
+	if r := def.Defaults.Runner; r != "" && !strategyEnabled(def.RunStrategies, r) {
+		add("defaults.runner", "%s is not an enabled run strategy", r)
+	}
+
+	if len(def.TestCases) == 0 {
+		add("testcases", "no test cases declared")
+	}
+
+	seen := make(map[string]struct{}, len(def.TestCases))
+	for i, tc := range def.TestCases {
+		field := fmt.Sprintf("testcases[%d]", i)
+		if tc.Name == "" {
+			add(field+".name", "missing test case name")
+		} else {
+			field = fmt.Sprintf("testcases.%s", tc.Name)
+			if _, ok := seen[tc.Name]; ok {
+				add(field, "duplicate test case")
+			}
+			seen[tc.Name] = struct{}{}
+		}
+
+		inst := tc.Instances
+		switch {
+		case inst.Minimum < 1:
+			add(field+".instances.min", "must be at least 1, was %d", inst.Minimum)
+		case inst.Maximum < inst.Minimum:
+			add(field+".instances.max", "must not be lower than min (%d), was %d", inst.Minimum, inst.Maximum)
+		case inst.Default < inst.Minimum || inst.Default > inst.Maximum:
+			add(field+".instances.default", "must be between min (%d) and max (%d), was %d", inst.Minimum, inst.Maximum, inst.Default)
+		}
+
+		for _, name := range sortedKeys(tc.Parameters) {
+			if err := validateParameter(tc.Parameters[name]); err != nil {
+				add(fmt.Sprintf("%s.params.%s", field, name), "%s", err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateStrategy checks that the configuration of a strategy decodes into
+// the configuration type of its builder or runner, without leftover keys.
+func validateStrategy(field string, cfg config.ConfigMap, typ reflect.Type) (errs []ManifestError) {
+	m := make(map[string]interface{}, len(cfg))
+	for k, v := range cfg {
+		// enabled is a property of the strategy, not of the component.
+		if k != "enabled" {
+			m[k] = v
+		}
+	}
+
+	if v, ok := cfg["enabled"]; ok {
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, ManifestError{Field: field + ".enabled", Message: fmt.Sprintf("must be a boolean, was %v", v)})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(m); err != nil {
+		return append(errs, ManifestError{Field: field, Message: fmt.Sprintf("invalid configuration: %s", err)})
+	}
+
+	md, err := toml.DecodeReader(buf, reflect.New(typ).Interface())
+	if err != nil {
+		return append(errs, ManifestError{Field: field, Message: fmt.Sprintf("invalid configuration: %s", err)})
+	}
+
+	for _, k := range md.Undecoded() {
+		errs = append(errs, ManifestError{
+			Field:   field + "." + k.String(),
+			Message: fmt.Sprintf("unknown configuration key for %s; ignored", typ.Name()),
+			Warning: true,
+		})
+	}
+	return errs
+}
+
+// validateParameter checks that a parameter declares a known type, and that its
+// default value, if any, is of that type.
+func validateParameter(p api.Parameter) error {
+	known := false
+	for _, t := range ParamTypes {
+		known = known || t == p.Type
+	}
+	if !known {
+		return fmt.Errorf("unknown type %q; allowed types: %s", p.Type, strings.Join(ParamTypes, ", "))
+	}
+
+	if p.Default == nil {
+		return nil
+	}
+
+	var ok bool
+	switch d := p.Default.(type) {
+	case int64:
+		ok = p.Type == "int" || p.Type == "float"
+	case float64:
+		ok = p.Type == "float"
+	case bool:
+		ok = p.Type == "bool"
+	case string:
+		switch p.Type {
+		case "string":
+			ok = true
+		case "duration":
+			if _, err := time.ParseDuration(d); err != nil {
+				return fmt.Errorf("invalid default duration: %w", err)
+			}
+			ok = true
+		}
+	case []interface{}:
+		switch p.Type {
+		case "int array":
+			ok = allOfKind(d, reflect.Int64)
+		case "string array":
+			ok = allOfKind(d, reflect.String)
+		case "object":
+			ok = true
+		}
+	case []map[string]interface{}, map[string]interface{}:
+		ok = p.Type == "object"
+	}
+
+	if !ok {
+		return fmt.Errorf("default value %v is not of type %s", p.Default, p.Type)
+	}
+	return nil
+}
+
+func allOfKind(vs []interface{}, kind reflect.Kind) bool {
+	for _, v := range vs {
+		if reflect.ValueOf(v).Kind() != kind {
+			return false
+		}
+	}
+	return true
+}
+
+func strategyEnabled(strategies map[string]config.ConfigMap, id string) bool {
+	s, ok := strategies[id]
+	if !ok {
+		return false
+	}
+	enabled, _ := s["enabled"].(bool)
+	return enabled
+}
+
+// sortedKeys returns the keys of a map with string keys, in order.
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	res := make([]string, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, k.String())
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLintManifest(t *testing.T) {
+	manifest := `
+name = "broken"
+source_path = "file:///tmp/broken"
+colour = "blue"
+
+[defaults]
+builder = "docker:go"
+runner = "local:exec"
+
+[build_strategies."docker:go"]
+enabled = true
+go_version = 1.13
+
+[run_strategies."local:exec"]
+enabled = false
+
+[run_strategies."local:vm"]
+enabled = true
+
+[[testcases]]
+name = "a"
+instances = { min = 2, max = 4, default = 1 }
+
+  [testcases.params]
+  count = { type = "int", default = "ten" }
+  size = { type = "bytes" }
+
+[[testcases]]
+name = "a"
+instances = { min = 3, max = 1, default = 1 }
+`
+
+	dir, err := ioutil.TempDir("", "lint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.toml")
+	if err := ioutil.WriteFile(path, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, problems := LintManifest(path)
+
+	expected := map[string]bool{
+		"colour":                        true,  // unknown field
+		`run_strategies."local:vm"`:     true,  // unknown runner
+		`build_strategies."docker:go"`:  false, // go_version has the wrong type
+		"defaults.runner":               false,
+		"testcases.a.instances.default": false,
+		"testcases.a.params.count":      false,
+		"testcases.a.params.size":       false,
+		"testcases.a":                   false, // duplicate
+		"testcases.a.instances.max":     false,
+	}
+
+	got := make(map[string]bool, len(problems))
+	for _, p := range problems {
+		got[p.Field] = p.Warning
+	}
+
+	for field, warning := range expected {
+		w, ok := got[field]
+		switch {
+		case !ok:
+			t.Errorf("expected a problem with field %s; got: %v", field, problems)
+		case w != warning:
+			t.Errorf("field %s: expected warning=%t, got %t", field, warning, w)
+		}
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %d problems, got %d: %v", len(expected), len(got), problems)
+	}
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/config"
+)
+
+type fakeRunnerConfig struct {
+	Scoped string `toml:"scoped" group:"yes"`
+	Global string `toml:"global"`
+}
+
+// fakeRunner is an api.Runner that records its input.
+type fakeRunner struct {
+	in *api.RunInput
+}
+
+func (*fakeRunner) ID() string {
+	return "fake:runner"
+}
+
+func (*fakeRunner) ConfigType() reflect.Type {
+	return reflect.TypeOf(fakeRunnerConfig{})
+}
+
+func (*fakeRunner) CompatibleBuilders() []string {
+	return []string{"fake:a"}
+}
+
+func (r *fakeRunner) Run(_ context.Context, in *api.RunInput, _ io.Writer) (*api.RunOutput, error) {
+	r.in = in
+	return &api.RunOutput{RunID: in.RunID}, nil
+}
+
+func (*fakeRunner) CollectOutputs(context.Context, *api.CollectionInput, io.Writer) error {
+	return nil
+}
+
+func TestDoRunGroupScopedConfig(t *testing.T) {
+	r := new(fakeRunner)
+	e, err := NewEngine(&EngineConfig{
+		Builders:  []api.Builder{&fakeBuilder{id: "fake:a"}},
+		Runners:   []api.Runner{r},
+		EnvConfig: new(config.EnvConfig),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := &api.TestPlanDefinition{
+		Name: "scoped",
+		RunStrategies: map[string]config.ConfigMap{
+			"fake:runner": {"scoped": "plan", "global": "plan"},
+		},
+		TestCases: []*api.TestCase{{
+			Name:      "case",
+			Instances: api.TestCaseInstances{Minimum: 1, Maximum: 10},
+		}},
+	}
+	if err := e.census.EnrollTestPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	comp := func(groupcfg map[string]interface{}) *api.Composition {
+		return &api.Composition{
+			Global: api.Global{
+				Plan:           "scoped",
+				Case:           "case",
+				Builder:        "fake:a",
+				Runner:         "fake:runner",
+				TotalInstances: 2,
+				RunConfig:      map[string]interface{}{"global": "composition"},
+			},
+			Groups: []api.Group{
+				{ID: "a", Instances: api.Instances{Count: 1}},
+				{ID: "b", Instances: api.Instances{Count: 1}, Run: api.Run{RunConfig: groupcfg}},
+			},
+		}
+	}
+
+	// group-scoped keys are applied to their group only.
+	if _, err := e.DoRun(context.Background(), "", comp(map[string]interface{}{"scoped": "group"}), ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	expected := []fakeRunnerConfig{
+		{Scoped: "plan", Global: "composition"},
+		{Scoped: "group", Global: "composition"},
+	}
+	for i, exp := range expected {
+		if got := *r.in.Groups[i].RunnerConfig.(*fakeRunnerConfig); got != exp {
+			t.Errorf("group %s: expected runner config %+v, got: %+v", r.in.Groups[i].ID, exp, got)
+		}
+	}
+
+	// other keys are rejected before the run starts.
+	r.in = nil
+	_, err = e.DoRun(context.Background(), "", comp(map[string]interface{}{"global": "group"}), ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "not group-scoped") {
+		t.Fatalf("expected a non-group-scoped key to be rejected, got: %v", err)
+	}
+	if r.in != nil {
+		t.Fatal("expected the run not to start")
+	}
+}
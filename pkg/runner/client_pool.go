@@ -2,25 +2,39 @@ package runner
 
 import (
 	"fmt"
+	"io/ioutil"
+	"strings"
 
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// inClusterNamespacePath is where Kubernetes mounts the namespace of the pod.
+const inClusterNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
 type pool struct {
-	availableC chan *kubernetes.Clientset
+	availableC chan kubernetes.Interface
+
+	// config is the configuration the clientsets were created with.
+	config *rest.Config
+
+	// namespace is the namespace the runner operates in.
+	namespace string
 }
 
 // newPool returns a pool of Kubernetes clientset connections
 func newPool(workers int, config KubernetesConfig) (*pool, error) {
-	k8scfg, err := clientcmd.BuildConfigFromFlags("", config.KubeConfigPath)
+	k8scfg, namespace, err := restConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("could not start k8s client from config: %v", err)
 	}
 
 	pool := &pool{
-		availableC: make(chan *kubernetes.Clientset, workers),
+		availableC: make(chan kubernetes.Interface, workers),
+		config:     k8scfg,
+		namespace:  namespace,
 	}
 
 	for i := 0; i < workers; i++ {
@@ -35,10 +49,49 @@ func newPool(workers int, config KubernetesConfig) (*pool, error) {
 	return pool, nil
 }
 
-func (p *pool) Acquire() *kubernetes.Clientset {
+// restConfig builds the client configuration, and resolves the namespace to
+// operate in: the configured one, or else the one of the kubeconfig context or
+// of the pod we're running in.
+func restConfig(config KubernetesConfig) (*rest.Config, string, error) {
+	if config.InCluster {
+		k8scfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, "", err
+		}
+		namespace := config.Namespace
+		if namespace == "" {
+			b, err := ioutil.ReadFile(inClusterNamespacePath)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to read the namespace of the pod: %w", err)
+			}
+			namespace = strings.TrimSpace(string(b))
+		}
+		return k8scfg, namespace, nil
+	}
+
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: config.KubeConfigPath},
+		&clientcmd.ConfigOverrides{CurrentContext: config.Context},
+	)
+	k8scfg, err := cc.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	namespace := config.Namespace
+	if namespace == "" {
+		// defaults to "default" if the context doesn't set a namespace.
+		if namespace, _, err = cc.Namespace(); err != nil {
+			return nil, "", err
+		}
+	}
+	return k8scfg, namespace, nil
+}
+
+func (p *pool) Acquire() kubernetes.Interface {
 	return <-p.availableC
 }
 
-func (p *pool) Release(cs *kubernetes.Clientset) {
+func (p *pool) Release(cs kubernetes.Interface) {
 	p.availableC <- cs
 }
@@ -1,29 +1,23 @@
 package runner
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math"
-	"math/rand"
-	"net"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/go-multierror"
 	"github.com/ipfs/testground/pkg/api"
 	"github.com/ipfs/testground/pkg/conv"
 	"github.com/ipfs/testground/pkg/logging"
@@ -31,15 +25,17 @@ import (
 	"go.uber.org/zap"
 
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 var (
-	_ api.Runner = &ClusterK8sRunner{}
+	_ api.Runner       = &ClusterK8sRunner{}
+	_ api.Teardownable = &ClusterK8sRunner{}
+	_ api.Churner      = &ClusterK8sRunner{}
 )
 
 const (
@@ -60,22 +56,6 @@ var (
 	testplanSysctls = []v1.Sysctl{{Name: "net.core.somaxconn", Value: "10000"}}
 )
 
-var k8sSubnetIdx uint64 = 0
-
-func init() {
-	// Avoid collisions in picking up subnets
-	rand.Seed(time.Now().UnixNano())
-	k8sSubnetIdx = rand.Uint64() % 4096
-}
-
-func nextK8sSubnet() (*net.IPNet, error) {
-	subnet, _, err := nextDataNetwork(int(atomic.AddUint64(&k8sSubnetIdx, 1) % 4096))
-	if err != nil {
-		return nil, err
-	}
-	return subnet, err
-}
-
 func homeDir() string {
 	home, _ := os.UserHomeDir()
 	return home
@@ -83,9 +63,14 @@ func homeDir() string {
 
 // ClusterK8sRunnerConfig is the configuration object of this runner. Boolean
 // values are expressed in a way that zero value (false) is the default setting.
+//
+// Fields tagged with `group:"yes"` can be set per group: log_level,
+// pod_resource_memory, pod_resource_cpu, and the scheduling controls
+// (node_selector, tolerations, avoid_groups, prefer_groups, spread_max_skew,
+// spread_topology_key and priority_class).
 type ClusterK8sRunnerConfig struct {
 	// LogLevel sets the log level in the test containers (default: not set).
-	LogLevel string `toml:"log_level"`
+	LogLevel string `toml:"log_level" group:"yes"`
 
 	KeepService bool `toml:"keep_service"`
 
@@ -95,9 +80,112 @@ type ClusterK8sRunnerConfig struct {
 	// Region of the S3 bucket used for `outputs` from test plans
 	OutputsBucketRegion string `toml:"outputs_bucket_region"`
 
+	// OutputsBackend is where test plans write their `outputs` to: "s3", a
+	// host path synced to OutputsBucket, or "pvc", a subdirectory per pod of
+	// OutputsPVC (default: "s3").
+	OutputsBackend string `toml:"outputs_backend"`
+
+	// OutputsEndpoint is the endpoint of an S3-compatible store holding
+	// OutputsBucket, e.g. MinIO (default: AWS S3).
+	OutputsEndpoint string `toml:"outputs_endpoint"`
+
+	// OutputsPVC is the name of the persistent volume claim used for `outputs`
+	// if OutputsBackend = "pvc". It must be mountable by all pods at once
+	// (ReadWriteMany).
+	OutputsPVC string `toml:"outputs_pvc"`
+
+	// OutputsCollectorImage is the image of the pod that reads the outputs
+	// from OutputsPVC when collecting them. It must provide tar (default:
+	// "busybox").
+	OutputsCollectorImage string `toml:"outputs_collector_image"`
+
 	// Resources requested for each pod from the Kubernetes cluster
-	PodResourceMemory string `toml:"pod_resource_memory"`
-	PodResourceCPU    string `toml:"pod_resource_cpu"`
+	PodResourceMemory string `toml:"pod_resource_memory" group:"yes"`
+	PodResourceCPU    string `toml:"pod_resource_cpu" group:"yes"`
+
+	// KubeConfigPath is the path to the kubeconfig file (default: $KUBECONFIG,
+	// or ~/.kube/config).
+	KubeConfigPath string `toml:"kubeconfig"`
+
+	// KubeContext is the kubeconfig context to use (default: the current
+	// context).
+	KubeContext string `toml:"kube_context"`
+
+	// InCluster uses the service account of the pod testground runs in to
+	// access the cluster, instead of a kubeconfig file.
+	InCluster bool `toml:"in_cluster"`
+
+	// Namespace is the namespace to run the pods in (default: the namespace
+	// of the kubeconfig context, or of the pod testground runs in if
+	// InCluster = true; otherwise "default").
+	Namespace string `toml:"namespace"`
+
+	// RedisHost is the host of the sync service the pods connect to. It must be
+	// the sync service the sidecar connects to (default:
+	// "redis-headless.<namespace>.svc.cluster.local", i.e. the redis-headless
+	// service of Namespace).
+	RedisHost string `toml:"redis_host"`
+
+	// ServiceAccount is the service account the pods run as (default: the
+	// default service account of the namespace).
+	ServiceAccount string `toml:"service_account"`
+
+	// ImagePullSecrets are the names of the secrets used to pull the test plan
+	// images from private registries.
+	ImagePullSecrets []string `toml:"image_pull_secrets"`
+
+	// NodeSelector restricts the pods to the nodes with these labels.
+	NodeSelector map[string]string `toml:"node_selector" group:"yes"`
+
+	// Tolerations allow the pods to be scheduled on nodes with matching
+	// taints.
+	Tolerations []K8sToleration `toml:"tolerations" group:"yes"`
+
+	// AvoidGroups are groups of the run whose pods never share a node with
+	// the pods of this group.
+	AvoidGroups []string `toml:"avoid_groups" group:"yes"`
+
+	// PreferGroups are groups of the run whose nodes the pods of this group
+	// preferably run on.
+	PreferGroups []string `toml:"prefer_groups" group:"yes"`
+
+	// SpreadMaxSkew spreads the pods of the group evenly across the domains of
+	// SpreadTopologyKey: the number of pods in any two domains differs by at
+	// most this much (default: 0; pods aren't spread).
+	SpreadMaxSkew int `toml:"spread_max_skew" group:"yes"`
+
+	// SpreadTopologyKey is the node label defining the domains to spread the
+	// pods across (default: "kubernetes.io/hostname", i.e. nodes).
+	SpreadTopologyKey string `toml:"spread_topology_key" group:"yes"`
+
+	// PriorityClass is the priority class of the pods.
+	PriorityClass string `toml:"priority_class" group:"yes"`
+
+	// FailFastAfter aborts the run if any pod is still failing to start after
+	// this long, e.g. because its image can't be pulled, or the cluster lacks
+	// the resources to schedule it (default: not set; such pods are reported,
+	// and the run waits for them until it times out).
+	FailFastAfter string `toml:"fail_fast_after"`
+}
+
+// redisHost returns the host of the sync service for pods running in the
+// namespace.
+func (c *ClusterK8sRunnerConfig) redisHost(namespace string) string {
+	if c.RedisHost != "" {
+		return c.RedisHost
+	}
+	return "redis-headless." + namespace + ".svc.cluster.local"
+}
+
+// K8sToleration tolerates the taints of nodes, so that pods can be scheduled
+// on them; see the Kubernetes documentation on taints and tolerations.
+type K8sToleration struct {
+	Key string `toml:"key"`
+	// Operator is "Equal" (the default) or "Exists".
+	Operator string `toml:"operator"`
+	Value    string `toml:"value"`
+	// Effect is the taint effect to match, or empty to match all effects.
+	Effect string `toml:"effect"`
 }
 
 // ClusterK8sRunner is a runner that creates a Docker service to launch as
@@ -107,17 +195,30 @@ type ClusterK8sRunner struct{}
 type KubernetesConfig struct {
 	// KubeConfigPath is the path to your kubernetes configuration path
 	KubeConfigPath string `json:"kubeConfigPath"`
+	// Context is the context of the kubernetes configuration to use
+	Context string `json:"context"`
+	// InCluster uses the in-cluster configuration instead of KubeConfigPath
+	InCluster bool `json:"inCluster"`
 	// Namespace is the kubernetes namespaces where the pods should be running
 	Namespace string `json:"namespace"`
 }
 
-// defaultKubernetesConfig uses the default ~/.kube/config
-// to discover the kubernetes clusters. It also uses the "default" namespace.
-func defaultKubernetesConfig() KubernetesConfig {
-	kubeconfig := filepath.Join(homeDir(), ".kube", "config")
+// kubernetesConfig returns the kubernetes configuration selected by the runner
+// configuration. By default, it uses ~/.kube/config to discover the kubernetes
+// clusters. The namespace is resolved when creating the client pool.
+func kubernetesConfig(cfg *ClusterK8sRunnerConfig) KubernetesConfig {
+	path := cfg.KubeConfigPath
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path == "" {
+		path = filepath.Join(homeDir(), ".kube", "config")
+	}
 	return KubernetesConfig{
-		KubeConfigPath: kubeconfig,
-		Namespace:      "default",
+		KubeConfigPath: path,
+		Context:        cfg.KubeContext,
+		InCluster:      cfg.InCluster,
+		Namespace:      cfg.Namespace,
 	}
 }
 
@@ -139,36 +240,88 @@ func (*ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.Wri
 		TestCaseSeq:       input.Seq,
 		TestInstanceCount: input.TotalInstances,
 		TestSidecar:       true,
+		TestLifecycle:     true,
 		TestOutputsPath:   "/outputs",
 	}
 
-	// currently weave is not releaasing IP addresses upon container deletion - we get errors back when trying to
-	// use an already used IP address, even if the container has been removed
-	// this functionality should be refactored asap, when we understand how weave releases IPs (or why it doesn't release
-	// them when a container is removed/ and as soon as we decide how to manage `networks in-use` so that there are no
-	// collisions in concurrent testplan runs
-	subnet, err := nextK8sSubnet()
+	if cfg.OutputsBackend == "pvc" && cfg.OutputsPVC == "" {
+		return nil, errors.New("outputs_pvc is required by the pvc outputs backend")
+	}
+
+	workers := 20
+	pool, err := newPool(workers, kubernetesConfig(&cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	// Lease a data subnet, so that concurrent runs never share one. The lease
+	// is released when the run is done, unless the pods are kept, in which
+	// case it's released when the run is torn down.
+	client := pool.Acquire()
+	subnet, err := leaseK8sSubnet(client, input.RunID)
+	pool.Release(client)
 	if err != nil {
 		return nil, err
 	}
 
+	defer func() {
+		if cfg.KeepService {
+			return
+		}
+		client := pool.Acquire()
+		defer pool.Release(client)
+		if err := releaseK8sSubnets(client, input.RunID); err != nil {
+			log.Errorw("couldn't release the data subnet", "err", err)
+		}
+	}()
+
 	template.TestSubnet = &runtime.IPNet{IPNet: *subnet}
 
-	k8sConfig := defaultKubernetesConfig()
+	api.WriteEvent(ow, &api.Event{
+		Type: api.EventTypeNetworkConfigured,
+		Network: &api.NetworkEvent{
+			RunID:  input.RunID,
+			Name:   "default",
+			Subnet: subnet.String(),
+		},
+	})
 
-	workers := 20
-	pool, err := newPool(workers, k8sConfig)
-	if err != nil {
-		return nil, err
+	// Groups may request different resources, so check the capacity of the
+	// cluster against the CPUs requested by all of them.
+	var requestedCPUs float64
+	for _, g := range input.Groups {
+		gcfg := g.RunnerConfig.(*ClusterK8sRunnerConfig)
+		if err := validateScheduling(g.ID, gcfg, input.Groups); err != nil {
+			return nil, err
+		}
+		if _, err := resource.ParseQuantity(gcfg.PodResourceMemory); err != nil {
+			return nil, fmt.Errorf("invalid pod_resource_memory for group %s: %w", g.ID, err)
+		}
+		q, err := resource.ParseQuantity(gcfg.PodResourceCPU)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod_resource_cpu for group %s: %w", g.ID, err)
+		}
+		cpu, err := strconv.ParseFloat(q.AsDec().String(), 64)
+		if err != nil {
+			return nil, err
+		}
+		requestedCPUs += cpu * float64(g.Instances)
 	}
 
-	maxAllowedPods, err := maxPods(pool, resource.MustParse(cfg.PodResourceCPU))
+	availableCPUs, err := availablePodCPUs(pool)
 	if err != nil {
 		return nil, err
 	}
 
-	if maxAllowedPods < input.TotalInstances {
-		return nil, fmt.Errorf("too many test instances requested, max is %d, resize cluster if you need more capacity", maxAllowedPods)
+	if requestedCPUs > availableCPUs {
+		return nil, fmt.Errorf("too many test instances requested: they need %.2f CPUs, but %.2f are available; resize cluster if you need more capacity", requestedCPUs, availableCPUs)
+	}
+
+	var failFast time.Duration
+	if cfg.FailFastAfter != "" {
+		if failFast, err = time.ParseDuration(cfg.FailFastAfter); err != nil {
+			return nil, fmt.Errorf("invalid fail_fast_after: %w", err)
+		}
 	}
 
 	jobName := fmt.Sprintf("tg-%s", input.TestPlan.Name)
@@ -177,35 +330,49 @@ func (*ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.Wri
 
 	var eg errgroup.Group
 
-	eg.Go(func() error {
-		return monitorTestplanRunState(ctx, pool, log, input, k8sConfig.Namespace)
-	})
-
 	sem := make(chan struct{}, 30) // limit the number of concurrent k8s api calls
 
 	for _, g := range input.Groups {
+		g := g
 		runenv := template
 		runenv.TestGroupID = g.ID
 		runenv.TestGroupInstanceCount = g.Instances
 		runenv.TestInstanceParams = g.Parameters
 
-		env := conv.ToEnvVar(runenv.ToEnvVars())
-		env = append(env, v1.EnvVar{
+		// Environment variables to pass to the pods, besides the runenv.
+		extraEnv := []v1.EnvVar{{
 			Name:  "REDIS_HOST",
-			Value: "redis-headless",
-		})
+			Value: cfg.redisHost(pool.namespace),
+		}}
 
-		// Set the log level if provided in cfg.
-		if cfg.LogLevel != "" {
-			env = append(env, v1.EnvVar{
+		// Set the log level if provided in the group cfg.
+		if gcfg := g.RunnerConfig.(*ClusterK8sRunnerConfig); gcfg.LogLevel != "" {
+			extraEnv = append(extraEnv, v1.EnvVar{
 				Name:  "LOG_LEVEL",
-				Value: cfg.LogLevel,
+				Value: gcfg.LogLevel,
 			})
 		}
+
+		// The sidecar enforces the churn of the group.
+		if g.Churn != nil {
+			churn, err := json.Marshal(g.Churn)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode churn of group %s: %w", g.ID, err)
+			}
+			extraEnv = append(extraEnv, v1.EnvVar{
+				Name:  api.EnvChurn,
+				Value: string(churn),
+			})
+		}
+
 		for i := 0; i < g.Instances; i++ {
 			i := i
 			sem <- struct{}{}
 
+			runenv := runenv
+			runenv.TestGroupInstanceIndex = i
+			env := append(conv.ToEnvVar(runenv.ToEnvVars()), extraEnv...)
+
 			podName := fmt.Sprintf("%s-%s-%s-%d", jobName, input.RunID, g.ID, i)
 
 			defer func() {
@@ -214,7 +381,7 @@ func (*ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.Wri
 				}
 				client := pool.Acquire()
 				defer pool.Release(client)
-				err = client.CoreV1().Pods("default").Delete(podName, &metav1.DeleteOptions{})
+				err = client.CoreV1().Pods(pool.namespace).Delete(podName, &metav1.DeleteOptions{})
 				if err != nil {
 					log.Errorw("couldn't remove pod", "pod", podName, "err", err)
 				}
@@ -223,7 +390,7 @@ func (*ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.Wri
 			eg.Go(func() error {
 				defer func() { <-sem }()
 
-				return createPod(ctx, pool, podName, input, runenv, env, k8sConfig.Namespace, g, i)
+				return createPod(ctx, pool, podName, input, runenv, env, pool.namespace, g, i)
 			})
 		}
 	}
@@ -233,129 +400,203 @@ func (*ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow io.Wri
 		return nil, err
 	}
 
-	var gg errgroup.Group
-
+	podNames := make([]string, 0, input.TotalInstances)
 	for _, g := range input.Groups {
-
 		for i := 0; i < g.Instances; i++ {
-			i := i
-			sem <- struct{}{}
-
-			gg.Go(func() error {
-				defer func() { <-sem }()
+			podNames = append(podNames, fmt.Sprintf("%s-%s-%s-%d", jobName, input.RunID, g.ID, i))
+		}
+	}
 
-				client := pool.Acquire()
-				defer pool.Release(client)
+	// Follow the logs of each pod as soon as it starts, and feed them to the
+	// pretty printer, which also writes the instance events to the output.
+	pretty := NewPrettyPrinter(ow)
+	if err := followRun(ctx, pool, log, input, podNames, failFast, pretty); err != nil {
+		return nil, err
+	}
+	return &api.RunOutput{RunID: input.RunID}, nil
+}
 
-				podName := fmt.Sprintf("%s-%s-%s-%d", jobName, input.RunID, g.ID, i)
+// followRun follows the logs of the pods of the run as they start, feeding
+// them to the pretty printer, until all pods terminate (see
+// monitorTestplanRunState). It returns once the logs of all pods have been
+// processed, or their failure to start reported.
+func followRun(ctx context.Context, pool *pool, log *zap.SugaredLogger, input *api.RunInput, podNames []string, failFast time.Duration, pretty *PrettyPrinter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	problems := newPodProblems()
+
+	// pods are registered with the pretty printer as they start; wait for all
+	// of them to be registered before waiting on the printer.
+	var followers sync.WaitGroup
+	followers.Add(len(podNames))
+	for _, podName := range podNames {
+		podName := podName
+		go func() {
+			defer followers.Done()
+
+			stream, err := followPodLogs(ctx, pool, podName, problems)
+			if err != nil {
+				pretty.FailStart(podName, err)
+				return
+			}
+			// kubernetes merges stdout and stderr into a single stream.
+			pretty.Manage(podName, stream, ioutil.NopCloser(strings.NewReader("")))
+		}()
+	}
 
-				logs, err := getPodLogs(client, podName)
-				if err != nil {
-					return err
-				}
+	err := monitorTestplanRunState(ctx, pool, log, input, pool.namespace, failFast, problems)
+	if err != nil {
+		// stop following the pods; the ones that failed to start are reported
+		// before bailing out.
+		cancel()
+	}
+	followers.Wait()
 
-				fmt.Print(logs)
-				return nil
-			})
-		}
+	if perr := pretty.Wait(); err == nil {
+		err = perr
 	}
+	return err
+}
+
+// TeardownRun deletes all pods labelled with the run ID.
+func (*ClusterK8sRunner) TeardownRun(ctx context.Context, input *api.TeardownInput) (*api.TeardownOutput, error) {
+	var (
+		log = logging.S().With("runner", "cluster:k8s", "run_id", input.RunID)
+		cfg = input.RunnerConfig.(*ClusterK8sRunnerConfig)
+	)
 
-	err = gg.Wait()
+	pool, err := newPool(1, kubernetesConfig(cfg))
 	if err != nil {
 		return nil, err
 	}
 
-	return &api.RunOutput{RunID: input.RunID}, nil
+	client := pool.Acquire()
+	defer pool.Release(client)
+
+	pods, err := client.CoreV1().Pods(pool.namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("testground.run_id=%s", input.RunID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var (
+		out  = new(api.TeardownOutput)
+		merr *multierror.Error
+	)
+	for _, p := range pods.Items {
+		if err := ctx.Err(); err != nil {
+			return out, multierror.Append(merr, err).ErrorOrNil()
+		}
+
+		log.Infow("deleting pod", "pod", p.Name)
+		if err := client.CoreV1().Pods(pool.namespace).Delete(p.Name, &metav1.DeleteOptions{}); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to delete pod %s: %w", p.Name, err))
+			continue
+		}
+		out.Removed = append(out.Removed, "pod "+p.Name)
+	}
+
+	if err := releaseK8sSubnets(client, input.RunID); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+
+	return out, merr.ErrorOrNil()
 }
 
 func (*ClusterK8sRunner) ID() string {
 	return "cluster:k8s"
 }
 
+func (*ClusterK8sRunner) SupportsChurn() {}
+
 func (*ClusterK8sRunner) ConfigType() reflect.Type {
 	return reflect.TypeOf(ClusterK8sRunnerConfig{})
 }
 
 func (*ClusterK8sRunner) CompatibleBuilders() []string {
-	return []string{"docker:go"}
+	return []string{"docker:go", "docker:generic"}
 }
 
+// CollectOutputs zips the outputs of the run from the outputs backend.
 func (*ClusterK8sRunner) CollectOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
 	log := logging.S().With("runner", "cluster:k8s", "run_id", input.RunID)
 	cfg := *input.RunnerConfig.(*ClusterK8sRunnerConfig)
 
-	log.Info("collecting outputs")
+	log.Infow("collecting outputs", "backend", cfg.OutputsBackend)
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(cfg.OutputsBucketRegion)},
-	)
-	if err != nil {
-		return fmt.Errorf("Couldn't establish an AWS session to list items in bucket: %v", err)
+	switch cfg.OutputsBackend {
+	case "", "s3":
+		store := &s3OutputsStore{bucket: cfg.OutputsBucket, region: cfg.OutputsBucketRegion, endpoint: cfg.OutputsEndpoint}
+		sess, err := store.session()
+		if err != nil {
+			return fmt.Errorf("Couldn't establish an AWS session to list items in bucket: %v", err)
+		}
+		return zipS3Prefix(ctx, sess, cfg.OutputsBucket, input.RunID, "", nil, w)
+	case "pvc":
+		pool, err := newPool(1, kubernetesConfig(&cfg))
+		if err != nil {
+			return err
+		}
+		return collectPVCOutputs(ctx, pool, &cfg, input, w)
+	default:
+		return fmt.Errorf("unknown outputs backend %q; supported: s3, pvc", cfg.OutputsBackend)
 	}
+}
 
-	svc := s3.New(sess)
-
-	downloader := s3manager.NewDownloader(sess)
-	downloader.Concurrency = 1 // force sequential downloads.
-
-	zipWriter := zip.NewWriter(w)
-	defer zipWriter.Close()
-
-	query := s3.ListObjectsV2Input{Bucket: aws.String(cfg.OutputsBucket), Prefix: aws.String(input.RunID)}
+// followPodLogs waits for the pod to start, then follows its logs until the pod
+// terminates or ctx is done. If ctx is done before the pod starts, the error
+// reports the problem that prevented it from starting, if known.
+//
+// A client is only acquired from the pool for each call to the API, so that
+// followers of pending pods don't starve the other users of the pool.
+func followPodLogs(ctx context.Context, pool *pool, podName string, problems *podProblems) (io.ReadCloser, error) {
 	for {
-		resp, err := svc.ListObjectsV2WithContext(ctx, &query)
+		client := pool.Acquire()
+		pod, err := client.CoreV1().Pods(pool.namespace).Get(podName, metav1.GetOptions{})
+		pool.Release(client)
 		if err != nil {
-			return fmt.Errorf("Unable to list items in bucket %q, %v", cfg.OutputsBucket, err)
+			return nil, fmt.Errorf("failed to get pod: %w", err)
+		}
+		if pod.Status.Phase != v1.PodPending {
+			break
 		}
 
-		log.Debugw("got contents", "len", len(resp.Contents))
-		for _, item := range resp.Contents {
-			ww, err := zipWriter.Create(*item.Key)
-			if err != nil {
-				return fmt.Errorf("Couldn't add file to the zip archive: %v", err)
-			}
-
-			_, err = downloader.DownloadWithContext(ctx, FakeWriterAt{ww},
-				&s3.GetObjectInput{
-					Bucket: aws.String(cfg.OutputsBucket),
-					Key:    item.Key,
-				})
-			if err != nil {
-				return fmt.Errorf("Couldn't download item from S3: %q, err: %v", item, err)
+		select {
+		case <-ctx.Done():
+			if problem := problems.get(podName); problem != "" {
+				return nil, errors.New(problem)
 			}
+			return nil, ctx.Err()
+		case <-time.After(1 * time.Second):
 		}
-		if !*resp.IsTruncated {
-			break
-		}
-		query.SetContinuationToken(*resp.NextContinuationToken)
 	}
 
-	return nil
-}
-
-func getPodLogs(clientset *kubernetes.Clientset, podName string) (string, error) {
-	podLogOpts := v1.PodLogOptions{
-		TailLines: int64Ptr(2),
-	}
-	req := clientset.CoreV1().Pods("default").GetLogs(podName, &podLogOpts)
-	podLogs, err := req.Stream()
-	if err != nil {
-		return "", fmt.Errorf("error in opening stream: %v", err)
-	}
-	defer podLogs.Close()
+	client := pool.Acquire()
+	defer pool.Release(client)
 
-	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, podLogs)
+	stream, err := streamPodLogs(ctx, client, pool.namespace, podName)
 	if err != nil {
-		return "", fmt.Errorf("error in copy information from podLogs to buf: %v", err)
+		return nil, fmt.Errorf("error in opening stream: %w", err)
 	}
+	return stream, nil
+}
 
-	return buf.String(), nil
+// streamPodLogs opens a stream following the logs of the pod. It's a variable
+// so that tests can replace it, as fake clientsets can't stream logs.
+var streamPodLogs = func(ctx context.Context, client kubernetes.Interface, namespace, podName string) (io.ReadCloser, error) {
+	req := client.CoreV1().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{Follow: true})
+	return req.Context(ctx).Stream()
 }
 
-func monitorTestplanRunState(ctx context.Context, pool *pool, log *zap.SugaredLogger, input *api.RunInput, k8sNamespace string) error {
-	client := pool.Acquire()
-	defer pool.Release(client)
+// monitorTestplanRunState waits for all pods of the run to terminate. It
+// records the problems of the pods that fail to start in problems, and aborts
+// the run if any pod is still failing to start after the failFast grace
+// period, if set.
+func monitorTestplanRunState(ctx context.Context, pool *pool, log *zap.SugaredLogger, input *api.RunInput, k8sNamespace string, failFast time.Duration, problems *podProblems) error {
+	// pods whose failure was already logged.
+	failed := make(map[string]struct{})
 
 	start := time.Now()
 	for {
@@ -370,61 +611,68 @@ func monitorTestplanRunState(ctx context.Context, pool *pool, log *zap.SugaredLo
 		}
 		time.Sleep(2000 * time.Millisecond)
 
-		countPodsByState := func(state string) int {
-			fieldSelector := fmt.Sprintf("status.phase=%s", state)
-			opts := metav1.ListOptions{
-				LabelSelector: fmt.Sprintf("testground.run_id=%s", input.RunID),
-				FieldSelector: fieldSelector,
-			}
-			res, err := client.CoreV1().Pods(k8sNamespace).List(opts)
-			if err != nil {
-				log.Warnw("k8s client pods list error", "err", err.Error())
-				return -1
-			}
-			return len(res.Items)
+		client := pool.Acquire()
+		res, err := client.CoreV1().Pods(k8sNamespace).List(metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("testground.run_id=%s", input.RunID),
+		})
+		pool.Release(client)
+		if err != nil {
+			log.Warnw("k8s client pods list error", "err", err.Error())
+			continue
 		}
 
-		counters := map[string]int{}
-		var countersMu sync.Mutex
-		states := []string{"Pending", "Running", "Succeeded", "Failed", "Unknown"}
+		counters := map[v1.PodPhase]int{}
+		for i := range res.Items {
+			pod := &res.Items[i]
+			counters[pod.Status.Phase]++
 
-		var wg sync.WaitGroup
-		wg.Add(len(states))
-		for _, state := range states {
-			state := state
-			go func() {
-				defer wg.Done()
+			if problem := podProblem(pod); problems.update(pod.Name, problem) {
+				log.Warnw("pod failing to start", "pod", pod.Name, "problem", problem)
+			}
+			if _, ok := failed[pod.Name]; !ok {
+				if reason := podFailure(pod); reason != "" {
+					log.Warnw("pod failed", "pod", pod.Name, "reason", reason)
+					failed[pod.Name] = struct{}{}
+				}
+			}
+		}
 
-				n := countPodsByState(state)
+		log.Debugw("testplan state", "succeeded", counters[v1.PodSucceeded], "running", counters[v1.PodRunning], "pending", counters[v1.PodPending], "failed", counters[v1.PodFailed], "unknown", counters[v1.PodUnknown])
 
-				countersMu.Lock()
-				counters[state] = n
-				countersMu.Unlock()
-			}()
+		if failFast > 0 {
+			if stuck := problems.olderThan(failFast); len(stuck) > 0 {
+				return fmt.Errorf("aborting run: %d pods failed to start within %s: %s", len(stuck), failFast, strings.Join(stuck, "; "))
+			}
 		}
-		wg.Wait()
-
-		log.Debugw("testplan state", "succeeded", counters["Succeeded"], "running", counters["Running"], "pending", counters["Pending"], "failed", counters["Failed"], "unknown", counters["Unknown"])
 
-		if counters["Succeeded"] == input.TotalInstances {
+		// failed instances are reported by the pretty printer.
+		if counters[v1.PodSucceeded]+counters[v1.PodFailed] == input.TotalInstances {
 			return nil
 		}
 	}
 }
 
 func createPod(ctx context.Context, pool *pool, podName string, input *api.RunInput, runenv runtime.RunParams, env []v1.EnvVar, k8sNamespace string, g api.RunGroup, i int) error {
-	cfg := *input.RunnerConfig.(*ClusterK8sRunnerConfig)
+	cfg := *g.RunnerConfig.(*ClusterK8sRunnerConfig)
 
 	client := pool.Acquire()
 	defer pool.Release(client)
 
+	sched := podScheduling(input.RunID, g.ID, &cfg)
+
 	mountPropagationMode := v1.MountPropagationHostToContainer
 	hostpathtype := v1.HostPathType("DirectoryOrCreate")
 	sharedVolumeName := "s3-shared"
 
-	mnt := v1.HostPathVolumeSource{
-		Path: fmt.Sprintf("/mnt/%s/%s/%d", input.RunID, g.ID, i),
-		Type: &hostpathtype,
+	// outputs go to a host path synced to S3, or to a subdirectory of the
+	// shared volume claim.
+	var (
+		volume  = v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: fmt.Sprintf("/mnt/%s/%s/%d", input.RunID, g.ID, i), Type: &hostpathtype}}
+		subpath string
+	)
+	if cfg.OutputsBackend == "pvc" {
+		volume = v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: cfg.OutputsPVC}}
+		subpath = fmt.Sprintf("%s/%s/%d", input.RunID, g.ID, i)
 	}
 
 	podRequest := &v1.Pod{
@@ -442,13 +690,20 @@ func createPod(ctx context.Context, pool *pool, podName string, input *api.RunIn
 			Volumes: []v1.Volume{
 				{
 					Name:         sharedVolumeName,
-					VolumeSource: v1.VolumeSource{HostPath: &mnt},
+					VolumeSource: volume,
 				},
 			},
 			SecurityContext: &v1.PodSecurityContext{
 				Sysctls: testplanSysctls,
 			},
-			RestartPolicy: v1.RestartPolicyNever,
+			RestartPolicy:             v1.RestartPolicyNever,
+			ServiceAccountName:        cfg.ServiceAccount,
+			ImagePullSecrets:          imagePullSecrets(cfg.ImagePullSecrets),
+			NodeSelector:              cfg.NodeSelector,
+			Tolerations:               sched.tolerations,
+			Affinity:                  sched.affinity,
+			TopologySpreadConstraints: sched.spread,
+			PriorityClassName:         cfg.PriorityClass,
 			Containers: []v1.Container{
 				{
 					Name:  podName,
@@ -465,6 +720,7 @@ func createPod(ctx context.Context, pool *pool, podName string, input *api.RunIn
 						{
 							Name:             sharedVolumeName,
 							MountPath:        runenv.TestOutputsPath,
+							SubPath:          subpath,
 							MountPropagation: &mountPropagationMode,
 						},
 					},
@@ -485,6 +741,14 @@ func createPod(ctx context.Context, pool *pool, podName string, input *api.RunIn
 
 func int64Ptr(i int64) *int64 { return &i }
 
+func imagePullSecrets(names []string) []v1.LocalObjectReference {
+	refs := make([]v1.LocalObjectReference, 0, len(names))
+	for _, n := range names {
+		refs = append(refs, v1.LocalObjectReference{Name: n})
+	}
+	return refs
+}
+
 type FakeWriterAt struct {
 	w io.Writer
 }
@@ -494,14 +758,10 @@ func (fw FakeWriterAt) WriteAt(p []byte, offset int64) (n int, err error) {
 	return fw.w.Write(p)
 }
 
-// maxPods returns the max allowed pods for the current cluster size
-// at the moment we are CPU bound, so this is based only on rough estimation of available CPUs
-func maxPods(pool *pool, podResourceCPU resource.Quantity) (int, error) {
-	podCPU, err := strconv.ParseFloat(podResourceCPU.AsDec().String(), 64)
-	if err != nil {
-		return 0, err
-	}
-
+// availablePodCPUs returns the CPUs available to test instances for the current
+// cluster size. At the moment we are CPU bound, so this is based only on rough
+// estimation of available CPUs.
+func availablePodCPUs(pool *pool) (float64, error) {
 	client := pool.Acquire()
 	defer pool.Release(client)
 
@@ -520,8 +780,5 @@ func maxPods(pool *pool, podResourceCPU resource.Quantity) (int, error) {
 
 	totalCPUs := nodes * int(nodeCPUs)
 	availableCPUs := float64(totalCPUs) - redisCPUs - float64(nodes)*sidecarCPUs
-	podsCPUs := availableCPUs * utilisation
-	pods := int(math.Round(podsCPUs/podCPU - 0.5))
-
-	return pods, nil
+	return availableCPUs * utilisation, nil
 }
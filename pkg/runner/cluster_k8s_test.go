@@ -0,0 +1,213 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newFakePool returns a pool of the given number of clients, all backed by
+// client.
+func newFakePool(workers int, client kubernetes.Interface) *pool {
+	p := &pool{availableC: make(chan kubernetes.Interface, workers), namespace: "default"}
+	for i := 0; i < workers; i++ {
+		p.availableC <- client
+	}
+	return p
+}
+
+// runPods returns the pending pods of a run, and their names.
+func runPods(runID string, n int) (pods []*v1.Pod, names []string) {
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("tg-plan-%s-group-%d", runID, i)
+		pods = append(pods, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"testground.run_id": runID},
+			},
+			Status: v1.PodStatus{Phase: v1.PodPending},
+		})
+		names = append(names, name)
+	}
+	return pods, names
+}
+
+// fakePodLogs replaces the log streams of pods with one that emits a
+// successful finish event after a while, unless ctx is done first. It returns
+// a function that restores the original streams.
+func fakePodLogs(delay time.Duration) (restore func()) {
+	prev := streamPodLogs
+	streamPodLogs = func(ctx context.Context, _ kubernetes.Interface, _, _ string) (io.ReadCloser, error) {
+		r, w := io.Pipe()
+		go func() {
+			select {
+			case <-time.After(delay):
+				_, _ = io.WriteString(w, `{"ts": 1, "event": {"type": "finish", "outcome": "ok"}}`+"\n")
+				_ = w.Close()
+			case <-ctx.Done():
+				_ = w.CloseWithError(ctx.Err())
+			}
+		}()
+		return r, nil
+	}
+	return func() { streamPodLogs = prev }
+}
+
+// finishRecorder records the outcomes of the instance-finish events written to
+// it, by instance.
+type finishRecorder struct {
+	lk       sync.Mutex
+	outcomes map[string]string
+	errors   map[string]string
+}
+
+func newFinishRecorder() *finishRecorder {
+	return &finishRecorder{outcomes: make(map[string]string), errors: make(map[string]string)}
+}
+
+func (r *finishRecorder) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (r *finishRecorder) WriteEvent(evt *api.Event) error {
+	if evt.Type != api.EventTypeInstanceFinish {
+		return nil
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	r.outcomes[evt.Instance.Instance] = evt.Instance.Outcome
+	r.errors[evt.Instance.Instance] = evt.Instance.Error
+	return nil
+}
+
+func setPodPhase(t *testing.T, client kubernetes.Interface, pod *v1.Pod, phase v1.PodPhase) {
+	t.Helper()
+
+	pod = pod.DeepCopy()
+	pod.Status.Phase = phase
+	if _, err := client.CoreV1().Pods(pod.Namespace).UpdateStatus(pod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestK8sFollowRunLatePods(t *testing.T) {
+	// the logs of pods are still being written after they terminate.
+	defer fakePodLogs(3 * time.Second)()
+
+	var (
+		pods, names = runPods("run", 4)
+		client      = fake.NewSimpleClientset()
+		input       = &api.RunInput{RunID: "run", TotalInstances: len(pods)}
+	)
+	for _, p := range pods {
+		if _, err := client.CoreV1().Pods("default").Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pods start one after another while their followers are waiting; a
+	// single client must be enough to follow them all and monitor the run.
+	go func() {
+		for _, p := range pods {
+			time.Sleep(500 * time.Millisecond)
+			setPodPhase(t, client, p, v1.PodSucceeded)
+		}
+	}()
+
+	var (
+		rec   = newFinishRecorder()
+		errCh = make(chan error, 1)
+	)
+	go func() {
+		errCh <- followRun(context.Background(), newFakePool(1, client), logging.S(), input, names, 0, NewPrettyPrinter(rec))
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("expected all instances to succeed: %s", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("following the run did not complete")
+	}
+
+	// every instance must have reported its outcome; logs cut short are
+	// reported as incomplete.
+	for _, name := range names {
+		if outcome := rec.outcomes[name]; outcome != "ok" {
+			t.Errorf("expected instance %s to succeed, got outcome: %q", name, outcome)
+		}
+	}
+}
+
+func TestK8sFollowRunFailFast(t *testing.T) {
+	defer fakePodLogs(time.Second)()
+
+	var (
+		pods, names = runPods("stuck", 3)
+		client      = fake.NewSimpleClientset()
+		input       = &api.RunInput{RunID: "stuck", TotalInstances: len(pods)}
+	)
+
+	// the first pod runs; the others can't pull their image.
+	for i, p := range pods {
+		if i == 0 {
+			p.Status.Phase = v1.PodRunning
+		} else {
+			p.Status.ContainerStatuses = []v1.ContainerStatus{{
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "no such image"}},
+			}}
+		}
+		if _, err := client.CoreV1().Pods("default").Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		rec   = newFinishRecorder()
+		errCh = make(chan error, 1)
+	)
+	go func() {
+		errCh <- followRun(context.Background(), newFakePool(1, client), logging.S(), input, names, time.Millisecond, NewPrettyPrinter(rec))
+	}()
+
+	select {
+	case err := <-errCh:
+		if err == nil || !strings.Contains(err.Error(), "aborting run: 2 pods failed to start") {
+			t.Fatalf("expected the run to be aborted, got: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("the run was not aborted")
+	}
+
+	// the stuck pods are reported with their problem.
+	for _, name := range names[1:] {
+		if outcome, err := rec.outcomes[name], rec.errors[name]; outcome != "incomplete" || err != "ImagePullBackOff: no such image" {
+			t.Errorf("expected instance %s to be reported as stuck, got outcome %q, error %q", name, outcome, err)
+		}
+	}
+}
+
+func TestK8sRedisHost(t *testing.T) {
+	if host := (&ClusterK8sRunnerConfig{}).redisHost("team-a"); host != "redis-headless.team-a.svc.cluster.local" {
+		t.Errorf("expected the redis-headless service of the namespace, got %s", host)
+	}
+	if host := (&ClusterK8sRunnerConfig{RedisHost: "redis.testground"}).redisHost("team-a"); host != "redis.testground" {
+		t.Errorf("expected the configured redis host, got %s", host)
+	}
+}
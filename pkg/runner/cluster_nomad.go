@@ -0,0 +1,559 @@
+package runner
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/sdk/runtime"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+var (
+	_ api.Runner       = &ClusterNomadRunner{}
+	_ api.Teardownable = &ClusterNomadRunner{}
+)
+
+// nomadOutputsPath is where test instances write their outputs. It's the data
+// directory of the allocation, which Nomad keeps until the allocation is
+// garbage collected, and which we read through the Nomad API when collecting
+// outputs.
+const nomadOutputsPath = "/alloc/data"
+
+// ClusterNomadRunnerConfig is the configuration object of this runner. Boolean
+// values are expressed in a way that zero value (false) is the default setting.
+//
+// Fields tagged with `group:"yes"` can be set per group: log_level, cpu,
+// memory_mb.
+type ClusterNomadRunnerConfig struct {
+	// LogLevel sets the log level in the test containers (default: not set).
+	LogLevel string `toml:"log_level" group:"yes"`
+
+	// CPU is the CPU, in MHz, reserved for each instance (default: the Nomad
+	// default).
+	CPU int `toml:"cpu" group:"yes"`
+
+	// MemoryMB is the memory, in MB, reserved for each instance (default: the
+	// Nomad default).
+	MemoryMB int `toml:"memory_mb" group:"yes"`
+
+	// Background avoids tailing the output of the instances, and displaying it
+	// as log messages (default: false).
+	Background bool `toml:"background"`
+
+	// NomadAddr is the URL of the Nomad HTTP API (default: $NOMAD_ADDR, or
+	// "http://127.0.0.1:4646").
+	NomadAddr string `toml:"nomad_addr"`
+
+	// NomadToken is the ACL token to authenticate with (default: $NOMAD_TOKEN).
+	NomadToken string `toml:"nomad_token"`
+
+	// Region is the Nomad region to submit jobs to (default: the region of the
+	// agent).
+	Region string `toml:"region"`
+
+	// Datacenters are the datacenters jobs can be placed in (default: "dc1").
+	Datacenters []string `toml:"datacenters"`
+
+	// RedisHost is the address of the sync service, as reachable from the
+	// instances. Required.
+	RedisHost string `toml:"redis_host"`
+
+	// RedisPort is the port of the sync service (default: 6379).
+	RedisPort int `toml:"redis_port"`
+
+	// Sidecar indicates that the sidecar runs on the Nomad clients, and
+	// manages the instances of this run (default: false). See the USAGE docs.
+	Sidecar bool `toml:"sidecar"`
+
+	// DataNetwork is the docker network the sidecar attaches the instances to,
+	// as their data network. Only used if Sidecar = true.
+	DataNetwork string `toml:"data_network"`
+
+	// DataSubnet is the subnet of DataNetwork, in CIDR notation. Required if
+	// DataNetwork is set.
+	DataSubnet string `toml:"data_subnet"`
+
+	// KeepJob keeps the job registered once all instances have finished.
+	// Otherwise the job is stopped, but not purged, so that outputs can be
+	// collected until Nomad garbage collects it.
+	KeepJob bool `toml:"keep_job"`
+}
+
+// ClusterNomadRunner is a runner that submits a batch job per run to a Nomad
+// cluster, with a task group per composition group. Instances run on the
+// docker driver, so test plans must be built with a docker builder, and
+// pushed to a registry the Nomad clients can pull from.
+type ClusterNomadRunner struct{}
+
+// nomadJobID returns the ID of the Nomad job of a run. It's derived from the
+// run ID alone, so that the job can be found again to collect outputs or tear
+// the run down.
+func nomadJobID(runID string) string {
+	return "testground-" + runID
+}
+
+func nomadClientFromConfig(cfg *ClusterNomadRunnerConfig) *nomadClient {
+	addr, token := cfg.NomadAddr, cfg.NomadToken
+	if addr == "" {
+		addr = os.Getenv("NOMAD_ADDR")
+	}
+	if addr == "" {
+		addr = "http://127.0.0.1:4646"
+	}
+	if token == "" {
+		token = os.Getenv("NOMAD_TOKEN")
+	}
+	return newNomadClient(addr, token, cfg.Region)
+}
+
+func (*ClusterNomadRunner) Run(ctx context.Context, input *api.RunInput, ow io.Writer) (*api.RunOutput, error) {
+	var (
+		seq = input.Seq
+		log = logging.S().With("runner", "cluster:nomad", "run_id", input.RunID)
+		cfg = *input.RunnerConfig.(*ClusterNomadRunnerConfig)
+	)
+
+	// Sanity check.
+	if seq < 0 || seq >= len(input.TestPlan.TestCases) {
+		return nil, fmt.Errorf("invalid test case seq %d for plan %s", seq, input.TestPlan.Name)
+	}
+
+	if cfg.RedisHost == "" {
+		return nil, errors.New("redis_host is required by the cluster:nomad runner")
+	}
+
+	testcase := input.TestPlan.TestCases[seq]
+
+	// Build a runenv.
+	template := runtime.RunParams{
+		TestPlan:          input.TestPlan.Name,
+		TestCase:          testcase.Name,
+		TestRun:           input.RunID,
+		TestCaseSeq:       seq,
+		TestInstanceCount: input.TotalInstances,
+		TestSidecar:       cfg.Sidecar,
+		TestOutputsPath:   nomadOutputsPath,
+		// instances of a group share their configuration.
+		TestGroupInstanceIndex: -1,
+	}
+
+	// Without a data network, instances communicate over the network Nomad
+	// places them on, so any address is a data address.
+	datasn := "0.0.0.0/0"
+	if cfg.Sidecar && cfg.DataNetwork != "" {
+		datasn = cfg.DataSubnet
+	}
+	_, subnet, err := net.ParseCIDR(datasn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data_subnet %q: %w", datasn, err)
+	}
+	template.TestSubnet = &runtime.IPNet{IPNet: *subnet}
+
+	job, out, err := nomadJobSpec(input, &cfg, &template)
+	if err != nil {
+		return nil, err
+	}
+
+	cli := nomadClientFromConfig(&cfg)
+
+	log.Infow("registering nomad job", "job", job.ID, "groups", len(job.TaskGroups))
+
+	evalID, err := cli.register(ctx, job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register nomad job: %w", err)
+	}
+
+	// Stop the job when we're done, unless asked to keep it. The job isn't
+	// purged, so that outputs can still be collected.
+	defer func() {
+		if cfg.KeepJob || cfg.Background {
+			log.Info("skipping stopping the nomad job due to user request")
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+		defer cancel()
+		if err := cli.deregister(ctx, job.ID, false); err != nil {
+			log.Errorw("stopping the nomad job failed", "job", job.ID, "err", err)
+		}
+	}()
+
+	// Fail fast if the job can't be placed, rather than waiting forever for
+	// allocations that will never come.
+	if err := waitNomadPlacement(ctx, cli, evalID); err != nil {
+		return nil, err
+	}
+
+	log.Infow("nomad job placed", "job", job.ID)
+
+	if cfg.Background {
+		return out, nil
+	}
+
+	return out, tailNomadJob(ctx, cli, job, input.TotalInstances, ow)
+}
+
+// nomadJobSpec builds the Nomad job of a run: one task group per composition
+// group, each with as many allocations as the group has instances.
+func nomadJobSpec(input *api.RunInput, cfg *ClusterNomadRunnerConfig, template *runtime.RunParams) (*nomadJob, *api.RunOutput, error) {
+	testcase := input.TestPlan.TestCases[input.Seq]
+
+	dcs := cfg.Datacenters
+	if len(dcs) == 0 {
+		dcs = []string{"dc1"}
+	}
+
+	labels := map[string]string{
+		"testground.plan":     input.TestPlan.Name,
+		"testground.testcase": testcase.Name,
+		"testground.run_id":   input.RunID,
+	}
+
+	job := &nomadJob{
+		ID:          nomadJobID(input.RunID),
+		Name:        fmt.Sprintf("tg-%s-%s-%s", input.TestPlan.Name, testcase.Name, input.RunID),
+		Type:        "batch",
+		Region:      cfg.Region,
+		Datacenters: dcs,
+		Meta:        labels,
+	}
+
+	out := &api.RunOutput{RunID: input.RunID}
+
+	for _, g := range input.Groups {
+		gcfg := g.RunnerConfig.(*ClusterNomadRunnerConfig)
+
+		runenv := *template
+		runenv.TestGroupID = g.ID
+		runenv.TestGroupInstanceCount = g.Instances
+		runenv.TestInstanceParams = g.Parameters
+
+		env := runenv.ToEnvVars()
+		env["REDIS_HOST"] = cfg.RedisHost
+		if cfg.RedisPort != 0 {
+			env["REDIS_PORT"] = strconv.Itoa(cfg.RedisPort)
+		}
+		// Set the log level if provided in the group cfg.
+		if gcfg.LogLevel != "" {
+			env["LOG_LEVEL"] = gcfg.LogLevel
+		}
+
+		glabels := map[string]string{"testground.groupid": g.ID}
+		for k, v := range labels {
+			glabels[k] = v
+		}
+		if cfg.Sidecar && cfg.DataNetwork != "" {
+			// tells the sidecar which network to manage as the data network.
+			glabels["testground.data_network"] = cfg.DataNetwork
+		}
+
+		var (
+			res     *nomadResources
+			summary = make(map[string]string)
+		)
+		if gcfg.CPU < 0 || gcfg.MemoryMB < 0 {
+			return nil, nil, fmt.Errorf("invalid resources for group %s: cpu and memory_mb must not be negative", g.ID)
+		}
+		if gcfg.CPU > 0 || gcfg.MemoryMB > 0 {
+			res = &nomadResources{CPU: gcfg.CPU, MemoryMB: gcfg.MemoryMB}
+		}
+		if gcfg.CPU > 0 {
+			summary["cpu"] = fmt.Sprintf("%dMHz", gcfg.CPU)
+		}
+		if gcfg.MemoryMB > 0 {
+			summary["memory"] = fmt.Sprintf("%dMB", gcfg.MemoryMB)
+		}
+		out.Groups = append(out.Groups, api.GroupSummary{ID: g.ID, Instances: g.Instances, Resources: summary})
+
+		job.TaskGroups = append(job.TaskGroups, &nomadTaskGroup{
+			Name:  g.ID,
+			Count: g.Instances,
+			Meta:  glabels,
+			// instances run once; a failed instance fails the run.
+			RestartPolicy:    &nomadRestartPolicy{Attempts: 0, Mode: "fail"},
+			ReschedulePolicy: &nomadReschedulePolicy{Attempts: 0, Unlimited: false},
+			Tasks: []*nomadTask{{
+				Name:   g.ID,
+				Driver: "docker",
+				Config: map[string]interface{}{
+					"image":  g.ArtifactPath,
+					"labels": []map[string]string{glabels},
+				},
+				Env:       env,
+				Resources: res,
+			}},
+		})
+	}
+
+	return job, out, nil
+}
+
+// waitNomadPlacement waits for the evaluation triggered by registering a job
+// to complete, and errors if any task group couldn't be placed.
+func waitNomadPlacement(ctx context.Context, cli *nomadClient, evalID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+	defer cancel()
+
+	for {
+		eval, err := cli.evaluation(ctx, evalID)
+		if err != nil {
+			return fmt.Errorf("failed to get the nomad evaluation: %w", err)
+		}
+
+		switch eval.Status {
+		case "pending":
+		case "complete":
+			if len(eval.FailedTGAllocs) == 0 {
+				return nil
+			}
+			var merr *multierror.Error
+			for tg, m := range eval.FailedTGAllocs {
+				merr = multierror.Append(merr, fmt.Errorf("group %s: %d nodes evaluated, exhausted: %v, filtered: %v",
+					tg, m.NodesEvaluated, m.DimensionExhausted, m.ConstraintFiltered))
+			}
+			return fmt.Errorf("nomad couldn't place the job: %w", merr)
+		default:
+			return fmt.Errorf("nomad evaluation %s ended with status %s", evalID, eval.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for nomad to place the job: %w", ctx.Err())
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// tailNomadJob streams the logs of all allocations of the job as they start,
+// until all instances have finished. It errors if any instance failed.
+func tailNomadJob(ctx context.Context, cli *nomadClient, job *nomadJob, total int, ow io.Writer) error {
+	var (
+		log    = logging.S().With("runner", "cluster:nomad", "job", job.ID)
+		pretty = NewPrettyPrinter(ow)
+		seen   = make(map[string]struct{}, total)
+	)
+
+	// streams are closed once all instances have finished.
+	sctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tick := time.NewTicker(2 * time.Second)
+	defer tick.Stop()
+
+	for {
+		allocs, err := cli.allocations(ctx, job.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list allocations: %w", err)
+		}
+
+		var finished int
+		status := make(map[string]int)
+		for _, a := range allocs {
+			status[a.ClientStatus]++
+			if a.terminal() {
+				finished++
+			}
+
+			if _, ok := seen[a.ID]; ok {
+				continue
+			}
+			ts, ok := a.TaskStates[a.TaskGroup]
+			if !ok {
+				continue
+			}
+
+			id := a.ID[:8]
+			switch {
+			case !ts.StartedAt.IsZero():
+				seen[a.ID] = struct{}{}
+				stdout := followNomadLogs(sctx, cli, a.ID, a.TaskGroup, "stdout")
+				stderr := followNomadLogs(sctx, cli, a.ID, a.TaskGroup, "stderr")
+				pretty.Manage(id, stdout, stderr)
+			case ts.Failed:
+				seen[a.ID] = struct{}{}
+				var msg string
+				if n := len(ts.Events); n > 0 {
+					msg = ts.Events[n-1].DisplayMessage
+				}
+				pretty.FailStart(id, msg)
+			}
+		}
+
+		log.Infow("allocation status", "status", status)
+
+		if finished >= total {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+
+	// Give the log streams a moment to drain, then close them.
+	time.AfterFunc(5*time.Second, cancel)
+	return pretty.Wait()
+}
+
+// followNomadLogs follows a log stream of a task. The returned stream ends
+// when ctx is done.
+func followNomadLogs(ctx context.Context, cli *nomadClient, allocID, task, typ string) io.ReadCloser {
+	rpipe, wpipe := io.Pipe()
+	go func() {
+		rc, err := cli.logs(ctx, allocID, task, typ)
+		if err != nil {
+			// a canceled context just means we're done.
+			if ctx.Err() != nil {
+				err = nil
+			}
+			_ = wpipe.CloseWithError(err)
+			return
+		}
+		defer rc.Close()
+
+		var once sync.Once
+		stop := func() { once.Do(func() { _ = wpipe.Close() }) }
+		go func() {
+			<-ctx.Done()
+			stop()
+			_ = rc.Close()
+		}()
+
+		_, _ = io.Copy(wpipe, rc)
+		stop()
+	}()
+	return rpipe
+}
+
+// TeardownRun purges the Nomad job of the run, along with its allocations.
+func (*ClusterNomadRunner) TeardownRun(ctx context.Context, input *api.TeardownInput) (*api.TeardownOutput, error) {
+	var (
+		log = logging.S().With("runner", "cluster:nomad", "run_id", input.RunID)
+		cfg = input.RunnerConfig.(*ClusterNomadRunnerConfig)
+		cli = nomadClientFromConfig(cfg)
+		id  = nomadJobID(input.RunID)
+		out = new(api.TeardownOutput)
+	)
+
+	ids, err := cli.jobs(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nomad jobs: %w", err)
+	}
+
+	for _, j := range ids {
+		if j != id {
+			continue
+		}
+		log.Infow("purging nomad job", "job", j)
+		if err := cli.deregister(ctx, j, true); err != nil {
+			return out, fmt.Errorf("failed to purge nomad job %s: %w", j, err)
+		}
+		out.Removed = append(out.Removed, "job "+j)
+	}
+	return out, nil
+}
+
+// CollectOutputs zips the outputs of all allocations of the run, as
+// <run_id>/<group_id>/<instance_number>/..., reading them through the Nomad
+// API. Outputs are available until Nomad garbage collects the allocations.
+func (*ClusterNomadRunner) CollectOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
+	cfg, ok := input.RunnerConfig.(*ClusterNomadRunnerConfig)
+	if !ok {
+		return fmt.Errorf("expected configuration type ClusterNomadRunnerConfig, was: %T", input.RunnerConfig)
+	}
+
+	cli := nomadClientFromConfig(cfg)
+
+	allocs, err := cli.allocations(ctx, nomadJobID(input.RunID))
+	if err != nil {
+		return fmt.Errorf("run ID %s not found with runner %s: %w", input.RunID, input.RunnerID, err)
+	}
+
+	wz := zip.NewWriter(w)
+	defer wz.Close()
+
+	for _, a := range allocs {
+		dir := path.Join(input.RunID, a.TaskGroup, nomadAllocIndex(a.Name))
+		if err := zipNomadDir(ctx, cli, wz, a.ID, nomadOutputsPath, dir); err != nil {
+			return fmt.Errorf("failed to collect outputs of allocation %s: %w", a.ID, err)
+		}
+	}
+	return wz.Flush()
+}
+
+// zipNomadDir recursively adds the files under src in the allocation to the
+// zip archive, under dst.
+func zipNomadDir(ctx context.Context, cli *nomadClient, wz *zip.Writer, allocID, src, dst string) error {
+	if _, err := wz.Create(dst + "/"); err != nil {
+		return err
+	}
+
+	files, err := cli.ls(ctx, allocID, src)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		var (
+			s = path.Join(src, f.Name)
+			d = path.Join(dst, f.Name)
+		)
+		if f.IsDir {
+			if err := zipNomadDir(ctx, cli, wz, allocID, s, d); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := cli.cat(ctx, allocID, s)
+		if err != nil {
+			return err
+		}
+		fw, err := wz.CreateHeader(&zip.FileHeader{Name: d, Method: zip.Deflate})
+		if err == nil {
+			_, err = io.Copy(fw, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nomadAllocIndex extracts the index of an allocation within its task group
+// from its name, e.g. "testground-abc.group[3]" yields "3".
+func nomadAllocIndex(name string) string {
+	i := strings.LastIndex(name, "[")
+	if i < 0 || !strings.HasSuffix(name, "]") {
+		return name
+	}
+	return name[i+1 : len(name)-1]
+}
+
+func (*ClusterNomadRunner) ID() string {
+	return "cluster:nomad"
+}
+
+func (*ClusterNomadRunner) ConfigType() reflect.Type {
+	return reflect.TypeOf(ClusterNomadRunnerConfig{})
+}
+
+func (*ClusterNomadRunner) CompatibleBuilders() []string {
+	return []string{"docker:go", "docker:generic"}
+}
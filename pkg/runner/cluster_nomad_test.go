@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/sdk/runtime"
+)
+
+func TestNomadJobSpec(t *testing.T) {
+	cfg := &ClusterNomadRunnerConfig{RedisHost: "redis.service.consul", Sidecar: true, DataNetwork: "tg-data"}
+	input := &api.RunInput{
+		RunID:          "a1b2c3",
+		TotalInstances: 3,
+		TestPlan: &api.TestPlanDefinition{
+			Name:      "dht",
+			TestCases: []*api.TestCase{{Name: "find-peers"}},
+		},
+		Groups: []api.RunGroup{
+			{ID: "seeds", Instances: 1, ArtifactPath: "img:1", RunnerConfig: &ClusterNomadRunnerConfig{LogLevel: "debug", MemoryMB: 512}},
+			{ID: "leechers", Instances: 2, ArtifactPath: "img:2", RunnerConfig: &ClusterNomadRunnerConfig{}},
+		},
+	}
+
+	job, out, err := nomadJobSpec(input, cfg, &runtime.RunParams{TestRun: input.RunID, TestSidecar: true, TestSubnet: &runtime.IPNet{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.ID != "testground-a1b2c3" || job.Type != "batch" {
+		t.Fatalf("unexpected job: %s (%s)", job.ID, job.Type)
+	}
+	if len(job.TaskGroups) != 2 || len(out.Groups) != 2 {
+		t.Fatalf("expected 2 task groups and summaries; got %d and %d", len(job.TaskGroups), len(out.Groups))
+	}
+
+	seeds, leechers := job.TaskGroups[0], job.TaskGroups[1]
+	if seeds.Count != 1 || leechers.Count != 2 {
+		t.Errorf("unexpected counts: %d, %d", seeds.Count, leechers.Count)
+	}
+
+	task := seeds.Tasks[0]
+	if task.Env["REDIS_HOST"] != "redis.service.consul" || task.Env["LOG_LEVEL"] != "debug" || task.Env["TEST_GROUP_ID"] != "seeds" {
+		t.Errorf("unexpected env: %v", task.Env)
+	}
+	if task.Resources == nil || task.Resources.MemoryMB != 512 || out.Groups[0].Resources["memory"] != "512MB" {
+		t.Errorf("unexpected resources: %+v, %v", task.Resources, out.Groups[0].Resources)
+	}
+	if _, ok := leechers.Tasks[0].Env["LOG_LEVEL"]; ok || leechers.Tasks[0].Resources != nil {
+		t.Errorf("group config leaked across groups")
+	}
+	if seeds.Meta["testground.data_network"] != "tg-data" || seeds.Meta["testground.run_id"] != "a1b2c3" {
+		t.Errorf("unexpected labels: %v", seeds.Meta)
+	}
+}
+
+func TestNomadAllocIndex(t *testing.T) {
+	for name, idx := range map[string]string{
+		"testground-a1b2c3.seeds[0]":  "0",
+		"testground-a1b2c3.seeds[12]": "12",
+		"testground-a1b2c3.seeds[0]x": "testground-a1b2c3.seeds[0]x",
+		"testground-a1b2c3.leechers":  "testground-a1b2c3.leechers",
+	} {
+		if got := nomadAllocIndex(name); got != idx {
+			t.Errorf("nomadAllocIndex(%q) = %q; expected %q", name, got, idx)
+		}
+	}
+}
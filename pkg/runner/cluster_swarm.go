@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ipfs/testground/pkg/api"
@@ -18,21 +21,70 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hashicorp/go-multierror"
 )
 
 var (
-	_ api.Runner = &ClusterSwarmRunner{}
+	_ api.Runner       = &ClusterSwarmRunner{}
+	_ api.Teardownable = &ClusterSwarmRunner{}
 )
 
+// swarmOutputsPath is where the outputs volume is mounted in the instances.
+const swarmOutputsPath = "/outputs"
+
 // ClusterSwarmRunnerConfig is the configuration object of this runner. Boolean
 // values are expressed in a way that zero value (false) is the default setting.
+//
+// Fields tagged with `group:"yes"` can be set per group: log_level, and the
+// placement, resources and restart policy of the tasks.
 type ClusterSwarmRunnerConfig struct {
 	// LogLevel sets the log level in the test containers (default: not set).
-	LogLevel string `toml:"log_level"`
+	LogLevel string `toml:"log_level" group:"yes"`
+
+	// PlacementConstraints restrict the nodes the tasks can be placed on, e.g.
+	// "node.labels.region==eu" (default: "node.labels.TGRole==worker").
+	PlacementConstraints []string `toml:"placement_constraints" group:"yes"`
+
+	// PlacementPreferences spread the tasks evenly over the values of node
+	// labels, in order, e.g. "node.labels.zone" (default: not set).
+	PlacementPreferences []string `toml:"placement_preferences" group:"yes"`
+
+	// MaxReplicasPerNode is the maximum number of tasks on a single node
+	// (default: 10000).
+	MaxReplicasPerNode uint64 `toml:"max_replicas_per_node" group:"yes"`
+
+	// CPULimit is the number of CPUs each task can use, e.g. 0.5 (default:
+	// unlimited).
+	CPULimit float64 `toml:"cpu_limit" group:"yes"`
+
+	// CPUReservation is the number of CPUs reserved for each task when placing
+	// it (default: not set).
+	CPUReservation float64 `toml:"cpu_reservation" group:"yes"`
+
+	// MemoryLimit is the memory limit of each task, e.g. "512MiB" (default:
+	// "30MiB", or MemoryReservation if greater).
+	MemoryLimit string `toml:"memory_limit" group:"yes"`
+
+	// MemoryReservation is the memory reserved for each task when placing it,
+	// e.g. "256MiB" (default: "60MiB", or MemoryLimit if lower).
+	MemoryReservation string `toml:"memory_reservation" group:"yes"`
+
+	// RestartPolicy is when swarm restarts the tasks: "none", "on-failure" or
+	// "any" (default: "none").
+	RestartPolicy string `toml:"restart_policy" group:"yes"`
+
+	// RestartMaxAttempts is the maximum number of restarts of a task (default:
+	// unlimited). Only used if RestartPolicy is not "none".
+	RestartMaxAttempts uint64 `toml:"restart_max_attempts" group:"yes"`
+
+	// RestartDelay is the delay between restarts of a task, e.g. "5s" (default:
+	// swarm's). Only used if RestartPolicy is not "none".
+	RestartDelay string `toml:"restart_delay" group:"yes"`
 
 	// Background avoids tailing the output of containers, and displaying it as
 	// log messages (default: true).
@@ -60,6 +112,75 @@ type ClusterSwarmRunnerConfig struct {
 	// all logs have been piped. Only used when running in foreground mode
 	// (default is background mode).
 	KeepService bool `toml:"keep_service"`
+
+	// OutputsVolume is the docker volume instances write their outputs to,
+	// mounted at /outputs. For outputs to be collected, it must be shared by
+	// all nodes, e.g. an NFS volume, or a volume plugin backed by an object
+	// store (default: not set; outputs are discarded).
+	OutputsVolume string `toml:"outputs_volume"`
+
+	// OutputsVolumeDriver is the driver of OutputsVolume (default: "local").
+	OutputsVolumeDriver string `toml:"outputs_volume_driver"`
+
+	// OutputsVolumeOptions are the driver options of OutputsVolume, used by
+	// each node to create the volume if it doesn't exist.
+	OutputsVolumeOptions map[string]string `toml:"outputs_volume_options"`
+
+	// OutputsStore is where the daemon reads the outputs from when collecting
+	// them: "fs" reads OutputsDir, where OutputsVolume is mounted on the
+	// daemon host; "s3" reads OutputsBucket, the bucket backing OutputsVolume
+	// (default: "fs").
+	OutputsStore string `toml:"outputs_store"`
+
+	// OutputsDir is the directory OutputsVolume is mounted at on the daemon
+	// host. Only used if OutputsStore = "fs".
+	OutputsDir string `toml:"outputs_dir"`
+
+	// OutputsBucket is the bucket backing OutputsVolume. Only used if
+	// OutputsStore = "s3".
+	OutputsBucket string `toml:"outputs_bucket"`
+
+	// OutputsBucketRegion is the region of OutputsBucket.
+	OutputsBucketRegion string `toml:"outputs_bucket_region"`
+
+	// OutputsEndpoint is the endpoint of an S3-compatible store, e.g. MinIO
+	// (default: AWS S3).
+	OutputsEndpoint string `toml:"outputs_endpoint"`
+}
+
+// outputsStore returns the store to collect outputs from.
+func (c *ClusterSwarmRunnerConfig) outputsStore() (outputsStore, error) {
+	switch c.OutputsStore {
+	case "", "fs":
+		if c.OutputsDir == "" {
+			return nil, errors.New("outputs_dir is required to collect outputs from the fs store")
+		}
+		return &fsOutputsStore{dir: c.OutputsDir, rename: slotToIndex}, nil
+	case "s3":
+		if c.OutputsBucket == "" {
+			return nil, errors.New("outputs_bucket is required to collect outputs from the s3 store")
+		}
+		return &s3OutputsStore{bucket: c.OutputsBucket, region: c.OutputsBucketRegion, endpoint: c.OutputsEndpoint, rename: slotToIndex}, nil
+	default:
+		return nil, fmt.Errorf("unknown outputs store %q; supported: fs, s3", c.OutputsStore)
+	}
+}
+
+// slotToIndex renames an entry of the outputs archive of a swarm run,
+// <run_id>/<group_id>/<task_slot>/..., after the 0-based index of the instance
+// in its group, as the other runners do. Swarm task slots are 1-based, and
+// can't be shifted in the template of the outputs path.
+func slotToIndex(name string) string {
+	parts := strings.SplitN(name, "/", 4)
+	if len(parts) < 3 {
+		return name
+	}
+	slot, err := strconv.Atoi(parts[2])
+	if err != nil || slot < 1 {
+		return name
+	}
+	parts[2] = strconv.Itoa(slot - 1)
+	return strings.Join(parts, "/")
 }
 
 // ClusterSwarmRunner is a runner that creates a Docker service to launch as
@@ -98,16 +219,12 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		TestCaseSeq:       seq,
 		TestInstanceCount: input.TotalInstances,
 		TestSidecar:       true,
+		// instances of a group share their configuration.
+		TestGroupInstanceIndex: -1,
 	}
 
 	// Create a docker client.
-	var opts []client.Opt
-	if cfg.DockerTLS {
-		opts = append(opts, client.WithTLSClientConfig(cfg.DockerTLSCACertPath, cfg.DockerTLSCertPath, cfg.DockerTLSKeyPath))
-	}
-
-	opts = append(opts, client.WithHost(cfg.DockerEndpoint), client.WithAPIVersionNegotiation())
-	cli, err := client.NewClientWithOpts(opts...)
+	cli, err := newSwarmClient(&cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -172,6 +289,16 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 	networkID := networkResp.ID
 	log.Infow("network created successfully", "id", networkID)
 
+	api.WriteEvent(ow, &api.Event{
+		Type: api.EventTypeNetworkConfigured,
+		Network: &api.NetworkEvent{
+			RunID:   input.RunID,
+			Name:    "default",
+			Subnet:  subnet.String(),
+			Gateway: gateway,
+		},
+	})
+
 	defer func() {
 		if cfg.KeepService || cfg.Background {
 			log.Info("skipping removing the data network due to user request")
@@ -199,25 +326,59 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 
 	logging.S().Infof("fetched an authorization token from AWS ECR")
 
-	services := make(map[string]int, len(input.Groups))
+	var (
+		out = &api.RunOutput{RunID: input.RunID, Groups: make([]api.GroupSummary, 0, len(input.Groups))}
+		// services maps the IDs of the services to the indices of their
+		// groups in out.Groups.
+		services = make(map[string]int, len(input.Groups))
+	)
 	for _, g := range input.Groups {
+		gcfg := g.RunnerConfig.(*ClusterSwarmRunnerConfig)
+
+		settings, err := gcfg.taskSettings()
+		if err != nil {
+			return nil, fmt.Errorf("invalid task settings for group %s: %w", g.ID, err)
+		}
+		log.Infow("task settings of group", "group", g.ID, "constraints", settings.placement.Constraints, "resources", settings.summary, "restart", settings.restart.Condition)
+
 		runenv := template
 		runenv.TestGroupID = g.ID
 		runenv.TestGroupInstanceCount = g.Instances
 		runenv.TestInstanceParams = g.Parameters
 
+		// Each instance writes its outputs to its own directory of the shared
+		// volume. Swarm expands the task slot template when creating the task.
+		// Slots are 1-based; they're mapped to instance indices on collection
+		// (see slotToIndex).
+		var mounts []mount.Mount
+		if cfg.OutputsVolume != "" {
+			runenv.TestOutputsPath = path.Join(swarmOutputsPath, input.TestPlan.Name, input.RunID, g.ID, "{{.Task.Slot}}")
+			mounts = append(mounts, mount.Mount{
+				Type:   mount.TypeVolume,
+				Source: cfg.OutputsVolume,
+				Target: swarmOutputsPath,
+				VolumeOptions: &mount.VolumeOptions{
+					DriverConfig: &mount.Driver{
+						Name:    cfg.OutputsVolumeDriver,
+						Options: cfg.OutputsVolumeOptions,
+					},
+				},
+			})
+		}
+
 		// Serialize the runenv into env variables to pass to docker.
 		env := conv.ToOptionsSlice(runenv.ToEnvVars())
 
-		// Set the log level if provided in cfg.
-		if cfg.LogLevel != "" {
-			env = append(env, "LOG_LEVEL="+cfg.LogLevel)
+		// Set the log level if provided in the group cfg.
+		if gcfg.LogLevel != "" {
+			env = append(env, "LOG_LEVEL="+gcfg.LogLevel)
 		}
 
 		// Create the service.
 		log.Infow("creating service", "parent", parent, "group", g.ID, "image", g.ArtifactPath, "replicas", g.Instances)
 
 		cnt := (uint64)(runenv.TestGroupInstanceCount)
+		name := parent + "-" + g.ID
 		serviceSpec := swarm.ServiceSpec{
 			Networks: []swarm.NetworkAttachmentConfig{
 				{Target: "control"},
@@ -228,11 +389,20 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 					Replicas: &cnt,
 				},
 			},
-			Annotations: swarm.Annotations{Name: parent},
+			Annotations: swarm.Annotations{
+				Name: name,
+				Labels: map[string]string{
+					"testground.plan":     input.TestPlan.Name,
+					"testground.testcase": testcase.Name,
+					"testground.run_id":   input.RunID,
+					"testground.groupid":  g.ID,
+				},
+			},
 			TaskTemplate: swarm.TaskSpec{
 				ContainerSpec: &swarm.ContainerSpec{
-					Image: g.ArtifactPath,
-					Env:   env,
+					Image:  g.ArtifactPath,
+					Env:    env,
+					Mounts: mounts,
 					Labels: map[string]string{
 						"testground.plan":     input.TestPlan.Name,
 						"testground.testcase": testcase.Name,
@@ -240,23 +410,9 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 						"testground.groupid":  g.ID,
 					},
 				},
-				RestartPolicy: &swarm.RestartPolicy{
-					Condition: swarm.RestartPolicyConditionNone,
-				},
-				Resources: &swarm.ResourceRequirements{
-					Reservations: &swarm.Resources{
-						MemoryBytes: 60 * 1024 * 1024,
-					},
-					Limits: &swarm.Resources{
-						MemoryBytes: 30 * 1024 * 1024,
-					},
-				},
-				Placement: &swarm.Placement{
-					MaxReplicas: 10000,
-					Constraints: []string{
-						"node.labels.TGRole==worker",
-					},
-				},
+				RestartPolicy: settings.restart,
+				Resources:     settings.resources,
+				Placement:     settings.placement,
 			},
 		}
 
@@ -267,7 +423,7 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 			EncodedRegistryAuth: aws.ECR.EncodeAuthToken(auth),
 		}
 
-		logging.S().Infow("creating the service on docker swarm", "parent", parent, "group", g.ID, "image", g.ArtifactPath, "replicas", g.Instances)
+		logging.S().Infow("creating the service on docker swarm", "name", name, "group", g.ID, "image", g.ArtifactPath, "replicas", g.Instances)
 
 		// Now create the docker swarm service.
 		serviceResp, err := cli.ServiceCreate(ctx, serviceSpec, scopts)
@@ -277,14 +433,17 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 
 		logging.S().Infow("service created successfully", "id", serviceResp.ID)
 
-		services[serviceResp.ID] = g.Instances
+		out.Groups = append(out.Groups, api.GroupSummary{ID: g.ID, Instances: g.Instances, Resources: settings.summary})
+		services[serviceResp.ID] = len(out.Groups) - 1
 	}
 
 	// If we are running in background mode, return immediately.
 	if cfg.Background {
-		return &api.RunOutput{RunID: input.RunID}, nil
+		return out, nil
 	}
 
+	nodes := newSwarmNodes(cli)
+
 	// Docker multiplexes STDOUT and STDERR streams inside the single IO stream
 	// returned by ServiceLogs. We need to use docker functions to separate
 	// those strands, and because we don't care about treating STDOUT and STDERR
@@ -294,7 +453,7 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 	// Tail all services until all instances are done, then remove the service
 	// if the flag has been set.
 	errgrp, ctx := errgroup.WithContext(ctx)
-	for service, count := range services {
+	for service, idx := range services {
 		rc, err := cli.ServiceLogs(context.Background(), service, types.ContainerLogsOptions{
 			ShowStdout: true,
 			ShowStderr: true,
@@ -312,41 +471,14 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 			return err
 		})
 
-		// This goroutine monitors the state of tasks every two seconds. When all
-		// tasks are shutdown, we are done here. We close the logs io.ReadCloser,
-		// which in turns signals that the runner is now finished.
-		errgrp.Go(func(service string, count int) func() error {
-			return func() error {
-				tick := time.NewTicker(2 * time.Second)
-				defer tick.Stop()
-				defer rc.Close()
-
-				for range tick.C {
-					var finished int
-					tasks, err := cli.TaskList(ctx, types.TaskListOptions{
-						Filters: filters.NewArgs(filters.Arg("service", service)),
-					})
-
-					if err != nil {
-						return err
-					}
-
-					status := make(map[swarm.TaskState]uint64, count)
-					for _, t := range tasks {
-						s := t.Status.State
-						switch status[s]++; s {
-						case swarm.TaskStateShutdown, swarm.TaskStateComplete, swarm.TaskStateFailed, swarm.TaskStateRejected:
-							finished++
-						}
-					}
-					logging.S().Infow("task status", "service", service, "status", status)
-					if finished == count {
-						break
-					}
-				}
-				return nil
-			}
-		}(service, count))
+		// This goroutine monitors the state of the tasks of the service. When
+		// all tasks are shutdown, we are done here. We close the logs
+		// io.ReadCloser, which in turns signals that the runner is now finished.
+		service, summary := service, &out.Groups[idx]
+		errgrp.Go(func() error {
+			defer rc.Close()
+			return monitorSwarmService(ctx, cli, nodes, service, summary, 2*time.Second)
+		})
 
 		go func() {
 			err := errgrp.Wait()
@@ -376,11 +508,89 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow io.W
 		log.Info("skipping removing the service due to user request")
 	}
 
-	return &api.RunOutput{RunID: input.RunID}, nil
+	return out, nil
 }
 
+// TeardownRun removes all services and networks labelled with the run ID.
+func (*ClusterSwarmRunner) TeardownRun(ctx context.Context, input *api.TeardownInput) (*api.TeardownOutput, error) {
+	var (
+		log = logging.S().With("runner", "cluster:swarm", "run_id", input.RunID)
+		cfg = input.RunnerConfig.(*ClusterSwarmRunnerConfig)
+	)
+
+	cli, err := newSwarmClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out    = new(api.TeardownOutput)
+		merr   *multierror.Error
+		filter = filters.NewArgs(filters.Arg("label", "testground.run_id="+input.RunID))
+	)
+
+	services, err := cli.ServiceList(ctx, types.ServiceListOptions{Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	for _, s := range services {
+		log.Infow("removing service", "name", s.Spec.Name)
+		if err := cli.ServiceRemove(ctx, s.ID); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to remove service %s: %w", s.Spec.Name, err))
+			continue
+		}
+		out.Removed = append(out.Removed, "service "+s.Spec.Name)
+	}
+
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: filter})
+	if err != nil {
+		return out, multierror.Append(merr, fmt.Errorf("failed to list networks: %w", err)).ErrorOrNil()
+	}
+
+	for _, n := range networks {
+		log.Infow("removing network", "name", n.Name)
+
+		// tasks of the removed services take a while to shut down, and the
+		// network can't be removed while they're attached.
+		err := retry(10, 2*time.Second, func() error {
+			return cli.NetworkRemove(ctx, n.ID)
+		})
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to remove network %s: %w", n.Name, err))
+			continue
+		}
+		out.Removed = append(out.Removed, "network "+n.Name)
+	}
+
+	return out, merr.ErrorOrNil()
+}
+
+// newSwarmClient creates a docker client connected to the swarm manager
+// specified in the configuration.
+func newSwarmClient(cfg *ClusterSwarmRunnerConfig) (*client.Client, error) {
+	var opts []client.Opt
+	if cfg.DockerTLS {
+		opts = append(opts, client.WithTLSClientConfig(cfg.DockerTLSCACertPath, cfg.DockerTLSCertPath, cfg.DockerTLSKeyPath))
+	}
+
+	opts = append(opts, client.WithHost(cfg.DockerEndpoint), client.WithAPIVersionNegotiation())
+	return client.NewClientWithOpts(opts...)
+}
+
+// CollectOutputs zips the outputs of the run from the configured outputs
+// store.
 func (*ClusterSwarmRunner) CollectOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
-	return errors.New("unimplemented")
+	cfg, ok := input.RunnerConfig.(*ClusterSwarmRunnerConfig)
+	if !ok {
+		return fmt.Errorf("expected configuration type ClusterSwarmRunnerConfig, was: %T", input.RunnerConfig)
+	}
+
+	store, err := cfg.outputsStore()
+	if err != nil {
+		return err
+	}
+	return store.zipRunOutputs(ctx, input, w)
 }
 
 func (*ClusterSwarmRunner) ID() string {
@@ -392,7 +602,7 @@ func (*ClusterSwarmRunner) ConfigType() reflect.Type {
 }
 
 func (*ClusterSwarmRunner) CompatibleBuilders() []string {
-	return []string{"docker:go"}
+	return []string{"docker:go", "docker:generic"}
 }
 
 func retry(attempts int, sleep time.Duration, f func() error) (err error) {
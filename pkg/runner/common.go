@@ -37,6 +37,12 @@ func nextDataNetwork(lenNetworks int) (*net.IPNet, string, error) {
 }
 
 func zipRunOutputs(ctx context.Context, basedir string, input *api.CollectionInput, w io.Writer) error {
+	return zipRunOutputsAs(ctx, basedir, input, nil, w)
+}
+
+// zipRunOutputsAs is like zipRunOutputs, but names the archive entries with
+// rename, if not nil.
+func zipRunOutputsAs(ctx context.Context, basedir string, input *api.CollectionInput, rename func(string) string, w io.Writer) error {
 	pattern := filepath.Join(basedir, "*", input.RunID)
 
 	matches, err := filepath.Glob(pattern)
@@ -76,6 +82,9 @@ func zipRunOutputs(ctx context.Context, basedir string, input *api.CollectionInp
 		}
 
 		header.Name = filepath.Join(base, strings.TrimPrefix(path, dir))
+		if rename != nil {
+			header.Name = rename(header.Name)
+		}
 		if info.IsDir() {
 			header.Name += "/"
 		} else {
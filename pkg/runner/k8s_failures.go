@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// podStartFailures are the reasons a container waits with when it can't be
+// started, and won't be without intervention.
+var podStartFailures = map[string]struct{}{
+	"ErrImagePull":               {},
+	"ImagePullBackOff":           {},
+	"InvalidImageName":           {},
+	"CreateContainerConfigError": {},
+	"CreateContainerError":       {},
+	"RunContainerError":          {},
+	"CrashLoopBackOff":           {},
+}
+
+// podProblem returns why the pod is failing to start, or an empty string if
+// it's starting or running normally.
+func podProblem(pod *v1.Pod) string {
+	if pod.Status.Phase == v1.PodPending {
+		for _, c := range pod.Status.Conditions {
+			if c.Type == v1.PodScheduled && c.Status == v1.ConditionFalse && c.Reason == v1.PodReasonUnschedulable {
+				return fmt.Sprintf("unschedulable: %s", c.Message)
+			}
+		}
+	}
+
+	statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		w := cs.State.Waiting
+		if w == nil {
+			continue
+		}
+		if _, ok := podStartFailures[w.Reason]; ok {
+			if w.Message == "" {
+				return w.Reason
+			}
+			return fmt.Sprintf("%s: %s", w.Reason, w.Message)
+		}
+	}
+	return ""
+}
+
+// podFailure returns why a failed pod terminated, e.g. "OOMKilled", or an
+// empty string if the pod hasn't failed.
+func podFailure(pod *v1.Pod) string {
+	if pod.Status.Phase != v1.PodFailed {
+		return ""
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			return fmt.Sprintf("%s (exit code %d)", t.Reason, t.ExitCode)
+		}
+	}
+	return pod.Status.Reason
+}
+
+// podProblems tracks the pods of a run that are failing to start, and since
+// when. It's safe for concurrent use.
+type podProblems struct {
+	lk       sync.Mutex
+	problems map[string]string
+	since    map[string]time.Time
+}
+
+func newPodProblems() *podProblems {
+	return &podProblems{
+		problems: make(map[string]string),
+		since:    make(map[string]time.Time),
+	}
+}
+
+// update records the current problem of the pod, or clears it if problem is
+// empty. It returns whether the problem is new.
+func (p *podProblems) update(pod, problem string) bool {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if problem == "" {
+		delete(p.problems, pod)
+		delete(p.since, pod)
+		return false
+	}
+
+	prev, ok := p.problems[pod]
+	p.problems[pod] = problem
+	if !ok {
+		p.since[pod] = time.Now()
+	}
+	return prev != problem
+}
+
+// get returns the current problem of the pod, if any.
+func (p *podProblems) get(pod string) string {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	return p.problems[pod]
+}
+
+// olderThan describes the problems of the pods that have been failing to start
+// for longer than d, ordered by pod name.
+func (p *podProblems) olderThan(d time.Duration) []string {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	var res []string
+	for pod, since := range p.since {
+		if time.Since(since) > d {
+			res = append(res, fmt.Sprintf("%s: %s", pod, p.problems[pod]))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
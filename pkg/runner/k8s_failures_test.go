@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestPodProblem(t *testing.T) {
+	waiting := func(reason, msg string) *v1.Pod {
+		return &v1.Pod{Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			ContainerStatuses: []v1.ContainerStatus{{
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason, Message: msg}},
+			}},
+		}}
+	}
+
+	unschedulable := &v1.Pod{Status: v1.PodStatus{
+		Phase: v1.PodPending,
+		Conditions: []v1.PodCondition{{
+			Type:    v1.PodScheduled,
+			Status:  v1.ConditionFalse,
+			Reason:  v1.PodReasonUnschedulable,
+			Message: "0/3 nodes are available: 3 Insufficient cpu.",
+		}},
+	}}
+
+	cases := []struct {
+		pod      *v1.Pod
+		expected string
+	}{
+		{waiting("ContainerCreating", ""), ""},
+		{waiting("ImagePullBackOff", "Back-off pulling image \"foo\""), "ImagePullBackOff: Back-off pulling image \"foo\""},
+		{waiting("CrashLoopBackOff", ""), "CrashLoopBackOff"},
+		{unschedulable, "unschedulable: 0/3 nodes are available: 3 Insufficient cpu."},
+		{&v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}}, ""},
+	}
+
+	for _, c := range cases {
+		if actual := podProblem(c.pod); actual != c.expected {
+			t.Errorf("expected problem %q; got %q", c.expected, actual)
+		}
+	}
+}
+
+func TestPodProblemsTracker(t *testing.T) {
+	p := newPodProblems()
+
+	if !p.update("a", "ErrImagePull") {
+		t.Error("expected first problem to be new")
+	}
+	if p.update("a", "ErrImagePull") {
+		t.Error("expected repeated problem not to be new")
+	}
+	if !p.update("a", "ImagePullBackOff") {
+		t.Error("expected changed problem to be new")
+	}
+	p.update("b", "CrashLoopBackOff")
+
+	time.Sleep(10 * time.Millisecond)
+	if stuck := p.olderThan(time.Hour); len(stuck) != 0 {
+		t.Errorf("expected no problems older than an hour; got %v", stuck)
+	}
+	stuck := p.olderThan(time.Millisecond)
+	if len(stuck) != 2 || !strings.HasPrefix(stuck[0], "a: ImagePullBackOff") {
+		t.Errorf("unexpected stuck pods: %v", stuck)
+	}
+
+	// a pod that recovers is no longer reported.
+	p.update("a", "")
+	if p.get("a") != "" || len(p.olderThan(time.Millisecond)) != 1 {
+		t.Error("expected recovered pod to be cleared")
+	}
+}
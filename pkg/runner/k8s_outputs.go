@@ -0,0 +1,202 @@
+package runner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// collectPVCOutputs reads the outputs of a run from the outputs volume claim.
+// It starts a collector pod that mounts the claim, and streams the outputs of
+// the run out of it as a tar archive, through the Kubernetes API, like
+// `kubectl cp` does. The archive is converted into a zip archive with the
+// layout of zipRunOutputs.
+func collectPVCOutputs(ctx context.Context, pool *pool, cfg *ClusterK8sRunnerConfig, input *api.CollectionInput, w io.Writer) error {
+	log := logging.S().With("runner", "cluster:k8s", "run_id", input.RunID)
+
+	if cfg.OutputsPVC == "" {
+		return fmt.Errorf("outputs_pvc is required by the pvc outputs backend")
+	}
+
+	client := pool.Acquire()
+	defer pool.Release(client)
+
+	image := cfg.OutputsCollectorImage
+	if image == "" {
+		image = "busybox"
+	}
+
+	// the name is suffixed so that concurrent collections of the same run get
+	// their own pods.
+	name := "tg-outputs-" + input.RunID + "-" + utilrand.String(5)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			// not labelled with the run ID; this pod is not part of the run.
+			Labels: map[string]string{"testground.outputs_of": input.RunID},
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy:      v1.RestartPolicyNever,
+			ServiceAccountName: cfg.ServiceAccount,
+			ImagePullSecrets:   imagePullSecrets(cfg.ImagePullSecrets),
+			Volumes: []v1.Volume{{
+				Name: "outputs",
+				VolumeSource: v1.VolumeSource{
+					PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: cfg.OutputsPVC, ReadOnly: true},
+				},
+			}},
+			Containers: []v1.Container{{
+				Name:         "collector",
+				Image:        image,
+				Command:      []string{"sleep", "3600"},
+				VolumeMounts: []v1.VolumeMount{{Name: "outputs", MountPath: "/outputs", ReadOnly: true}},
+			}},
+		},
+	}
+
+	log.Infow("starting outputs collector pod", "pod", name, "pvc", cfg.OutputsPVC)
+
+	if _, err := client.CoreV1().Pods(pool.namespace).Create(pod); err != nil {
+		return fmt.Errorf("failed to create outputs collector pod: %w", err)
+	}
+	defer func() {
+		if err := client.CoreV1().Pods(pool.namespace).Delete(name, &metav1.DeleteOptions{GracePeriodSeconds: int64Ptr(0)}); err != nil {
+			log.Errorw("couldn't remove outputs collector pod", "pod", name, "err", err)
+		}
+	}()
+
+	if err := waitPodRunning(ctx, client, pool.namespace, name, 2*time.Minute); err != nil {
+		return fmt.Errorf("outputs collector pod didn't start: %w", err)
+	}
+
+	var (
+		stderr       = new(bytes.Buffer)
+		rpipe, wpipe = io.Pipe()
+		command      = []string{"tar", "-cf", "-", "-C", "/outputs", input.RunID}
+	)
+	go func() {
+		err := execInPod(pool, client, name, "collector", command, wpipe, stderr)
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		_ = wpipe.CloseWithError(err)
+	}()
+	defer rpipe.Close()
+
+	if err := tarToZip(ctx, rpipe, w); err != nil {
+		return fmt.Errorf("failed to collect outputs of run %s: %w", input.RunID, err)
+	}
+	return nil
+}
+
+// execInPod runs the command in the container of the pod, like `kubectl exec`
+// does. It's a variable so that tests can replace it, as fake clientsets can't
+// exec.
+var execInPod = func(pool *pool, client kubernetes.Interface, pod, container string, command []string, stdout, stderr io.Writer) error {
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod).
+		Namespace(pool.namespace).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(pool.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to exec in pod %s: %w", pod, err)
+	}
+	return exec.Stream(remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr})
+}
+
+// waitPodRunning waits for the pod to be running, using the client the caller
+// acquired.
+func waitPodRunning(ctx context.Context, client kubernetes.Interface, namespace, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		pod, err := client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		switch pod.Status.Phase {
+		case v1.PodRunning:
+			return nil
+		case v1.PodSucceeded, v1.PodFailed:
+			return fmt.Errorf("pod terminated: %s", pod.Status.Phase)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// tarToZip converts the tar archive read from r into a zip archive written to
+// w, preserving the names of the entries.
+func tarToZip(ctx context.Context, r io.Reader, w io.Writer) (err error) {
+	var (
+		tr = tar.NewReader(r)
+		zw = zip.NewWriter(w)
+	)
+	// closing writes the central directory of the archive; an archive without
+	// it is truncated.
+	defer func() {
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := zw.Create(strings.TrimSuffix(hdr.Name, "/") + "/"); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			fh := &zip.FileHeader{Name: hdr.Name, Method: zip.Deflate}
+			fh.Modified = hdr.ModTime
+			zf, err := zw.CreateHeader(fh)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(zf, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
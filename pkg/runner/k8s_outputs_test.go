@@ -0,0 +1,189 @@
+package runner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTarToZip(t *testing.T) {
+	var (
+		buf   = new(bytes.Buffer)
+		tw    = tar.NewWriter(buf)
+		files = map[string]string{
+			"a1b2c3/seeds/0/run.out":    "seed",
+			"a1b2c3/leechers/0/run.out": "leech",
+		}
+	)
+	_ = tw.WriteHeader(&tar.Header{Name: "a1b2c3/", Typeflag: tar.TypeDir, Mode: 0755})
+	for name, content := range files {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		_, _ = tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := tarToZip(context.Background(), buf, out); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if files[f.Name] != string(b) {
+			t.Errorf("unexpected content for %s: %q", f.Name, b)
+		}
+		found++
+	}
+	if found != len(files) {
+		t.Errorf("expected %d files; got %d", len(files), found)
+	}
+}
+
+// centralDirFailer fails to write the central directory of zip archives, as
+// if the disk filled up right at the end.
+type centralDirFailer struct {
+	bytes.Buffer
+}
+
+func (w *centralDirFailer) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("PK\x01\x02")) {
+		return 0, errors.New("no space left on device")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestTarToZipTruncated(t *testing.T) {
+	var (
+		buf = new(bytes.Buffer)
+		tw  = tar.NewWriter(buf)
+	)
+	_ = tw.WriteHeader(&tar.Header{Name: "a1b2c3/seeds/0/run.out", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+	_, _ = tw.Write([]byte("seed"))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tarToZip(context.Background(), buf, new(centralDirFailer)); err == nil {
+		t.Fatal("expected an error when the central directory can't be written")
+	}
+}
+
+func TestCollectPVCOutputs(t *testing.T) {
+	prev := execInPod
+	defer func() { execInPod = prev }()
+
+	var (
+		lk       sync.Mutex
+		commands []string
+	)
+	execInPod = func(_ *pool, _ kubernetes.Interface, pod, container string, cmd []string, stdout, _ io.Writer) error {
+		lk.Lock()
+		commands = append(commands, strings.Join(append([]string{pod, container}, cmd...), " "))
+		lk.Unlock()
+
+		tw := tar.NewWriter(stdout)
+		content := "seed"
+		_ = tw.WriteHeader(&tar.Header{Name: "a1b2c3/seeds/0/run.out", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		_, _ = tw.Write([]byte(content))
+		return tw.Close()
+	}
+
+	client := fake.NewSimpleClientset()
+
+	// the collector pods start once they're created.
+	go func() {
+		pods := client.CoreV1().Pods("default")
+		for running := 0; running < 2; {
+			list, _ := pods.List(metav1.ListOptions{LabelSelector: "testground.outputs_of=a1b2c3"})
+			for i := range list.Items {
+				if pod := &list.Items[i]; pod.Status.Phase != v1.PodRunning {
+					pod.Status.Phase = v1.PodRunning
+					_, _ = pods.UpdateStatus(pod)
+					running++
+				}
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	// the same run is collected twice at the same time; a single client per
+	// collection must be enough.
+	var (
+		cfg   = &ClusterK8sRunnerConfig{OutputsBackend: "pvc", OutputsPVC: "outputs"}
+		input = &api.CollectionInput{RunID: "a1b2c3", RunnerID: "cluster:k8s"}
+		pool  = newFakePool(2, client)
+		outs  = []*bytes.Buffer{new(bytes.Buffer), new(bytes.Buffer)}
+		errCh = make(chan error, len(outs))
+	)
+	for _, out := range outs {
+		go func(out *bytes.Buffer) {
+			errCh <- collectPVCOutputs(context.Background(), pool, cfg, input, out)
+		}(out)
+	}
+
+	for range outs {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("collecting outputs did not complete")
+		}
+	}
+
+	if len(commands) != 2 || commands[0] == commands[1] {
+		t.Fatalf("expected the collections to exec in their own pods; got %q", commands)
+	}
+	for _, command := range commands {
+		if !strings.HasPrefix(command, "tg-outputs-a1b2c3-") || !strings.HasSuffix(command, " collector tar -cf - -C /outputs a1b2c3") {
+			t.Errorf("unexpected command %q", command)
+		}
+	}
+
+	for _, out := range outs {
+		zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(zr.File) != 1 || zr.File[0].Name != "a1b2c3/seeds/0/run.out" {
+			t.Errorf("unexpected archive entries: %v", zr.File)
+		}
+	}
+
+	// the collector pods are removed.
+	if list, _ := client.CoreV1().Pods("default").List(metav1.ListOptions{}); len(list.Items) != 0 {
+		t.Errorf("expected the collector pods to be deleted; got %d pods", len(list.Items))
+	}
+}
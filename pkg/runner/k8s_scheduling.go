@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/ipfs/testground/pkg/api"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultSpreadTopologyKey spreads pods across nodes.
+const defaultSpreadTopologyKey = "kubernetes.io/hostname"
+
+// podSchedulingSpec holds the scheduling constraints of the pods of a group.
+type podSchedulingSpec struct {
+	tolerations []v1.Toleration
+	affinity    *v1.Affinity
+	spread      []v1.TopologySpreadConstraint
+}
+
+// validateScheduling checks the scheduling controls of a group, against the
+// groups of the run.
+func validateScheduling(groupID string, cfg *ClusterK8sRunnerConfig, groups []api.RunGroup) error {
+	known := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		known[g.ID] = struct{}{}
+	}
+
+	for _, ids := range [][]string{cfg.AvoidGroups, cfg.PreferGroups} {
+		for _, id := range ids {
+			if _, ok := known[id]; !ok {
+				return fmt.Errorf("group %s refers to unknown group %s in its scheduling controls", groupID, id)
+			}
+		}
+	}
+
+	for _, t := range cfg.Tolerations {
+		switch v1.TolerationOperator(t.Operator) {
+		case "", v1.TolerationOpEqual:
+		case v1.TolerationOpExists:
+			if t.Value != "" {
+				return fmt.Errorf("toleration of group %s: value must be empty with operator Exists", groupID)
+			}
+		default:
+			return fmt.Errorf("toleration of group %s: unknown operator %q; supported: Equal, Exists", groupID, t.Operator)
+		}
+		switch v1.TaintEffect(t.Effect) {
+		case "", v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("toleration of group %s: unknown effect %q", groupID, t.Effect)
+		}
+	}
+
+	if cfg.SpreadMaxSkew < 0 {
+		return fmt.Errorf("spread_max_skew of group %s must not be negative", groupID)
+	}
+	return nil
+}
+
+// podScheduling builds the scheduling constraints of the pods of a group from
+// its configuration.
+func podScheduling(runID, groupID string, cfg *ClusterK8sRunnerConfig) *podSchedulingSpec {
+	spec := new(podSchedulingSpec)
+
+	for _, t := range cfg.Tolerations {
+		spec.tolerations = append(spec.tolerations, v1.Toleration{
+			Key:      t.Key,
+			Operator: v1.TolerationOperator(t.Operator),
+			Value:    t.Value,
+			Effect:   v1.TaintEffect(t.Effect),
+		})
+	}
+
+	// selects the pods of the given groups of this run.
+	groupsSelector := func(ids []string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{
+			MatchLabels: map[string]string{"testground.run_id": runID},
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "testground.groupid",
+				Operator: metav1.LabelSelectorOpIn,
+				Values:   ids,
+			}},
+		}
+	}
+
+	if len(cfg.AvoidGroups) > 0 || len(cfg.PreferGroups) > 0 {
+		spec.affinity = new(v1.Affinity)
+	}
+	if len(cfg.AvoidGroups) > 0 {
+		spec.affinity.PodAntiAffinity = &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+				LabelSelector: groupsSelector(cfg.AvoidGroups),
+				TopologyKey:   defaultSpreadTopologyKey,
+			}},
+		}
+	}
+	if len(cfg.PreferGroups) > 0 {
+		spec.affinity.PodAffinity = &v1.PodAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{
+				Weight: 100,
+				PodAffinityTerm: v1.PodAffinityTerm{
+					LabelSelector: groupsSelector(cfg.PreferGroups),
+					TopologyKey:   defaultSpreadTopologyKey,
+				},
+			}},
+		}
+	}
+
+	if cfg.SpreadMaxSkew > 0 {
+		key := cfg.SpreadTopologyKey
+		if key == "" {
+			key = defaultSpreadTopologyKey
+		}
+		spec.spread = []v1.TopologySpreadConstraint{{
+			MaxSkew:           int32(cfg.SpreadMaxSkew),
+			TopologyKey:       key,
+			WhenUnsatisfiable: v1.DoNotSchedule,
+			LabelSelector:     groupsSelector([]string{groupID}),
+		}}
+	}
+
+	return spec
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestValidateScheduling(t *testing.T) {
+	groups := []api.RunGroup{{ID: "seeds"}, {ID: "leechers"}}
+
+	var tests = []struct {
+		cfg      ClusterK8sRunnerConfig
+		hasError bool
+	}{
+		{ClusterK8sRunnerConfig{}, false},
+		{ClusterK8sRunnerConfig{AvoidGroups: []string{"seeds"}, PreferGroups: []string{"leechers"}}, false},
+		{ClusterK8sRunnerConfig{AvoidGroups: []string{"unknown"}}, true},
+		{ClusterK8sRunnerConfig{Tolerations: []K8sToleration{{Key: "beefy", Operator: "Exists", Effect: "NoSchedule"}}}, false},
+		{ClusterK8sRunnerConfig{Tolerations: []K8sToleration{{Key: "beefy", Operator: "Exists", Value: "yes"}}}, true},
+		{ClusterK8sRunnerConfig{Tolerations: []K8sToleration{{Key: "beefy", Operator: "Matches"}}}, true},
+		{ClusterK8sRunnerConfig{Tolerations: []K8sToleration{{Key: "beefy", Effect: "Sometimes"}}}, true},
+		{ClusterK8sRunnerConfig{SpreadMaxSkew: -1}, true},
+	}
+
+	for _, tt := range tests {
+		if err := validateScheduling("leechers", &tt.cfg, groups); (err != nil) != tt.hasError {
+			t.Errorf("validateScheduling(%+v): got error %v, expected error: %t", tt.cfg, err, tt.hasError)
+		}
+	}
+}
+
+func TestPodScheduling(t *testing.T) {
+	if spec := podScheduling("run", "seeds", &ClusterK8sRunnerConfig{}); spec.affinity != nil || spec.spread != nil || spec.tolerations != nil {
+		t.Errorf("expected no scheduling constraints; got %+v", spec)
+	}
+
+	spec := podScheduling("run", "leechers", &ClusterK8sRunnerConfig{AvoidGroups: []string{"seeds"}, SpreadMaxSkew: 1})
+
+	anti := spec.affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(anti) != 1 || anti[0].TopologyKey != "kubernetes.io/hostname" {
+		t.Fatalf("unexpected anti-affinity: %+v", anti)
+	}
+	sel := anti[0].LabelSelector
+	if sel.MatchLabels["testground.run_id"] != "run" || sel.MatchExpressions[0].Values[0] != "seeds" {
+		t.Errorf("anti-affinity doesn't select the seeds of the run: %+v", sel)
+	}
+	if spec.affinity.PodAffinity != nil {
+		t.Errorf("unexpected pod affinity")
+	}
+
+	if len(spec.spread) != 1 || spec.spread[0].MaxSkew != 1 || spec.spread[0].WhenUnsatisfiable != v1.DoNotSchedule {
+		t.Fatalf("unexpected spread constraints: %+v", spec.spread)
+	}
+	if v := spec.spread[0].LabelSelector.MatchExpressions[0].Values; len(v) != 1 || v[0] != "leechers" {
+		t.Errorf("spread constraint doesn't select the group itself: %v", v)
+	}
+}
@@ -0,0 +1,190 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// subnetLeasesConfigMap is the ConfigMap holding the data subnet leases of
+	// the runs of the cluster. Keys are subnet indices (see nextDataNetwork),
+	// values are JSON-encoded subnetLeases.
+	subnetLeasesConfigMap = "testground-subnet-leases"
+
+	// subnetLeasesNamespace is the namespace of the leases ConfigMap. The data
+	// network spans the whole cluster, so runs in all namespaces share the
+	// leases.
+	subnetLeasesNamespace = "testground"
+
+	// nextSubnetAnnotation is the annotation of the leases ConfigMap holding
+	// the index to start looking for a free subnet from.
+	nextSubnetAnnotation = "testground.next_subnet"
+
+	// maxSubnets is the number of data subnets available.
+	maxSubnets = 4096
+
+	// staleLeaseAge is how old a lease must be before it can be reclaimed
+	// because its run has no pods. Runs lease their subnet before creating
+	// their pods, so younger leases may belong to runs that are starting.
+	staleLeaseAge = 10 * time.Minute
+)
+
+// subnetLease records that a run holds a data subnet.
+type subnetLease struct {
+	RunID   string    `json:"run_id"`
+	Created time.Time `json:"created"`
+}
+
+// leaseK8sSubnet leases a data subnet for the run, which no other run in the
+// cluster will get until it's released. Leases are kept in a ConfigMap, so
+// they're shared by all daemons and namespaces using the cluster, and survive
+// restarts.
+//
+// Leases of runs that no longer have any pods, e.g. because the daemon died
+// before releasing them, are reclaimed.
+//
+// Subnets are handed out round-robin, so that a subnet that was just released
+// is not reused right away: weave doesn't release the IPs of terminated pods
+// immediately, so they may still be allocated.
+func leaseK8sSubnet(client kubernetes.Interface, runID string) (*net.IPNet, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		cm, err := subnetLeases(client)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := reclaimStaleLeases(client, cm); err != nil {
+			return nil, err
+		}
+
+		next, _ := strconv.Atoi(cm.Annotations[nextSubnetAnnotation])
+		idx, err := freeSubnet(cm.Data, next)
+		if err != nil {
+			return nil, err
+		}
+
+		b, _ := json.Marshal(subnetLease{RunID: runID, Created: time.Now()})
+		cm.Data[strconv.Itoa(idx)] = string(b)
+		cm.Annotations[nextSubnetAnnotation] = strconv.Itoa((idx + 1) % maxSubnets)
+
+		// Updates are rejected if someone else modified the leases since we
+		// read them; try again in that case.
+		_, err = client.CoreV1().ConfigMaps(subnetLeasesNamespace).Update(cm)
+		switch {
+		case err == nil:
+			subnet, _, err := nextDataNetwork(idx)
+			return subnet, err
+		case k8serrors.IsConflict(err):
+			continue
+		default:
+			return nil, fmt.Errorf("failed to update subnet leases: %w", err)
+		}
+	}
+	return nil, errors.New("failed to lease a subnet: too many concurrent updates")
+}
+
+// releaseK8sSubnets releases the data subnets leased by the run, if any.
+func releaseK8sSubnets(client kubernetes.Interface, runID string) error {
+	for attempt := 0; attempt < 10; attempt++ {
+		cm, err := subnetLeases(client)
+		if err != nil {
+			return err
+		}
+
+		var released bool
+		for k, v := range cm.Data {
+			var l subnetLease
+			if err := json.Unmarshal([]byte(v), &l); err != nil || l.RunID == runID {
+				delete(cm.Data, k)
+				released = true
+			}
+		}
+		if !released {
+			return nil
+		}
+
+		_, err = client.CoreV1().ConfigMaps(subnetLeasesNamespace).Update(cm)
+		switch {
+		case err == nil:
+			return nil
+		case k8serrors.IsConflict(err):
+			continue
+		default:
+			return fmt.Errorf("failed to update subnet leases: %w", err)
+		}
+	}
+	return errors.New("failed to release subnet: too many concurrent updates")
+}
+
+// subnetLeases gets the leases ConfigMap, creating it if it doesn't exist.
+func subnetLeases(client kubernetes.Interface) (*v1.ConfigMap, error) {
+	cms := client.CoreV1().ConfigMaps(subnetLeasesNamespace)
+
+	cm, err := cms.Get(subnetLeasesConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		cm, err = cms.Create(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: subnetLeasesConfigMap, Namespace: subnetLeasesNamespace}})
+		if k8serrors.IsAlreadyExists(err) {
+			cm, err = cms.Get(subnetLeasesConfigMap, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subnet leases in namespace %s: %w", subnetLeasesNamespace, err)
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string)
+	}
+	return cm, nil
+}
+
+// reclaimStaleLeases removes the leases of runs without pods in any namespace
+// from cm. The caller is responsible for persisting cm.
+func reclaimStaleLeases(client kubernetes.Interface, cm *v1.ConfigMap) error {
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{LabelSelector: "testground.run_id"})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	live := make(map[string]struct{}, len(pods.Items))
+	for _, p := range pods.Items {
+		live[p.Labels["testground.run_id"]] = struct{}{}
+	}
+
+	for k, v := range cm.Data {
+		var l subnetLease
+		if err := json.Unmarshal([]byte(v), &l); err != nil {
+			delete(cm.Data, k)
+			continue
+		}
+		if _, ok := live[l.RunID]; !ok && time.Since(l.Created) > staleLeaseAge {
+			delete(cm.Data, k)
+		}
+	}
+	return nil
+}
+
+// freeSubnet returns the first subnet index without a lease, starting from
+// next, and wrapping around.
+func freeSubnet(leases map[string]string, next int) (int, error) {
+	if next < 0 || next >= maxSubnets {
+		next = 0
+	}
+	for i := 0; i < maxSubnets; i++ {
+		idx := (next + i) % maxSubnets
+		if _, ok := leases[strconv.Itoa(idx)]; !ok {
+			return idx, nil
+		}
+	}
+	return 0, errors.New("all data subnets are leased")
+}
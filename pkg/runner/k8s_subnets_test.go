@@ -0,0 +1,159 @@
+package runner
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestK8sSubnetLeases(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	a, err := leaseK8sSubnet(client, "run-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := leaseK8sSubnet(client, "run-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.String() == b.String() {
+		t.Fatalf("concurrent runs got the same subnet: %s", a)
+	}
+
+	// releasing run-a frees its subnet, but it's not reused right away.
+	if err := releaseK8sSubnets(client, "run-a"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := leaseK8sSubnet(client, "run-c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() == a.String() || c.String() == b.String() {
+		t.Errorf("expected a subnet other than %s and %s; got %s", a, b, c)
+	}
+}
+
+func TestFreeSubnetRoundRobin(t *testing.T) {
+	leases := map[string]string{"0": "a", "2": "b", strconv.Itoa(maxSubnets - 1): "c"}
+
+	cases := []struct {
+		next, expected int
+	}{
+		{0, 1},
+		{1, 1},
+		{2, 3},
+		{maxSubnets - 1, 1}, // wraps around.
+		{maxSubnets, 1},     // out of range.
+	}
+	for _, c := range cases {
+		idx, err := freeSubnet(leases, c.next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx != c.expected {
+			t.Errorf("freeSubnet from %d: expected %d, got %d", c.next, c.expected, idx)
+		}
+	}
+
+	full := make(map[string]string, maxSubnets)
+	for i := 0; i < maxSubnets; i++ {
+		full[strconv.Itoa(i)] = "x"
+	}
+	if _, err := freeSubnet(full, 0); err == nil {
+		t.Error("expected an error when all subnets are leased")
+	}
+}
+
+func TestK8sSubnetLeasesReclaimStale(t *testing.T) {
+	old, _ := json.Marshal(subnetLease{RunID: "dead", Created: time.Now().Add(-time.Hour)})
+	live, _ := json.Marshal(subnetLease{RunID: "live", Created: time.Now().Add(-time.Hour)})
+
+	client := fake.NewSimpleClientset(
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: subnetLeasesConfigMap, Namespace: subnetLeasesNamespace},
+			Data:       map[string]string{"0": string(old), "1": string(live)},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default", Labels: map[string]string{"testground.run_id": "live"}},
+		},
+	)
+
+	subnet, err := leaseK8sSubnet(client, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lease of the run without pods is reclaimed; the live one is kept.
+	if expected, _, _ := nextDataNetwork(0); subnet.String() != expected.String() {
+		t.Errorf("expected stale subnet %s to be reclaimed; got %s", expected, subnet)
+	}
+	cm, err := subnetLeases(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cm.Data["1"]; !ok {
+		t.Errorf("lease of a run with pods was reclaimed")
+	}
+}
+
+func TestK8sSubnetLeasesAcrossNamespaces(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	lease := func(runID string) string {
+		b, _ := json.Marshal(subnetLease{RunID: runID, Created: old})
+		return string(b)
+	}
+
+	// runs of two teams, in their own namespaces, share the leases.
+	client := fake.NewSimpleClientset(
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: subnetLeasesConfigMap, Namespace: subnetLeasesNamespace},
+			Data:       map[string]string{"0": lease("team-a-run"), "1": lease("team-b-run"), "2": lease("dead")},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "team-a", Labels: map[string]string{"testground.run_id": "team-a-run"}},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "team-b", Labels: map[string]string{"testground.run_id": "team-b-run"}},
+		},
+	)
+
+	a, err := leaseK8sSubnet(client, "team-a-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := leaseK8sSubnet(client, "team-b-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.String() == b.String() {
+		t.Fatalf("runs in different namespaces got the same subnet: %s", a)
+	}
+
+	cm, err := subnetLeases(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the leases of runs with pods in either namespace are kept.
+	for k, runID := range map[string]string{"0": "team-a-run", "1": "team-b-run"} {
+		var l subnetLease
+		if err := json.Unmarshal([]byte(cm.Data[k]), &l); err != nil || l.RunID != runID {
+			t.Errorf("expected the lease of %s on subnet %s to be kept; got %q", runID, k, cm.Data[k])
+		}
+	}
+	if len(cm.Data) != 4 {
+		t.Errorf("expected 4 leases; got %v", cm.Data)
+	}
+
+	// no leases are kept in the namespaces of the runs.
+	for _, ns := range []string{"team-a", "team-b"} {
+		if _, err := client.CoreV1().ConfigMaps(ns).Get(subnetLeasesConfigMap, metav1.GetOptions{}); err == nil {
+			t.Errorf("expected no leases in namespace %s", ns)
+		}
+	}
+}
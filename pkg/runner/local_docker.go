@@ -2,6 +2,7 @@ package runner
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,6 +29,7 @@ import (
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-units"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/imdario/mergo"
@@ -35,22 +38,177 @@ import (
 )
 
 var (
-	_ api.Runner = &LocalDockerRunner{}
+	_ api.Runner       = &LocalDockerRunner{}
+	_ api.Teardownable = &LocalDockerRunner{}
+	_ api.Churner      = &LocalDockerRunner{}
 )
 
 // LocalDockerRunnerConfig is the configuration object of this runner. Boolean
 // values are expressed in a way that zero value (false) is the default setting.
+//
+// Fields tagged with `group:"yes"` can be set per group: keep_containers,
+// log_level, data_networks, the NAT filter settings, and the resource
+// limits of the containers.
 type LocalDockerRunnerConfig struct {
 	// KeepContainers retains test containers even after they exit (default:
 	// false).
-	KeepContainers bool `toml:"keep_containers"`
+	KeepContainers bool `toml:"keep_containers" group:"yes"`
 	// LogLevel sets the log level in the test containers (default: not set).
-	LogLevel string `toml:"log_level"`
+	LogLevel string `toml:"log_level" group:"yes"`
 	// Unstarted creates the containers without starting them (default: false).
 	Unstarted bool `toml:"no_start"`
 	// Background avoids tailing the output of containers, and displaying it as
 	// log messages (default: false).
 	Background bool `toml:"background"`
+
+	// CPUShares is the relative CPU weight of each container versus other
+	// containers (default: not set, i.e. 1024).
+	CPUShares int64 `toml:"cpu_shares" group:"yes"`
+	// CPUs is the number of CPUs each container can use, enforced as a CFS
+	// quota, e.g. 0.5 (default: unlimited).
+	CPUs float64 `toml:"cpus" group:"yes"`
+	// CPUsetCPUs pins the containers to a set of CPUs, e.g. "0-3" or "1,3"
+	// (default: not pinned).
+	CPUsetCPUs string `toml:"cpuset_cpus" group:"yes"`
+	// Memory is the memory limit of each container, e.g. "512MiB" (default:
+	// unlimited).
+	Memory string `toml:"memory" group:"yes"`
+	// MemoryReservation is the memory each container is guaranteed under
+	// memory contention, e.g. "256MiB" (default: not set).
+	MemoryReservation string `toml:"memory_reservation" group:"yes"`
+	// PidsLimit is the maximum number of processes in each container (default:
+	// unlimited).
+	PidsLimit int64 `toml:"pids_limit" group:"yes"`
+
+	// DataNetworks are the names of the data networks the containers attach
+	// to. A data network is created for each name used by any group of the
+	// run (default: ["default"]).
+	DataNetworks []string `toml:"data_networks" group:"yes"`
+
+	// NATFilter emulates the filtering of a NAT in front of each container on
+	// NATFilterNetwork: "full-cone", "restricted-cone" or "port-restricted-cone"
+	// (default: not set, no filtering). Addresses and ports are not translated,
+	// so symmetric NATs can't be emulated. Requires the sidecar.
+	NATFilter string `toml:"nat_filter" group:"yes"`
+	// NATFilterNetwork is the data network the NAT filter applies to (default:
+	// "default").
+	NATFilterNetwork string `toml:"nat_filter_network" group:"yes"`
+	// NATFilterTimeout is how long a cone NAT filter keeps accepting inbound
+	// traffic on a port without outbound traffic, e.g. "30s" (default: "2m").
+	NATFilterTimeout string `toml:"nat_filter_timeout" group:"yes"`
+}
+
+// natFilterLabels validates the NAT filter settings, and returns the container
+// labels that pass them to the sidecar.
+func (c *LocalDockerRunnerConfig) natFilterLabels() (map[string]string, error) {
+	if c.NATFilter == "" {
+		return nil, nil
+	}
+
+	switch c.NATFilter {
+	case "full-cone", "restricted-cone", "port-restricted-cone":
+	case "symmetric":
+		// hole punching through a symmetric NAT fails because it maps ports
+		// per destination; a filter can't reproduce that.
+		return nil, errors.New("nat filter type symmetric is not supported, as ports are not mapped; supported: full-cone, restricted-cone, port-restricted-cone")
+	default:
+		return nil, fmt.Errorf("unknown nat filter type %q; supported: full-cone, restricted-cone, port-restricted-cone", c.NATFilter)
+	}
+
+	network := c.NATFilterNetwork
+	if network == "" {
+		network = "default"
+	}
+	networks, err := c.dataNetworks()
+	if err != nil {
+		return nil, err
+	}
+	if !stringInSlice(network, networks) {
+		return nil, fmt.Errorf("nat filter network %q is not one of the data networks %v", network, networks)
+	}
+
+	timeout := 2 * time.Minute
+	if c.NATFilterTimeout != "" {
+		if timeout, err = time.ParseDuration(c.NATFilterTimeout); err != nil || timeout < time.Second {
+			return nil, fmt.Errorf("invalid nat filter timeout %q; must be at least 1s", c.NATFilterTimeout)
+		}
+	}
+
+	return map[string]string{
+		"testground.nat_filter.type":    c.NATFilter,
+		"testground.nat_filter.network": network,
+		"testground.nat_filter.timeout": timeout.String(),
+	}, nil
+}
+
+// validNetworkName matches the names of data networks.
+var validNetworkName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// dataNetworks returns the names of the data networks the containers attach
+// to.
+func (c *LocalDockerRunnerConfig) dataNetworks() ([]string, error) {
+	if len(c.DataNetworks) == 0 {
+		return []string{"default"}, nil
+	}
+
+	seen := make(map[string]struct{}, len(c.DataNetworks))
+	for _, name := range c.DataNetworks {
+		if !validNetworkName.MatchString(name) {
+			return nil, fmt.Errorf("invalid data network name %q", name)
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("duplicate data network %q", name)
+		}
+		seen[name] = struct{}{}
+	}
+	return c.DataNetworks, nil
+}
+
+// resources returns the docker resource limits for the containers, along
+// with a human-readable summary of the limits that are set.
+func (c *LocalDockerRunnerConfig) resources() (container.Resources, map[string]string, error) {
+	var (
+		res     container.Resources
+		summary = make(map[string]string)
+	)
+
+	if c.CPUShares > 0 {
+		res.CPUShares = c.CPUShares
+		summary["cpu_shares"] = strconv.FormatInt(c.CPUShares, 10)
+	}
+	if c.CPUs > 0 {
+		res.NanoCPUs = int64(c.CPUs * 1e9)
+		summary["cpus"] = strconv.FormatFloat(c.CPUs, 'f', -1, 64)
+	}
+	if c.CPUsetCPUs != "" {
+		res.CpusetCpus = c.CPUsetCPUs
+		summary["cpuset_cpus"] = c.CPUsetCPUs
+	}
+	if c.Memory != "" {
+		b, err := units.RAMInBytes(c.Memory)
+		if err != nil {
+			return res, nil, fmt.Errorf("invalid memory limit %q: %w", c.Memory, err)
+		}
+		res.Memory = b
+		summary["memory"] = units.BytesSize(float64(b))
+	}
+	if c.MemoryReservation != "" {
+		b, err := units.RAMInBytes(c.MemoryReservation)
+		if err != nil {
+			return res, nil, fmt.Errorf("invalid memory reservation %q: %w", c.MemoryReservation, err)
+		}
+		res.MemoryReservation = b
+		summary["memory_reservation"] = units.BytesSize(float64(b))
+	}
+	if res.Memory > 0 && res.MemoryReservation > res.Memory {
+		return res, nil, fmt.Errorf("memory reservation (%s) exceeds the memory limit (%s)", c.MemoryReservation, c.Memory)
+	}
+	if c.PidsLimit > 0 {
+		limit := c.PidsLimit
+		res.PidsLimit = &limit
+		summary["pids_limit"] = strconv.FormatInt(limit, 10)
+	}
+	return res, summary, nil
 }
 
 // defaultConfig is the default configuration. Incoming configurations will be
@@ -143,36 +301,125 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 		TestCaseSeq:       seq,
 		TestInstanceCount: input.TotalInstances,
 		TestSidecar:       true,
+		TestLifecycle:     true,
 		TestOutputsPath:   "/outputs",
 	}
 
-	// Create a data network.
-	dataNetworkID, subnet, err := newDataNetwork(ctx, cli, logging.S(), &template, "default")
-	if err != nil {
-		return nil, err
-	}
-
-	template.TestSubnet = &runtime.IPNet{IPNet: *subnet}
-
 	// Merge the incoming configuration with the default configuration.
 	cfg := defaultConfig
 	if err := mergo.Merge(&cfg, input.RunnerConfig, mergo.WithOverride); err != nil {
 		return nil, fmt.Errorf("error while merging configurations: %w", err)
 	}
 
-	var containers []string
-	for _, g := range input.Groups {
+	// Merge the configurations of the groups, and collect the data networks
+	// they attach to, in order of appearance.
+	var (
+		gcfgs = make([]LocalDockerRunnerConfig, len(input.Groups))
+		names []string
+	)
+	for i, g := range input.Groups {
+		gcfgs[i] = defaultConfig
+		if err := mergo.Merge(&gcfgs[i], g.RunnerConfig, mergo.WithOverride); err != nil {
+			return nil, fmt.Errorf("error while merging configurations of group %s: %w", g.ID, err)
+		}
+		gnets, err := gcfgs[i].dataNetworks()
+		if err != nil {
+			return nil, fmt.Errorf("invalid data networks for group %s: %w", g.ID, err)
+		}
+		for _, name := range gnets {
+			if !stringInSlice(name, names) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	// Create the data networks.
+	type dataNetwork struct {
+		id     string
+		subnet *net.IPNet
+	}
+	dataNetworks := make(map[string]dataNetwork, len(names))
+	for _, name := range names {
+		id, subnet, err := newDataNetwork(ctx, cli, logging.S(), &template, name)
+		if err != nil {
+			for _, n := range dataNetworks {
+				_ = cli.NetworkRemove(context.Background(), n.id)
+			}
+			return nil, err
+		}
+		dataNetworks[name] = dataNetwork{id, subnet}
+
+		api.WriteEvent(ow, &api.Event{
+			Type: api.EventTypeNetworkConfigured,
+			Network: &api.NetworkEvent{
+				RunID:  input.RunID,
+				Name:   name,
+				Subnet: subnet.String(),
+			},
+		})
+	}
+
+	var (
+		containers []string
+		// ephemeral are the containers of groups that don't keep them.
+		ephemeral []string
+		keepAny   bool
+		out       = &api.RunOutput{RunID: input.RunID}
+	)
+	for i, g := range input.Groups {
+		gcfg := gcfgs[i]
+		keepAny = keepAny || gcfg.KeepContainers
+
+		// don't shadow err; it reports the failures to create containers.
+		resources, summary, rerr := gcfg.resources()
+		if rerr != nil {
+			return nil, fmt.Errorf("invalid resource limits for group %s: %w", g.ID, rerr)
+		}
+
+		natLabels, nerr := gcfg.natFilterLabels()
+		if nerr != nil {
+			return nil, fmt.Errorf("invalid nat filter settings for group %s: %w", g.ID, nerr)
+		}
+		if natLabels != nil {
+			log.Infow("emulating nat filtering for group", "group", g.ID, "type", gcfg.NATFilter, "network", natLabels["testground.nat_filter.network"])
+		}
+		out.Groups = append(out.Groups, api.GroupSummary{ID: g.ID, Instances: g.Instances, Resources: summary})
+		log.Infow("resource limits of group", "group", g.ID, "limits", summary)
+
 		runenv := template
 		runenv.TestGroupInstanceCount = g.Instances
 		runenv.TestGroupID = g.ID
 		runenv.TestInstanceParams = g.Parameters
 
-		// Serialize the runenv into env variables to pass to docker.
-		env := conv.ToOptionsSlice(runenv.ToEnvVars())
+		// The subnet of the group is that of the default network, or of its
+		// first network if it isn't attached to the default one.
+		gnets, _ := gcfg.dataNetworks()
+		runenv.TestSubnet = &runtime.IPNet{IPNet: *dataNetworks[gnets[0]].subnet}
+		if n, ok := dataNetworks["default"]; ok && stringInSlice("default", gnets) {
+			runenv.TestSubnet = &runtime.IPNet{IPNet: *n.subnet}
+		}
+		if len(names) > 1 {
+			runenv.TestNetworks = make(map[string]*runtime.IPNet, len(gnets))
+			for _, name := range gnets {
+				runenv.TestNetworks[name] = &runtime.IPNet{IPNet: *dataNetworks[name].subnet}
+			}
+		}
+
+		// Environment variables to pass to docker, besides the runenv.
+		var extraEnv []string
 
-		// Set the log level if provided in cfg.
-		if cfg.LogLevel != "" {
-			env = append(env, "LOG_LEVEL="+cfg.LogLevel)
+		// Set the log level if provided in the group cfg.
+		if gcfg.LogLevel != "" {
+			extraEnv = append(extraEnv, "LOG_LEVEL="+gcfg.LogLevel)
+		}
+
+		// The sidecar enforces the churn of the group.
+		if g.Churn != nil {
+			churn, err := json.Marshal(g.Churn)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode churn of group %s: %w", g.ID, err)
+			}
+			extraEnv = append(extraEnv, api.EnvChurn+"="+string(churn))
 		}
 
 		// Create the run output directory and write the runenv.
@@ -194,6 +441,10 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 			name := fmt.Sprintf("tg-%s-%s-%s-%s-%d", input.TestPlan.Name, testcase.Name, input.RunID, g.ID, i)
 			log.Infow("creating container", "name", name)
 
+			// Serialize the runenv into env variables to pass to docker.
+			runenv.TestGroupInstanceIndex = i
+			env := append(conv.ToOptionsSlice(runenv.ToEnvVars()), extraEnv...)
+
 			ccfg := &container.Config{
 				Image: g.ArtifactPath,
 				Env:   env,
@@ -204,6 +455,9 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 					"testground.group_id": g.ID,
 				},
 			}
+			for k, v := range natLabels {
+				ccfg.Labels[k] = v
+			}
 			fmt.Println(odir)
 			hcfg := &container.HostConfig{
 				NetworkMode: container.NetworkMode(ctrlnid),
@@ -212,6 +466,7 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 					Source: odir,
 					Target: runenv.TestOutputsPath,
 				}},
+				Resources: resources,
 			}
 
 			// Create the container.
@@ -222,25 +477,39 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 			}
 
 			containers = append(containers, res.ID)
+			if !gcfg.KeepContainers {
+				ephemeral = append(ephemeral, res.ID)
+			}
 
 			// TODO: Remove this when we get the sidecar working. It'll do this for us.
-			err = attachContainerToNetwork(ctx, cli, res.ID, dataNetworkID)
+			for _, name := range gnets {
+				if err = attachContainerToNetwork(ctx, cli, res.ID, dataNetworks[name].id); err != nil {
+					break
+				}
+			}
 			if err != nil {
 				break
 			}
 		}
+		if err != nil {
+			break
+		}
 	}
 
-	if !cfg.KeepContainers {
-		defer func() {
-			_ = deleteContainers(cli, log, containers)
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			if err := cli.NetworkRemove(ctx, dataNetworkID); err != nil {
-				log.Errorw("removing network", "network", dataNetworkID, "error", err)
+	defer func() {
+		_ = deleteContainers(cli, log, ephemeral)
+		if keepAny {
+			// kept containers are still attached to the data networks.
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for _, n := range dataNetworks {
+			if err := cli.NetworkRemove(ctx, n.id); err != nil {
+				log.Errorw("removing network", "network", n.id, "error", err)
 			}
-		}()
-	}
+		}
+	}()
 
 	// If an error occurred interim, abort.
 	if err != nil {
@@ -276,7 +545,7 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 	}
 
 	if !cfg.Background {
-		pretty := NewPrettyPrinter()
+		pretty := NewPrettyPrinter(ow)
 
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
@@ -296,18 +565,125 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow io.
 
 			rstdout, wstdout := io.Pipe()
 			rstderr, wstderr := io.Pipe()
-			go func() {
-				_, err := stdcopy.StdCopy(wstdout, wstderr, stream)
+			go func(id string) {
+				err := followContainerLogs(ctx, cli, id, stream, wstdout, wstderr)
 				_ = wstdout.CloseWithError(err)
 				_ = wstderr.CloseWithError(err)
-			}()
+			}(id)
 
 			pretty.Manage(id[0:12], rstdout, rstderr)
 		}
-		return &api.RunOutput{RunID: input.RunID}, pretty.Wait()
+		return out, pretty.Wait()
 	}
 
-	return &api.RunOutput{RunID: input.RunID}, nil
+	return out, nil
+}
+
+// restartGracePeriod is how long to wait for a killed container to be
+// started again, before considering it exited.
+const restartGracePeriod = 10 * time.Second
+
+// followContainerLogs copies the logs of the container from the stream to
+// stdout and stderr, until the container exits. Containers restarted by a
+// lifecycle request or by churn are killed and started again right away; their
+// logs are followed across restarts.
+func followContainerLogs(ctx context.Context, cli *client.Client, id string, stream io.ReadCloser, stdout, stderr io.Writer) error {
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		stream.Close()
+		return err
+	}
+	started := info.State.StartedAt
+
+	for {
+		_, err := stdcopy.StdCopy(stdout, stderr, stream)
+		stream.Close()
+		if err != nil {
+			return err
+		}
+
+		// only containers killed with SIGKILL may be restarting.
+		deadline := time.Now().Add(restartGracePeriod)
+		for {
+			info, err = cli.ContainerInspect(ctx, id)
+			if err != nil || (!info.State.Running && info.State.ExitCode != 137) {
+				return err
+			}
+			if info.State.Running && info.State.StartedAt != started {
+				break
+			}
+			if time.Now().After(deadline) {
+				return nil
+			}
+			select {
+			case <-time.After(250 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		started = info.State.StartedAt
+		stream, err = cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Since:      started,
+			Follow:     true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// TeardownRun removes all containers and networks labelled with the run ID.
+func (*LocalDockerRunner) TeardownRun(ctx context.Context, input *api.TeardownInput) (*api.TeardownOutput, error) {
+	log := logging.S().With("runner", "local:docker", "run_id", input.RunID)
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out    = new(api.TeardownOutput)
+		merr   *multierror.Error
+		filter = filters.NewArgs(filters.Arg("label", "testground.run_id="+input.RunID))
+	)
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	for _, c := range containers {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		log.Infow("removing container", "name", name)
+		if err := cli.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to remove container %s: %w", name, err))
+			continue
+		}
+		out.Removed = append(out.Removed, "container "+name)
+	}
+
+	// networks can only be removed once all containers have been detached.
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: filter})
+	if err != nil {
+		return out, multierror.Append(merr, fmt.Errorf("failed to list networks: %w", err)).ErrorOrNil()
+	}
+
+	for _, n := range networks {
+		log.Infow("removing network", "name", n.Name)
+		if err := cli.NetworkRemove(ctx, n.ID); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to remove network %s: %w", n.Name, err))
+			continue
+		}
+		out.Removed = append(out.Removed, "network "+n.Name)
+	}
+
+	return out, merr.ErrorOrNil()
 }
 
 func deleteContainers(cli *client.Client, log *zap.SugaredLogger, ids []string) (err error) {
@@ -346,12 +722,13 @@ func ensureControlNetwork(ctx context.Context, cli *client.Client, log *zap.Suga
 }
 
 func newDataNetwork(ctx context.Context, cli *client.Client, log *zap.SugaredLogger, env *runtime.RunParams, name string) (id string, subnet *net.IPNet, err error) {
-	// Find a free network.
+	// Find a free network. Runs may have several data networks, so count all
+	// of them, whatever their name.
 	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{
 		Filters: filters.NewArgs(
 			filters.Arg(
 				"label",
-				"testground.name=default",
+				"testground.name",
 			),
 		),
 	})
@@ -467,10 +844,21 @@ func (*LocalDockerRunner) ID() string {
 	return "local:docker"
 }
 
+func (*LocalDockerRunner) SupportsChurn() {}
+
 func (*LocalDockerRunner) ConfigType() reflect.Type {
 	return reflect.TypeOf(LocalDockerRunnerConfig{})
 }
 
 func (*LocalDockerRunner) CompatibleBuilders() []string {
-	return []string{"docker:go"}
+	return []string{"docker:go", "docker:generic"}
+}
+
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"testing"
+)
+
+func TestLocalDockerResources(t *testing.T) {
+	var tests = []struct {
+		cfg      LocalDockerRunnerConfig
+		summary  map[string]string
+		hasError bool
+	}{
+		{LocalDockerRunnerConfig{}, map[string]string{}, false},
+		{
+			LocalDockerRunnerConfig{CPUs: 0.5, Memory: "512MiB", PidsLimit: 100, CPUsetCPUs: "0-1"},
+			map[string]string{"cpus": "0.5", "memory": "512MiB", "pids_limit": "100", "cpuset_cpus": "0-1"},
+			false,
+		},
+		{LocalDockerRunnerConfig{Memory: "lots"}, nil, true},
+		{LocalDockerRunnerConfig{Memory: "256MiB", MemoryReservation: "1GiB"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		res, summary, err := tt.cfg.resources()
+		if err != nil {
+			if !tt.hasError {
+				t.Errorf("got error but didn't expect one: %s", err)
+			}
+			continue
+		}
+		if tt.hasError {
+			t.Errorf("expected an error for config %+v", tt.cfg)
+			continue
+		}
+
+		if len(summary) != len(tt.summary) {
+			t.Errorf("expected summary %v, got %v", tt.summary, summary)
+		}
+		for k, v := range tt.summary {
+			if summary[k] != v {
+				t.Errorf("expected %s=%s, got %s", k, v, summary[k])
+			}
+		}
+		if tt.cfg.CPUs > 0 && res.NanoCPUs != int64(tt.cfg.CPUs*1e9) {
+			t.Errorf("expected %d nano CPUs, got %d", int64(tt.cfg.CPUs*1e9), res.NanoCPUs)
+		}
+	}
+}
+
+func TestLocalDockerDataNetworks(t *testing.T) {
+	var tests = []struct {
+		cfg      LocalDockerRunnerConfig
+		expected []string
+		hasError bool
+	}{
+		{LocalDockerRunnerConfig{}, []string{"default"}, false},
+		{LocalDockerRunnerConfig{DataNetworks: []string{"default", "lan-a"}}, []string{"default", "lan-a"}, false},
+		{LocalDockerRunnerConfig{DataNetworks: []string{"lan-a", "lan-a"}}, nil, true},
+		{LocalDockerRunnerConfig{DataNetworks: []string{"bad name"}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		names, err := tt.cfg.dataNetworks()
+		if (err != nil) != tt.hasError {
+			t.Errorf("dataNetworks(%v): got error %v, expected error: %t", tt.cfg.DataNetworks, err, tt.hasError)
+			continue
+		}
+		if len(names) != len(tt.expected) {
+			t.Errorf("expected networks %v, got %v", tt.expected, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.expected[i] {
+				t.Errorf("expected networks %v, got %v", tt.expected, names)
+			}
+		}
+	}
+}
+
+func TestLocalDockerNATFilterLabels(t *testing.T) {
+	var tests = []struct {
+		cfg      LocalDockerRunnerConfig
+		network  string
+		hasError bool
+	}{
+		{LocalDockerRunnerConfig{NATFilter: "full-cone"}, "default", false},
+		{LocalDockerRunnerConfig{NATFilter: "port-restricted-cone", NATFilterTimeout: "30s"}, "default", false},
+		{LocalDockerRunnerConfig{NATFilter: "carrier-grade"}, "", true},
+		{LocalDockerRunnerConfig{NATFilter: "symmetric"}, "", true},
+		{LocalDockerRunnerConfig{NATFilter: "restricted-cone", NATFilterNetwork: "lan"}, "", true},
+		{LocalDockerRunnerConfig{NATFilter: "restricted-cone", NATFilterNetwork: "lan", DataNetworks: []string{"lan"}}, "lan", false},
+		{LocalDockerRunnerConfig{NATFilter: "restricted-cone", NATFilterTimeout: "10ms"}, "", true},
+	}
+
+	for _, tt := range tests {
+		labels, err := tt.cfg.natFilterLabels()
+		if (err != nil) != tt.hasError {
+			t.Errorf("natFilterLabels(%+v): got error %v, expected error: %t", tt.cfg, err, tt.hasError)
+			continue
+		}
+		if err == nil && labels["testground.nat_filter.network"] != tt.network {
+			t.Errorf("natFilterLabels(%+v): expected network %s, got %s", tt.cfg, tt.network, labels["testground.nat_filter.network"])
+		}
+	}
+
+	if labels, err := (&LocalDockerRunnerConfig{}).natFilterLabels(); labels != nil || err != nil {
+		t.Errorf("expected no nat filter labels without nat filter; got %v, %v", labels, err)
+	}
+}
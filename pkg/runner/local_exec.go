@@ -24,7 +24,8 @@ var (
 )
 
 var (
-	_ api.Runner = (*LocalExecutableRunner)(nil)
+	_ api.Runner  = (*LocalExecutableRunner)(nil)
+	_ api.Churner = (*LocalExecutableRunner)(nil)
 )
 
 type LocalExecutableRunner struct {
@@ -32,7 +33,26 @@ type LocalExecutableRunner struct {
 }
 
 // LocalExecutableRunnerCfg is the configuration struct for this runner.
-type LocalExecutableRunnerCfg struct{}
+type LocalExecutableRunnerCfg struct {
+	// Lifecycle answers the lifecycle requests of the instances (default:
+	// false). It's implied when a group has churn. Answering requests requires
+	// connecting to the sync service before starting the instances.
+	Lifecycle bool `toml:"lifecycle"`
+}
+
+// lifecycle returns whether the lifecycle requests of the instances of a run
+// are answered.
+func (c *LocalExecutableRunnerCfg) lifecycle(groups []api.RunGroup) bool {
+	if c != nil && c.Lifecycle {
+		return true
+	}
+	for _, g := range groups {
+		if g.Churn != nil {
+			return true
+		}
+	}
+	return false
+}
 
 func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow io.Writer) (*api.RunOutput, error) {
 	var (
@@ -107,15 +127,25 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 		TestSubnet:        &runtime.IPNet{IPNet: *localSubnet},
 	}
 
+	// Answer the lifecycle requests of the instances, and enforce churn. Only
+	// connect to the sync service if the run needs it, as resolving it can
+	// take a while.
+	var lifecycle *execLifecycle
+	if cfg, _ := input.RunnerConfig.(*LocalExecutableRunnerCfg); cfg.lifecycle(input.Groups) {
+		var err error
+		if lifecycle, err = newExecLifecycle(ctx, template); err != nil {
+			return nil, fmt.Errorf("failed to connect to the sync service to answer lifecycle requests: %w", err)
+		}
+		template.TestLifecycle = true
+		defer lifecycle.Close()
+	}
+
 	// Spawn as many instances as the input parameters require.
-	pretty := NewPrettyPrinter()
-	commands := make([]*exec.Cmd, 0, input.TotalInstances)
+	pretty := NewPrettyPrinter(ow)
+	instances := make([]*execInstance, 0, input.TotalInstances)
 	defer func() {
-		for _, cmd := range commands {
-			_ = cmd.Process.Kill()
-		}
-		for _, cmd := range commands {
-			_ = cmd.Wait()
+		for _, in := range instances {
+			in.stop()
 		}
 		_ = pretty.Wait()
 	}()
@@ -136,6 +166,7 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 			runenv := template
 			runenv.TestGroupID = g.ID
 			runenv.TestGroupInstanceCount = g.Instances
+			runenv.TestGroupInstanceIndex = i
 			runenv.TestInstanceParams = g.Parameters
 			runenv.TestOutputsPath = odir
 
@@ -143,22 +174,33 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 
 			logging.S().Infow("starting test case instance", "plan", name, "group", g.ID, "number", i, "total", total)
 
-			cmd := exec.CommandContext(ctx, g.ArtifactPath)
-			stdout, _ := cmd.StdoutPipe()
-			stderr, _ := cmd.StderrPipe()
-			cmd.Env = env
-
-			if err := cmd.Start(); err != nil {
+			in, stdout, stderr, err := startExecInstance(ctx, g.ArtifactPath, env)
+			if err != nil {
 				pretty.FailStart(id, err)
 				continue
 			}
 
-			commands = append(commands, cmd)
+			instances = append(instances, in)
+			if lifecycle != nil {
+				lifecycle.add(g.ID, i, in)
+			}
 
 			pretty.Manage(id, stdout, stderr)
 		}
 	}
 
+	if lifecycle != nil {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go lifecycle.handleRequests(ctx)
+		for _, g := range input.Groups {
+			if g.Churn != nil {
+				go lifecycle.enforceChurn(ctx, g.ID, g.Instances, g.Churn)
+			}
+		}
+	}
+
 	if err := pretty.Wait(); err != nil {
 		return nil, err
 	}
@@ -175,6 +217,8 @@ func (*LocalExecutableRunner) ID() string {
 	return "local:exec"
 }
 
+func (*LocalExecutableRunner) SupportsChurn() {}
+
 func (*LocalExecutableRunner) ConfigType() reflect.Type {
 	return reflect.TypeOf(LocalExecutableRunnerCfg{})
 }
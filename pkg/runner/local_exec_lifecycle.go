@@ -0,0 +1,279 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/sdk/runtime"
+	tgsync "github.com/ipfs/testground/sdk/sync"
+)
+
+// execInstance is a test instance running as a local process. Its output goes
+// through pipes that outlive the process, so that restarting the instance
+// doesn't interrupt the output handed to the pretty printer.
+type execInstance struct {
+	path string
+	env  []string
+
+	stdout, stderr *io.PipeWriter
+
+	lk  sync.Mutex
+	cmd *exec.Cmd
+	// exited is closed when the current process exits.
+	exited chan struct{}
+	// gen is bumped every time the process is replaced, so that the exit of
+	// a replaced process doesn't close the output.
+	gen int
+	// stopped is set once the instance won't be started again.
+	stopped bool
+}
+
+// startExecInstance starts a test instance, and returns its stdout and stderr.
+func startExecInstance(ctx context.Context, path string, env []string) (*execInstance, io.ReadCloser, io.ReadCloser, error) {
+	rstdout, wstdout := io.Pipe()
+	rstderr, wstderr := io.Pipe()
+
+	in := &execInstance{path: path, env: env, stdout: wstdout, stderr: wstderr}
+
+	in.lk.Lock()
+	defer in.lk.Unlock()
+
+	if err := in.start(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+	return in, rstdout, rstderr, nil
+}
+
+// start starts a new process for the instance. It must be called with the lock
+// held.
+func (in *execInstance) start(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, in.path)
+	cmd.Env = in.env
+	cmd.Stdout, cmd.Stderr = in.stdout, in.stderr
+
+	if err := cmd.Start(); err != nil {
+		in.stopped = true
+		_ = in.stdout.Close()
+		_ = in.stderr.Close()
+		return err
+	}
+
+	in.gen++
+	gen, exited := in.gen, make(chan struct{})
+	in.cmd, in.exited = cmd, exited
+
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+
+		in.lk.Lock()
+		defer in.lk.Unlock()
+		if in.gen == gen {
+			in.stopped = true
+			_ = in.stdout.Close()
+			_ = in.stderr.Close()
+		}
+	}()
+	return nil
+}
+
+// signal sends a signal to the process of the instance.
+func (in *execInstance) signal(sig os.Signal) error {
+	in.lk.Lock()
+	defer in.lk.Unlock()
+
+	if in.stopped {
+		return errors.New("instance has exited")
+	}
+	return in.cmd.Process.Signal(sig)
+}
+
+// restart kills the process of the instance, and starts a new one.
+func (in *execInstance) restart(ctx context.Context) error {
+	in.lk.Lock()
+	if in.stopped {
+		in.lk.Unlock()
+		return errors.New("instance has exited")
+	}
+	// supersede the running process before killing it.
+	in.gen++
+	cmd, exited := in.cmd, in.exited
+	in.lk.Unlock()
+
+	_ = cmd.Process.Kill()
+	<-exited
+
+	in.lk.Lock()
+	defer in.lk.Unlock()
+
+	if in.stopped {
+		return errors.New("instance was stopped while restarting")
+	}
+	return in.start(ctx)
+}
+
+// stop kills the process of the instance for good, and waits for it to exit.
+func (in *execInstance) stop() {
+	in.lk.Lock()
+	in.stopped = true
+	cmd, exited := in.cmd, in.exited
+	in.lk.Unlock()
+
+	_ = cmd.Process.Kill()
+	<-exited
+
+	// if a restart was superseding the process, nobody else closes the output.
+	in.lk.Lock()
+	defer in.lk.Unlock()
+	_ = in.stdout.Close()
+	_ = in.stderr.Close()
+}
+
+// execLifecycle answers the lifecycle requests of the instances of a local:exec
+// run, and enforces the churn of its groups.
+type execLifecycle struct {
+	runID   string
+	watcher *tgsync.Watcher
+	writer  *tgsync.Writer
+
+	lk sync.Mutex
+	// instances are the instances of each group, by index.
+	instances map[string][]*execInstance
+}
+
+// newExecLifecycle connects to the sync service of the run.
+func newExecLifecycle(ctx context.Context, template runtime.RunParams) (*execLifecycle, error) {
+	watcher, writer, err := tgsync.WatcherWriter(ctx, runtime.NewRunEnv(template))
+	if err != nil {
+		return nil, err
+	}
+
+	return &execLifecycle{
+		runID:     template.TestRun,
+		watcher:   watcher,
+		writer:    writer,
+		instances: make(map[string][]*execInstance),
+	}, nil
+}
+
+// add registers the instance with the given index in its group. Instances that
+// failed to start are registered as nil.
+func (l *execLifecycle) add(group string, index int, in *execInstance) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	for len(l.instances[group]) <= index {
+		l.instances[group] = append(l.instances[group], nil)
+	}
+	l.instances[group][index] = in
+}
+
+func (l *execLifecycle) get(group string, index int) *execInstance {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if index < 0 || index >= len(l.instances[group]) {
+		return nil
+	}
+	return l.instances[group][index]
+}
+
+// perform performs a lifecycle action on an instance.
+func (l *execLifecycle) perform(ctx context.Context, group string, index int, action tgsync.LifecycleAction) error {
+	in := l.get(group, index)
+	if in == nil {
+		return fmt.Errorf("unknown instance %s/%d", group, index)
+	}
+
+	switch action {
+	case tgsync.LifecyclePause:
+		return in.signal(syscall.SIGSTOP)
+	case tgsync.LifecycleUnpause:
+		return in.signal(syscall.SIGCONT)
+	case tgsync.LifecycleKill:
+		return in.signal(os.Kill)
+	case tgsync.LifecycleRestart:
+		return in.restart(ctx)
+	default:
+		return fmt.Errorf("unknown lifecycle action %q", action)
+	}
+}
+
+// handleRequests performs the lifecycle requests of the run, until the context
+// fires.
+func (l *execLifecycle) handleRequests(ctx context.Context) {
+	log := logging.S().With("runner", "local:exec", "run_id", l.runID)
+
+	requests := make(chan *tgsync.LifecycleRequest, 16)
+	if err := l.watcher.Subscribe(ctx, tgsync.LifecycleSubtree, requests); err != nil {
+		log.Warnw("failed to subscribe to lifecycle requests", "err", err)
+		return
+	}
+
+	for req := range requests {
+		log.Infow("performing lifecycle request", "group", req.Group, "instance", req.Instance, "action", req.Action)
+		if err := l.perform(ctx, req.Group, req.Instance, req.Action); err != nil {
+			log.Warnw("lifecycle request failed", "group", req.Group, "instance", req.Instance, "action", req.Action, "err", err)
+			continue
+		}
+		if req.State != "" {
+			if _, err := l.writer.SignalEntry(ctx, req.State); err != nil {
+				log.Warnw("failed to signal lifecycle state", "state", req.State, "err", err)
+			}
+		}
+	}
+}
+
+// enforceChurn performs the churn action on the selected instances of the
+// group at every tick, until the context fires.
+func (l *execLifecycle) enforceChurn(ctx context.Context, group string, instances int, churn *api.Churn) {
+	log := logging.S().With("runner", "local:exec", "run_id", l.runID, "group", group)
+	action := tgsync.LifecycleAction(churn.Action)
+
+	for {
+		_, next := churn.Tick(time.Now())
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctx.Done():
+			return
+		}
+
+		tick, _ := churn.Tick(time.Now())
+		selected := churn.Selected(l.runID, group, tick, instances)
+		log.Infow("churning instances", "action", action, "tick", tick, "instances", selected)
+
+		for _, i := range selected {
+			if err := l.perform(ctx, group, i, action); err != nil {
+				log.Debugw("churn failed", "instance", i, "action", action, "err", err)
+			}
+		}
+
+		if action != tgsync.LifecyclePause {
+			continue
+		}
+		select {
+		case <-time.After(churn.DowntimeDuration()):
+		case <-ctx.Done():
+		}
+		for _, i := range selected {
+			if err := l.perform(ctx, group, i, tgsync.LifecycleUnpause); err != nil {
+				log.Debugw("churn failed", "instance", i, "action", tgsync.LifecycleUnpause, "err", err)
+			}
+		}
+	}
+}
+
+// Close disconnects from the sync service.
+func (l *execLifecycle) Close() error {
+	_ = l.watcher.Close()
+	return l.writer.Close()
+}
@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+)
+
+func TestExecInstanceRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec-instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "instance.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\necho started\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	in, stdout, stderr, err := startExecInstance(context.Background(), script, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _, _ = ioutil.ReadAll(stderr) }()
+
+	lines := bufio.NewScanner(stdout)
+	expectLine := func() {
+		t.Helper()
+		if !lines.Scan() || lines.Text() != "started" {
+			t.Fatalf("expected the instance to start; got %q, %v", lines.Text(), lines.Err())
+		}
+	}
+
+	expectLine()
+
+	// the output carries on across restarts.
+	if err := in.restart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectLine()
+
+	// the output ends once the instance is stopped.
+	in.stop()
+	if lines.Scan() {
+		t.Errorf("unexpected output after stopping: %q", lines.Text())
+	}
+	if err := in.restart(context.Background()); err == nil {
+		t.Error("expected restarting a stopped instance to fail")
+	}
+}
+
+func TestLocalExecLifecycle(t *testing.T) {
+	var (
+		plain   = []api.RunGroup{{ID: "a"}, {ID: "b"}}
+		churned = []api.RunGroup{{ID: "a"}, {ID: "b", Churn: &api.Churn{Action: "restart"}}}
+	)
+
+	var tests = []struct {
+		cfg      *LocalExecutableRunnerCfg
+		groups   []api.RunGroup
+		expected bool
+	}{
+		{nil, plain, false},
+		{&LocalExecutableRunnerCfg{}, plain, false},
+		{&LocalExecutableRunnerCfg{Lifecycle: true}, plain, true},
+		{nil, churned, true},
+		{&LocalExecutableRunnerCfg{}, churned, true},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.cfg.lifecycle(tt.groups); actual != tt.expected {
+			t.Errorf("lifecycle(%+v) with churn %t: expected %t, got %t", tt.cfg, tt.groups[1].Churn != nil, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// nomadClient is a minimal client of the Nomad HTTP API, covering what the
+// cluster:nomad runner needs: registering and deregistering jobs, inspecting
+// their evaluations and allocations, and reading the logs and files of
+// allocations.
+type nomadClient struct {
+	addr   string
+	token  string
+	region string
+	http   *http.Client
+}
+
+// nomadJob is the subset of the Nomad job specification the runner uses.
+type nomadJob struct {
+	ID          string
+	Name        string
+	Type        string
+	Region      string            `json:",omitempty"`
+	Datacenters []string          `json:",omitempty"`
+	Meta        map[string]string `json:",omitempty"`
+	TaskGroups  []*nomadTaskGroup
+}
+
+type nomadTaskGroup struct {
+	Name             string
+	Count            int
+	Meta             map[string]string `json:",omitempty"`
+	RestartPolicy    *nomadRestartPolicy
+	ReschedulePolicy *nomadReschedulePolicy
+	Tasks            []*nomadTask
+}
+
+type nomadRestartPolicy struct {
+	Attempts int
+	Mode     string
+}
+
+type nomadReschedulePolicy struct {
+	Attempts  int
+	Unlimited bool
+}
+
+type nomadTask struct {
+	Name      string
+	Driver    string
+	Config    map[string]interface{}
+	Env       map[string]string `json:",omitempty"`
+	Meta      map[string]string `json:",omitempty"`
+	Resources *nomadResources   `json:",omitempty"`
+}
+
+type nomadResources struct {
+	CPU      int `json:",omitempty"`
+	MemoryMB int `json:",omitempty"`
+}
+
+type nomadEvaluation struct {
+	ID             string
+	Status         string
+	FailedTGAllocs map[string]*nomadAllocMetric
+}
+
+type nomadAllocMetric struct {
+	NodesEvaluated     int
+	NodesExhausted     int
+	DimensionExhausted map[string]int
+	ConstraintFiltered map[string]int
+}
+
+type nomadAllocation struct {
+	ID           string
+	Name         string
+	NodeID       string
+	TaskGroup    string
+	ClientStatus string
+	TaskStates   map[string]*nomadTaskState
+}
+
+type nomadTaskState struct {
+	State     string
+	Failed    bool
+	StartedAt time.Time
+	Events    []*nomadTaskEvent
+}
+
+type nomadTaskEvent struct {
+	Type           string
+	DisplayMessage string
+}
+
+type nomadFile struct {
+	Name  string
+	IsDir bool
+}
+
+// terminal returns whether the allocation has stopped running for good.
+func (a *nomadAllocation) terminal() bool {
+	switch a.ClientStatus {
+	case "complete", "failed", "lost":
+		return true
+	}
+	return false
+}
+
+func newNomadClient(addr, token, region string) *nomadClient {
+	return &nomadClient{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		region: region,
+		http:   &http.Client{},
+	}
+}
+
+// do performs a request against the Nomad API, and returns the response body,
+// which the caller must close. Non-2xx responses are turned into errors.
+func (c *nomadClient) do(ctx context.Context, method, path string, query url.Values, body interface{}) (io.ReadCloser, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.region != "" {
+		query.Set("region", c.region)
+	}
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+path+"?"+query.Encode(), r)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("nomad: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
+
+// decode performs a request, and decodes the JSON response into v.
+func (c *nomadClient) decode(ctx context.Context, method, path string, query url.Values, body interface{}, v interface{}) error {
+	rc, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if v == nil {
+		_, err = io.Copy(ioutil.Discard, rc)
+		return err
+	}
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// register submits the job, and returns the ID of the evaluation it triggered.
+func (c *nomadClient) register(ctx context.Context, job *nomadJob) (string, error) {
+	var resp struct{ EvalID string }
+	err := c.decode(ctx, http.MethodPut, "/v1/jobs", nil, map[string]interface{}{"Job": job}, &resp)
+	return resp.EvalID, err
+}
+
+// deregister stops the job. If purge is true, the job and its allocations are
+// garbage collected right away, along with their logs and files.
+func (c *nomadClient) deregister(ctx context.Context, jobID string, purge bool) error {
+	q := url.Values{"purge": {fmt.Sprint(purge)}}
+	return c.decode(ctx, http.MethodDelete, "/v1/job/"+url.PathEscape(jobID), q, nil, nil)
+}
+
+// jobs lists the IDs of the jobs whose IDs start with prefix.
+func (c *nomadClient) jobs(ctx context.Context, prefix string) ([]string, error) {
+	var jobs []struct{ ID string }
+	if err := c.decode(ctx, http.MethodGet, "/v1/jobs", url.Values{"prefix": {prefix}}, nil, &jobs); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(jobs))
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+	return ids, nil
+}
+
+func (c *nomadClient) evaluation(ctx context.Context, id string) (*nomadEvaluation, error) {
+	eval := new(nomadEvaluation)
+	err := c.decode(ctx, http.MethodGet, "/v1/evaluation/"+url.PathEscape(id), nil, nil, eval)
+	return eval, err
+}
+
+func (c *nomadClient) allocations(ctx context.Context, jobID string) ([]*nomadAllocation, error) {
+	var allocs []*nomadAllocation
+	err := c.decode(ctx, http.MethodGet, "/v1/job/"+url.PathEscape(jobID)+"/allocations", nil, nil, &allocs)
+	return allocs, err
+}
+
+// logs streams the stdout or stderr (typ) of a task, from the start, following
+// it until the returned stream is closed.
+func (c *nomadClient) logs(ctx context.Context, allocID, task, typ string) (io.ReadCloser, error) {
+	q := url.Values{
+		"task":   {task},
+		"type":   {typ},
+		"follow": {"true"},
+		"origin": {"start"},
+		"offset": {"0"},
+		"plain":  {"true"},
+	}
+	return c.do(ctx, http.MethodGet, "/v1/client/fs/logs/"+url.PathEscape(allocID), q, nil)
+}
+
+// ls lists the files in a directory of the allocation.
+func (c *nomadClient) ls(ctx context.Context, allocID, path string) ([]*nomadFile, error) {
+	var files []*nomadFile
+	err := c.decode(ctx, http.MethodGet, "/v1/client/fs/ls/"+url.PathEscape(allocID), url.Values{"path": {path}}, nil, &files)
+	return files, err
+}
+
+// cat reads a file of the allocation.
+func (c *nomadClient) cat(ctx context.Context, allocID, path string) (io.ReadCloser, error) {
+	return c.do(ctx, http.MethodGet, "/v1/client/fs/cat/"+url.PathEscape(allocID), url.Values{"path": {path}}, nil)
+}
@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ipfs/testground/pkg/api"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// outputsStore is where the daemon finds the outputs that instances running on
+// a cluster wrote to a shared volume. Outputs are laid out as
+// <plan>/<run_id>/<group_id>/<instance>/..., as with the local runners.
+type outputsStore interface {
+	// zipRunOutputs zips the outputs of a run into w, as
+	// <run_id>/<group_id>/<instance>/..., like zipRunOutputs does.
+	zipRunOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error
+}
+
+// fsOutputsStore is a store backed by a directory of the daemon host, e.g. the
+// mount point of the shared volume.
+type fsOutputsStore struct {
+	dir string
+	// rename, if not nil, names the entries of the archive.
+	rename func(string) string
+}
+
+func (s *fsOutputsStore) zipRunOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
+	return zipRunOutputsAs(ctx, s.dir, input, s.rename, w)
+}
+
+// s3OutputsStore is a store backed by an S3 bucket, or by an S3-compatible
+// object store such as MinIO if an endpoint is set.
+type s3OutputsStore struct {
+	bucket   string
+	region   string
+	endpoint string
+	// rename, if not nil, names the entries of the archive.
+	rename func(string) string
+}
+
+func (s *s3OutputsStore) session() (*session.Session, error) {
+	cfg := &aws.Config{Region: aws.String(s.region)}
+	if s.endpoint != "" {
+		// S3-compatible stores are usually addressed by path, not by
+		// bucket subdomain.
+		cfg.Endpoint = aws.String(s.endpoint)
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	return session.NewSession(cfg)
+}
+
+func (s *s3OutputsStore) zipRunOutputs(ctx context.Context, input *api.CollectionInput, w io.Writer) error {
+	sess, err := s.session()
+	if err != nil {
+		return fmt.Errorf("couldn't establish a session with the outputs store: %w", err)
+	}
+	svc := s3.New(sess)
+
+	// The plan is the first level of the layout; find the one holding the run.
+	var prefix string
+	query := s3.ListObjectsV2Input{Bucket: aws.String(s.bucket), Delimiter: aws.String("/")}
+	err = svc.ListObjectsV2PagesWithContext(ctx, &query, func(resp *s3.ListObjectsV2Output, last bool) bool {
+		for _, p := range resp.CommonPrefixes {
+			plan := aws.StringValue(p.Prefix)
+			res, err := svc.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+				Bucket:  aws.String(s.bucket),
+				Prefix:  aws.String(plan + input.RunID + "/"),
+				MaxKeys: aws.Int64(1),
+			})
+			if err == nil && len(res.Contents) > 0 {
+				prefix = plan
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list items in bucket %q: %w", s.bucket, err)
+	}
+	if prefix == "" {
+		return fmt.Errorf("run ID %s not found with runner %s", input.RunID, input.RunnerID)
+	}
+
+	return zipS3Prefix(ctx, sess, s.bucket, prefix+input.RunID+"/", prefix, s.rename, w)
+}
+
+// zipS3Prefix zips all objects under prefix in the bucket, naming entries after
+// their keys with strip removed, and passed through rename if not nil.
+func zipS3Prefix(ctx context.Context, sess *session.Session, bucket, prefix, strip string, rename func(string) string, w io.Writer) (err error) {
+	var (
+		svc        = s3.New(sess)
+		downloader = s3manager.NewDownloader(sess)
+		zw         = zip.NewWriter(w)
+	)
+	downloader.Concurrency = 1 // force sequential downloads.
+	// closing writes the central directory of the archive; an archive without
+	// it is truncated.
+	defer func() {
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	query := s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	for {
+		resp, err := svc.ListObjectsV2WithContext(ctx, &query)
+		if err != nil {
+			return fmt.Errorf("unable to list items in bucket %q: %w", bucket, err)
+		}
+
+		for _, item := range resp.Contents {
+			name := strings.TrimPrefix(aws.StringValue(item.Key), strip)
+			if rename != nil {
+				name = rename(name)
+			}
+			ww, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+			if err != nil {
+				return fmt.Errorf("couldn't add file to the zip archive: %w", err)
+			}
+
+			_, err = downloader.DownloadWithContext(ctx, FakeWriterAt{ww}, &s3.GetObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    item.Key,
+			})
+			if err != nil {
+				return fmt.Errorf("couldn't download item %s: %w", aws.StringValue(item.Key), err)
+			}
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		query.SetContinuationToken(aws.StringValue(resp.NextContinuationToken))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+)
+
+func TestSwarmCollectOutputsFromFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range []string{"dht/a1b2c3/seeds/1/run.out", "dht/a1b2c3/seeds/2/run.out", "dht/d4e5f6/seeds/1/run.out"} {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	input := &api.CollectionInput{
+		RunID:        "a1b2c3",
+		RunnerID:     "cluster:swarm",
+		RunnerConfig: &ClusterSwarmRunnerConfig{OutputsDir: dir},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := (&ClusterSwarmRunner{}).CollectOutputs(context.Background(), input, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f.Name)
+		}
+	}
+	sort.Strings(files)
+
+	// task slots are 1-based; the archive is laid out by instance index.
+	expected := []string{"a1b2c3/seeds/0/run.out", "a1b2c3/seeds/1/run.out"}
+	if len(files) != len(expected) || files[0] != expected[0] || files[1] != expected[1] {
+		t.Errorf("expected files %v; got %v", expected, files)
+	}
+}
+
+func TestSlotToIndex(t *testing.T) {
+	var tests = []struct {
+		name, expected string
+	}{
+		{"a1b2c3", "a1b2c3"},
+		{"a1b2c3/seeds/", "a1b2c3/seeds/"},
+		{"a1b2c3/seeds/1", "a1b2c3/seeds/0"},
+		{"a1b2c3/seeds/1/", "a1b2c3/seeds/0/"},
+		{"a1b2c3/seeds/12/logs/run.out", "a1b2c3/seeds/11/logs/run.out"},
+		{"a1b2c3/seeds/0/run.out", "a1b2c3/seeds/0/run.out"},
+		{"a1b2c3/seeds/extra/run.out", "a1b2c3/seeds/extra/run.out"},
+	}
+
+	for _, tt := range tests {
+		if got := slotToIndex(tt.name); got != tt.expected {
+			t.Errorf("slotToIndex(%q) = %q; expected %q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestSwarmOutputsStore(t *testing.T) {
+	var tests = []struct {
+		cfg      ClusterSwarmRunnerConfig
+		hasError bool
+	}{
+		{ClusterSwarmRunnerConfig{}, true},
+		{ClusterSwarmRunnerConfig{OutputsDir: "/mnt/outputs"}, false},
+		{ClusterSwarmRunnerConfig{OutputsStore: "s3"}, true},
+		{ClusterSwarmRunnerConfig{OutputsStore: "s3", OutputsBucket: "outputs", OutputsEndpoint: "http://minio:9000"}, false},
+		{ClusterSwarmRunnerConfig{OutputsStore: "ftp"}, true},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.cfg.outputsStore(); (err != nil) != tt.hasError {
+			t.Errorf("outputsStore() for %+v: got error %v, expected error: %t", tt.cfg, err, tt.hasError)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/ipfs/testground/pkg/api"
 	"github.com/ipfs/testground/pkg/logging"
 	"github.com/ipfs/testground/sdk/runtime"
 
@@ -46,13 +47,19 @@ type PrettyPrinter struct {
 
 	start time.Time
 	wg    sync.WaitGroup
+
+	// events receives the structured instance events; see api.WriteEvent.
+	events io.Writer
 }
 
-// NewPrettyPrinter constructs a new console logger.
-func NewPrettyPrinter() *PrettyPrinter {
+// NewPrettyPrinter constructs a new console logger. Instance lifecycle events,
+// metrics and messages are additionally emitted as structured events to ow,
+// if it supports them.
+func NewPrettyPrinter(ow io.Writer) *PrettyPrinter {
 	au := aurora.NewAurora(logging.IsTerminal())
 	return &PrettyPrinter{
 		aurora: au,
+		events: ow,
 		classes: [...]aurora.Value{
 			aurora.BgRed("ERROR").White(),
 			aurora.BgBrightCyan("START").Black(),
@@ -85,6 +92,11 @@ func (c *PrettyPrinter) FailStart(id string, message interface{}) {
 	cnt := atomic.AddUint32(&c.count, 1)
 	atomic.AddUint32(&c.failed, 1)
 	c.print(cnt-1, id, time.Now(), Incomplete, "failed to start:", message)
+	c.emit(api.EventTypeInstanceFinish, time.Now(), &api.InstanceEvent{
+		Instance: id,
+		Outcome:  "incomplete",
+		Error:    fmt.Sprint(message),
+	})
 }
 
 // processStderr processes unstructured log output that's not managed by zap, in
@@ -109,6 +121,7 @@ func (c *PrettyPrinter) processStdout(idx uint32, id string, stdout io.ReadClose
 
 	var (
 		failed, ok bool
+		group      string
 		all        = make(map[string]json.RawMessage, 16)
 	)
 
@@ -116,6 +129,11 @@ func (c *PrettyPrinter) processStdout(idx uint32, id string, stdout io.ReadClose
 		if !ok && !failed {
 			// incomplete.
 			c.print(idx, id, time.Now(), Incomplete)
+			c.emit(api.EventTypeInstanceFinish, time.Now(), &api.InstanceEvent{
+				Instance: id,
+				GroupID:  group,
+				Outcome:  "incomplete",
+			})
 		}
 		if !ok || failed {
 			atomic.AddUint32(&c.failed, 1)
@@ -170,17 +188,41 @@ func (c *PrettyPrinter) processStdout(idx uint32, id string, stdout io.ReadClose
 				c.print(idx, id, ts, InternalErr, fmt.Sprintf("unknown outcome: %s", evt.Outcome))
 				return
 			}
+			c.emit(api.EventTypeInstanceFinish, ts, &api.InstanceEvent{
+				Instance: id,
+				GroupID:  group,
+				Outcome:  string(evt.Outcome),
+				Error:    evt.Error,
+			})
 
 		case runtime.EventTypeMetric:
 			m, _ := json.Marshal(evt.Metric)
 			c.print(idx, id, ts, Metric, string(m))
+			c.emit(api.EventTypeMetric, ts, &api.InstanceEvent{
+				Instance: id,
+				GroupID:  group,
+				Metric:   evt.Metric,
+			})
 
 		case runtime.EventTypeMessage:
 			c.print(idx, id, ts, Message, evt.Message)
+			c.emit(api.EventTypeMessage, ts, &api.InstanceEvent{
+				Instance: id,
+				GroupID:  group,
+				Message:  evt.Message,
+			})
 
 		case runtime.EventTypeStart:
 			m, _ := json.Marshal(evt.Runenv)
 			c.print(idx, id, ts, Start, string(m))
+			if evt.Runenv != nil {
+				group = evt.Runenv.TestGroupID
+			}
+			c.emit(api.EventTypeInstanceStart, ts, &api.InstanceEvent{
+				Instance: id,
+				GroupID:  group,
+				Runenv:   evt.Runenv,
+			})
 		}
 	}
 }
@@ -202,6 +244,18 @@ func (c *PrettyPrinter) Manage(id string, stdout, stderr io.ReadCloser) {
 	}()
 }
 
+// emit sends a structured instance event to the events writer, if any.
+func (c *PrettyPrinter) emit(typ api.EventType, ts time.Time, evt *api.InstanceEvent) {
+	if c.events == nil {
+		return
+	}
+	api.WriteEvent(c.events, &api.Event{
+		Type:      typ,
+		Timestamp: ts,
+		Instance:  evt,
+	})
+}
+
 func (c *PrettyPrinter) print(idx uint32, id string, now time.Time, evtType eventType, message ...interface{}) {
 	var (
 		elapsed = now.Sub(c.start)
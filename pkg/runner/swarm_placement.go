@@ -0,0 +1,254 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+)
+
+var (
+	// defaultSwarmConstraints places instances on the worker nodes.
+	defaultSwarmConstraints = []string{"node.labels.TGRole==worker"}
+
+	// defaultSwarmMaxReplicas is the default maximum number of instances of a
+	// group on a single node.
+	defaultSwarmMaxReplicas uint64 = 10000
+
+	// defaultSwarmMemoryLimit and defaultSwarmMemoryReservation are the memory
+	// limit and reservation of instances of groups that don't set them.
+	defaultSwarmMemoryLimit       int64 = 30 * 1024 * 1024
+	defaultSwarmMemoryReservation int64 = 60 * 1024 * 1024
+)
+
+// swarmTaskSettings are the placement, resources and restart policy of the
+// tasks of a group.
+type swarmTaskSettings struct {
+	placement *swarm.Placement
+	resources *swarm.ResourceRequirements
+	restart   *swarm.RestartPolicy
+
+	// summary is a human-readable summary of the resources.
+	summary map[string]string
+}
+
+// taskSettings builds the task settings of a group from its configuration.
+func (c *ClusterSwarmRunnerConfig) taskSettings() (*swarmTaskSettings, error) {
+	s := &swarmTaskSettings{
+		placement: &swarm.Placement{MaxReplicas: defaultSwarmMaxReplicas, Constraints: defaultSwarmConstraints},
+		resources: &swarm.ResourceRequirements{
+			Limits:       &swarm.Resources{MemoryBytes: defaultSwarmMemoryLimit},
+			Reservations: &swarm.Resources{MemoryBytes: defaultSwarmMemoryReservation},
+		},
+		restart: &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionNone},
+		summary: make(map[string]string),
+	}
+
+	// placement.
+	if len(c.PlacementConstraints) > 0 {
+		for _, constraint := range c.PlacementConstraints {
+			if !strings.Contains(constraint, "==") && !strings.Contains(constraint, "!=") {
+				return nil, fmt.Errorf("invalid placement constraint %q; expected <key>==<value> or <key>!=<value>", constraint)
+			}
+		}
+		s.placement.Constraints = c.PlacementConstraints
+	}
+	for _, descriptor := range c.PlacementPreferences {
+		s.placement.Preferences = append(s.placement.Preferences, swarm.PlacementPreference{
+			Spread: &swarm.SpreadOver{SpreadDescriptor: descriptor},
+		})
+	}
+	if c.MaxReplicasPerNode > 0 {
+		s.placement.MaxReplicas = c.MaxReplicasPerNode
+	}
+
+	// resources.
+	if c.CPULimit > 0 {
+		s.resources.Limits.NanoCPUs = int64(c.CPULimit * 1e9)
+		s.summary["cpu_limit"] = strconv.FormatFloat(c.CPULimit, 'f', -1, 64)
+	}
+	if c.CPUReservation > 0 {
+		s.resources.Reservations.NanoCPUs = int64(c.CPUReservation * 1e9)
+		s.summary["cpu_reservation"] = strconv.FormatFloat(c.CPUReservation, 'f', -1, 64)
+	}
+	if c.MemoryLimit != "" {
+		b, err := units.RAMInBytes(c.MemoryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory limit %q: %w", c.MemoryLimit, err)
+		}
+		s.resources.Limits.MemoryBytes = b
+	}
+	if c.MemoryReservation != "" {
+		b, err := units.RAMInBytes(c.MemoryReservation)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory reservation %q: %w", c.MemoryReservation, err)
+		}
+		s.resources.Reservations.MemoryBytes = b
+	}
+	// the defaults predate these settings, and the default reservation exceeds
+	// the default limit. When only one of them is set, the default of the other
+	// gives way to it; only check them when both are set.
+	switch limit, reservation := &s.resources.Limits.MemoryBytes, &s.resources.Reservations.MemoryBytes; {
+	case c.MemoryLimit != "" && c.MemoryReservation == "" && *reservation > *limit:
+		*reservation = *limit
+	case c.MemoryReservation != "" && c.MemoryLimit == "" && *reservation > *limit:
+		*limit = *reservation
+	case c.MemoryLimit != "" && c.MemoryReservation != "" && *reservation > *limit:
+		return nil, fmt.Errorf("memory reservation (%s) exceeds the memory limit (%s)",
+			units.BytesSize(float64(*reservation)), units.BytesSize(float64(*limit)))
+	}
+	if c.CPULimit > 0 && c.CPUReservation > c.CPULimit {
+		return nil, fmt.Errorf("cpu reservation (%v) exceeds the cpu limit (%v)", c.CPUReservation, c.CPULimit)
+	}
+	s.summary["memory_limit"] = units.BytesSize(float64(s.resources.Limits.MemoryBytes))
+	s.summary["memory_reservation"] = units.BytesSize(float64(s.resources.Reservations.MemoryBytes))
+
+	// restart policy.
+	switch c.RestartPolicy {
+	case "", "none":
+	case "on-failure":
+		s.restart.Condition = swarm.RestartPolicyConditionOnFailure
+	case "any":
+		s.restart.Condition = swarm.RestartPolicyConditionAny
+	default:
+		return nil, fmt.Errorf("unknown restart policy %q; supported: none, on-failure, any", c.RestartPolicy)
+	}
+	if s.restart.Condition != swarm.RestartPolicyConditionNone {
+		if c.RestartMaxAttempts > 0 {
+			attempts := c.RestartMaxAttempts
+			s.restart.MaxAttempts = &attempts
+		}
+		if c.RestartDelay != "" {
+			d, err := time.ParseDuration(c.RestartDelay)
+			if err != nil {
+				return nil, fmt.Errorf("invalid restart delay %q: %w", c.RestartDelay, err)
+			}
+			s.restart.Delay = &d
+		}
+	}
+
+	return s, nil
+}
+
+// latestTasks returns the latest task of each slot, i.e. the tasks that
+// haven't been replaced by a restart.
+func latestTasks(tasks []swarm.Task) []swarm.Task {
+	latest := make(map[int]swarm.Task, len(tasks))
+	for _, t := range tasks {
+		if l, ok := latest[t.Slot]; !ok || t.Meta.Version.Index > l.Meta.Version.Index {
+			latest[t.Slot] = t
+		}
+	}
+
+	res := make([]swarm.Task, 0, len(latest))
+	for _, t := range latest {
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Slot < res[j].Slot })
+	return res
+}
+
+// swarmAPI is the subset of the docker client used to monitor the tasks of a
+// run. It's satisfied by *client.Client.
+type swarmAPI interface {
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
+	NodeInspectWithRaw(ctx context.Context, nodeID string) (swarm.Node, []byte, error)
+}
+
+var _ swarmAPI = (*client.Client)(nil)
+
+// swarmNodes resolves the IDs of swarm nodes to their hostnames, caching the
+// results. It's safe for concurrent use.
+type swarmNodes struct {
+	cli swarmAPI
+
+	lk        sync.Mutex
+	hostnames map[string]string
+}
+
+func newSwarmNodes(cli swarmAPI) *swarmNodes {
+	return &swarmNodes{cli: cli, hostnames: make(map[string]string)}
+}
+
+// hostname returns the hostname of the node, or its ID if it can't be
+// inspected.
+func (n *swarmNodes) hostname(ctx context.Context, id string) string {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	if h, ok := n.hostnames[id]; ok {
+		return h
+	}
+
+	node, _, err := n.cli.NodeInspectWithRaw(ctx, id)
+	if err != nil || node.Description.Hostname == "" {
+		return id
+	}
+	n.hostnames[id] = node.Description.Hostname
+	return node.Description.Hostname
+}
+
+// monitorSwarmService polls the tasks of the service every interval, recording
+// the nodes they were placed on in the summary of their group, until all of
+// them have finished.
+func monitorSwarmService(ctx context.Context, cli swarmAPI, nodes *swarmNodes, service string, summary *api.GroupSummary, interval time.Duration) error {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	var (
+		count = summary.Instances
+		// placed are the tasks whose node was already reported.
+		placed = make(map[string]struct{}, count)
+	)
+
+	for range tick.C {
+		var finished int
+		tasks, err := cli.TaskList(ctx, types.TaskListOptions{
+			Filters: filters.NewArgs(filters.Arg("service", service)),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// tasks that are restarted are replaced by new tasks in the
+		// same slot; only the latest task of each slot counts.
+		tasks = latestTasks(tasks)
+
+		status := make(map[swarm.TaskState]uint64, count)
+		summary.Nodes = make(map[string]int, count)
+		for _, t := range tasks {
+			if t.NodeID != "" {
+				node := nodes.hostname(ctx, t.NodeID)
+				if _, ok := placed[t.ID]; !ok {
+					placed[t.ID] = struct{}{}
+					logging.S().Infow("task placed", "service", service, "group", summary.ID, "slot", t.Slot, "node", node)
+				}
+				summary.Nodes[node]++
+			}
+
+			s := t.Status.State
+			switch status[s]++; s {
+			case swarm.TaskStateShutdown, swarm.TaskStateComplete, swarm.TaskStateFailed, swarm.TaskStateRejected:
+				finished++
+			}
+		}
+		logging.S().Infow("task status", "service", service, "status", status)
+		if finished == count {
+			break
+		}
+	}
+	return nil
+}
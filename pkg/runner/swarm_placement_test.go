@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestSwarmTaskSettings(t *testing.T) {
+	var tests = []struct {
+		cfg      ClusterSwarmRunnerConfig
+		hasError bool
+	}{
+		{ClusterSwarmRunnerConfig{}, false},
+		{ClusterSwarmRunnerConfig{PlacementConstraints: []string{"node.labels.zone==a"}}, false},
+		{ClusterSwarmRunnerConfig{PlacementConstraints: []string{"node.labels.zone"}}, true},
+		{ClusterSwarmRunnerConfig{MemoryLimit: "1GiB", MemoryReservation: "512MiB"}, false},
+		{ClusterSwarmRunnerConfig{MemoryLimit: "256MiB", MemoryReservation: "512MiB"}, true},
+		{ClusterSwarmRunnerConfig{MemoryLimit: "40MiB"}, false},
+		{ClusterSwarmRunnerConfig{MemoryReservation: "100MiB"}, false},
+		{ClusterSwarmRunnerConfig{MemoryLimit: "lots"}, true},
+		{ClusterSwarmRunnerConfig{CPULimit: 1, CPUReservation: 2}, true},
+		{ClusterSwarmRunnerConfig{RestartPolicy: "always"}, true},
+		{ClusterSwarmRunnerConfig{RestartPolicy: "on-failure", RestartDelay: "soon"}, true},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.cfg.taskSettings(); (err != nil) != tt.hasError {
+			t.Errorf("taskSettings(%+v): got error %v, expected error: %t", tt.cfg, err, tt.hasError)
+		}
+	}
+
+	s, err := (&ClusterSwarmRunnerConfig{}).taskSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.placement.Constraints[0] != "node.labels.TGRole==worker" || s.restart.Condition != swarm.RestartPolicyConditionNone {
+		t.Errorf("unexpected default settings: %+v %+v", s.placement, s.restart)
+	}
+
+	// when only one of the memory settings is set, the default of the other
+	// gives way to it.
+	for _, tt := range []struct {
+		cfg                ClusterSwarmRunnerConfig
+		limit, reservation int64
+	}{
+		{ClusterSwarmRunnerConfig{}, defaultSwarmMemoryLimit, defaultSwarmMemoryReservation},
+		{ClusterSwarmRunnerConfig{MemoryLimit: "40MiB"}, 40 << 20, 40 << 20},
+		{ClusterSwarmRunnerConfig{MemoryLimit: "1GiB"}, 1 << 30, defaultSwarmMemoryReservation},
+		{ClusterSwarmRunnerConfig{MemoryReservation: "100MiB"}, 100 << 20, 100 << 20},
+		{ClusterSwarmRunnerConfig{MemoryReservation: "10MiB"}, defaultSwarmMemoryLimit, 10 << 20},
+	} {
+		s, err := tt.cfg.taskSettings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l, r := s.resources.Limits.MemoryBytes, s.resources.Reservations.MemoryBytes; l != tt.limit || r != tt.reservation {
+			t.Errorf("taskSettings(%+v): expected memory limit %d and reservation %d; got %d and %d", tt.cfg, tt.limit, tt.reservation, l, r)
+		}
+	}
+
+	s, err = (&ClusterSwarmRunnerConfig{
+		PlacementPreferences: []string{"node.labels.zone"},
+		CPULimit:             0.5,
+		RestartPolicy:        "on-failure",
+		RestartMaxAttempts:   3,
+		RestartDelay:         "5s",
+	}).taskSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.placement.Preferences[0].Spread.SpreadDescriptor != "node.labels.zone" {
+		t.Errorf("unexpected placement preferences: %+v", s.placement.Preferences)
+	}
+	if s.resources.Limits.NanoCPUs != 5e8 || s.summary["cpu_limit"] != "0.5" {
+		t.Errorf("unexpected cpu limit: %d, summary: %v", s.resources.Limits.NanoCPUs, s.summary)
+	}
+	if s.restart.Condition != swarm.RestartPolicyConditionOnFailure || *s.restart.MaxAttempts != 3 || *s.restart.Delay != 5*time.Second {
+		t.Errorf("unexpected restart policy: %+v", s.restart)
+	}
+}
+
+func TestLatestTasks(t *testing.T) {
+	task := func(id string, slot int, index uint64) swarm.Task {
+		return swarm.Task{ID: id, Slot: slot, Meta: swarm.Meta{Version: swarm.Version{Index: index}}}
+	}
+
+	tasks := latestTasks([]swarm.Task{
+		task("restarted", 2, 20),
+		task("first", 1, 10),
+		task("failed", 2, 11),
+	})
+
+	if len(tasks) != 2 || tasks[0].ID != "first" || tasks[1].ID != "restarted" {
+		t.Errorf("unexpected latest tasks: %+v", tasks)
+	}
+}
+
+// fakeSwarm serves the tasks of services, all of them complete and placed on
+// nodes whose hostnames are their IDs.
+type fakeSwarm struct {
+	tasks map[string][]swarm.Task
+}
+
+func (f *fakeSwarm) TaskList(_ context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	return f.tasks[options.Filters.Get("service")[0]], nil
+}
+
+func (f *fakeSwarm) NodeInspectWithRaw(_ context.Context, id string) (swarm.Node, []byte, error) {
+	return swarm.Node{Description: swarm.NodeDescription{Hostname: id}}, nil, nil
+}
+
+func TestMonitorSwarmServicesMultipleGroups(t *testing.T) {
+	var (
+		cli = &fakeSwarm{tasks: make(map[string][]swarm.Task)}
+		// built the same way as in ClusterSwarmRunner.Run.
+		out      = &api.RunOutput{Groups: make([]api.GroupSummary, 0, 3)}
+		services = make(map[string]int, 3)
+	)
+	for i, id := range []string{"a", "b", "c"} {
+		service := "service-" + id
+		for slot := 1; slot <= i+1; slot++ {
+			cli.tasks[service] = append(cli.tasks[service], swarm.Task{
+				ID:     fmt.Sprintf("%s-%d", id, slot),
+				Slot:   slot,
+				NodeID: "node-" + id,
+				Status: swarm.TaskStatus{State: swarm.TaskStateComplete},
+			})
+		}
+		out.Groups = append(out.Groups, api.GroupSummary{ID: id, Instances: i + 1})
+		services[service] = len(out.Groups) - 1
+	}
+
+	nodes := newSwarmNodes(cli)
+	errgrp, ctx := errgroup.WithContext(context.Background())
+	for service, idx := range services {
+		service, summary := service, &out.Groups[idx]
+		errgrp.Go(func() error {
+			return monitorSwarmService(ctx, cli, nodes, service, summary, time.Millisecond)
+		})
+	}
+	if err := errgrp.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, g := range out.Groups {
+		if len(g.Nodes) != 1 || g.Nodes["node-"+g.ID] != i+1 {
+			t.Errorf("unexpected nodes of group %s: %v", g.ID, g.Nodes)
+		}
+	}
+}
@@ -173,6 +173,17 @@ func (d *DockerInstanceManager) manageContainer(ctx context.Context, container *
 		return nil, fmt.Errorf("failed to list networks: %w", err)
 	}
 
+	// Runners that can't create networks per run (e.g. cluster:nomad) point us
+	// to a pre-provisioned data network instead.
+	if name := info.Config.Labels["testground.data_network"]; name != "" {
+		n, err := container.Manager.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect data network %s: %w", name, err)
+		}
+		n.Labels = map[string]string{"testground.name": "default"}
+		networks = append(networks, n)
+	}
+
 	// Get a netlink handle.
 	nshandle, err := netns.GetFromPid(info.State.Pid)
 	if err != nil {
@@ -207,6 +218,13 @@ func (d *DockerInstanceManager) manageContainer(ctx context.Context, container *
 
 	for _, n := range networks {
 		name := n.Labels["testground.name"]
+		// Runs with several data networks tell each instance which ones it
+		// can attach to.
+		if len(params.TestNetworks) > 0 {
+			if _, ok := params.TestNetworks[name]; !ok {
+				continue
+			}
+		}
 		id := n.ID
 		network.availableLinks[name] = id
 	}
@@ -270,7 +288,29 @@ func (d *DockerInstanceManager) manageContainer(ctx context.Context, container *
 			}
 		}
 	}
-	return NewInstance(ctx, runenv, info.Config.Hostname, network)
+
+	// Emulate the filtering of a NAT in front of the instance, if requested.
+	filter, err := parseNATFilterConfig(info.Config.Labels, params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nat filter configuration: %w", err)
+	}
+	if filter != nil {
+		if err := applyNATFilter(ctx, info.State.Pid, filter); err != nil {
+			return nil, err
+		}
+	}
+
+	lifecycle, churn, err := dockerLifecycleFor(container, params, info.Config.Env)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lifecycle configuration: %w", err)
+	}
+
+	inst, err = NewInstance(ctx, runenv, info.Config.Hostname, network)
+	if err != nil {
+		return nil, err
+	}
+	inst.Lifecycle, inst.Churn = lifecycle, churn
+	return inst, nil
 }
 
 type dockerLink struct {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/hashicorp/go-multierror"
 
+	"github.com/ipfs/testground/pkg/api"
 	"github.com/ipfs/testground/pkg/logging"
 	"github.com/ipfs/testground/sdk/runtime"
 	"github.com/ipfs/testground/sdk/sync"
@@ -23,6 +24,12 @@ type Instance struct {
 	Writer   *sync.Writer
 	RunEnv   *runtime.RunEnv
 	Network  Network
+
+	// Lifecycle controls the lifecycle of the instance. It's nil if the
+	// runner didn't enable lifecycle control for the instance.
+	Lifecycle Lifecycle
+	// Churn is the churn of the group of the instance, if any.
+	Churn *api.Churn
 }
 
 // Network is a test instance's network, as seen by the sidecar.
@@ -34,6 +41,16 @@ type Network interface {
 	ListActive() []string
 }
 
+// Lifecycle controls the lifecycle of a test instance.
+//
+// Sidecar runners may implement this interface.
+type Lifecycle interface {
+	Pause(ctx context.Context) error
+	Unpause(ctx context.Context) error
+	Kill(ctx context.Context) error
+	Restart(ctx context.Context) error
+}
+
 // Logs are logs from a test instance.
 type Logs interface {
 	io.Closer
@@ -244,7 +244,17 @@ func (d *K8sInstanceManager) manageContainer(ctx context.Context, container *doc
 		}
 	}
 
-	return NewInstance(ctx, runenv, info.Config.Hostname, network)
+	lifecycle, churn, err := dockerLifecycleFor(container, params, info.Config.Env)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lifecycle configuration: %w", err)
+	}
+
+	inst, err = NewInstance(ctx, runenv, info.Config.Hostname, network)
+	if err != nil {
+		return nil, err
+	}
+	inst.Lifecycle, inst.Churn = lifecycle, churn
+	return inst, nil
 }
 
 type k8sLink struct {
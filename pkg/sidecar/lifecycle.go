@@ -0,0 +1,275 @@
+//+build linux
+
+package sidecar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/dockermanager"
+	"github.com/ipfs/testground/sdk/runtime"
+	"github.com/ipfs/testground/sdk/sync"
+)
+
+// dockerLifecycle controls the lifecycle of an instance running in a docker
+// container.
+type dockerLifecycle struct {
+	container *dockermanager.Container
+}
+
+func (l *dockerLifecycle) Pause(ctx context.Context) error {
+	return l.container.Manager.ContainerPause(ctx, l.container.ID)
+}
+
+func (l *dockerLifecycle) Unpause(ctx context.Context) error {
+	return l.container.Manager.ContainerUnpause(ctx, l.container.ID)
+}
+
+func (l *dockerLifecycle) Kill(ctx context.Context) error {
+	return l.container.Manager.ContainerKill(ctx, l.container.ID, "SIGKILL")
+}
+
+func (l *dockerLifecycle) Restart(ctx context.Context) error {
+	timeout := time.Duration(0)
+	return l.container.Manager.ContainerRestart(ctx, l.container.ID, &timeout)
+}
+
+// dockerLifecycleFor returns the lifecycle controller and the churn of an
+// instance running in a docker container, or nils if the runner didn't enable
+// lifecycle control for it.
+func dockerLifecycleFor(container *dockermanager.Container, params *runtime.RunParams, env []string) (Lifecycle, *api.Churn, error) {
+	if !params.TestLifecycle {
+		return nil, nil, nil
+	}
+
+	m, err := runtime.ParseKeyValues(env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var churn *api.Churn
+	if s := m[api.EnvChurn]; s != "" {
+		churn = new(api.Churn)
+		if err := json.Unmarshal([]byte(s), churn); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode churn: %w", err)
+		}
+		if err := churn.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &dockerLifecycle{container: container}, churn, nil
+}
+
+// instanceLifecycle is what the sidecar remembers about an instance across
+// restarts. A restarted container is handed to a new worker, which must
+// neither signal the network as initialized again, nor replay the network
+// changes and lifecycle requests the previous workers handled.
+type instanceLifecycle struct {
+	lk gosync.Mutex
+
+	initialized bool
+	// networkChanges and requests are the number of network changes and
+	// lifecycle requests (for any instance) seen.
+	networkChanges int
+	requests       int
+	// pending is the state to signal once the instance has restarted.
+	pending sync.State
+}
+
+// lifecycleTracker tracks the lifecycle of the instances managed by the
+// sidecar. It's safe for concurrent use.
+type lifecycleTracker struct {
+	lk        gosync.Mutex
+	instances map[string]*instanceLifecycle
+}
+
+func newLifecycleTracker() *lifecycleTracker {
+	return &lifecycleTracker{instances: make(map[string]*instanceLifecycle)}
+}
+
+// get returns the lifecycle of the instance. Restarted containers keep their
+// hostname, so they map to the same lifecycle.
+func (t *lifecycleTracker) get(inst *Instance) *instanceLifecycle {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	key := inst.RunEnv.TestRun + "/" + inst.Hostname
+	l, ok := t.instances[key]
+	if !ok {
+		l = new(instanceLifecycle)
+		t.instances[key] = l
+	}
+	return l
+}
+
+// markInitialized records that the network of the instance was initialized,
+// and returns whether it already was.
+func (l *instanceLifecycle) markInitialized() bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	was := l.initialized
+	l.initialized = true
+	return was
+}
+
+// takePending returns the state to signal after a restart, and clears it.
+func (l *instanceLifecycle) takePending() sync.State {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	s := l.pending
+	l.pending = ""
+	return s
+}
+
+func (l *instanceLifecycle) setPending(s sync.State) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	l.pending = s
+}
+
+// seenNetworkChange records that the nth network change was seen, and returns
+// whether a previous worker had already seen it.
+func (l *instanceLifecycle) seenNetworkChange(n int) bool {
+	return l.seen(&l.networkChanges, n)
+}
+
+// seenRequest records that the nth lifecycle request was seen, and returns
+// whether a previous worker had already seen it.
+func (l *instanceLifecycle) seenRequest(n int) bool {
+	return l.seen(&l.requests, n)
+}
+
+func (l *instanceLifecycle) seen(count *int, n int) bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if n <= *count {
+		return true
+	}
+	*count = n
+	return false
+}
+
+// performLifecycle performs a lifecycle action on the instance, and signals
+// the state, if any, once done. The state of a restart is signaled by the
+// worker of the restarted container.
+func performLifecycle(ctx context.Context, inst *Instance, lc *instanceLifecycle, action sync.LifecycleAction, state sync.State) error {
+	var err error
+	switch action {
+	case sync.LifecyclePause:
+		err = inst.Lifecycle.Pause(ctx)
+	case sync.LifecycleUnpause:
+		err = inst.Lifecycle.Unpause(ctx)
+	case sync.LifecycleKill:
+		err = inst.Lifecycle.Kill(ctx)
+	case sync.LifecycleRestart:
+		lc.setPending(state)
+		// this worker is stopped as the container restarts; don't let that
+		// abort the restart.
+		if err = inst.Lifecycle.Restart(context.Background()); err == nil {
+			return nil
+		}
+		lc.setPending("")
+	default:
+		err = fmt.Errorf("unknown lifecycle action %q", action)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s instance: %w", action, err)
+	}
+
+	if state != "" {
+		if _, err := inst.Writer.SignalEntry(ctx, state); err != nil {
+			return fmt.Errorf("failed to signal lifecycle state %s: %w", state, err)
+		}
+	}
+	return nil
+}
+
+// handleLifecycleRequests performs the lifecycle requests addressed to the
+// instance, until the worker is stopped, or the instance is killed or
+// restarted.
+func handleLifecycleRequests(ctx context.Context, inst *Instance, lc *instanceLifecycle) error {
+	requests := make(chan *sync.LifecycleRequest, 16)
+	if err := inst.Watcher.Subscribe(ctx, sync.LifecycleSubtree, requests); err != nil {
+		return fmt.Errorf("failed to subscribe to lifecycle requests: %w", err)
+	}
+
+	// the subscription replays the requests from the start of the run.
+	n := 0
+	for req := range requests {
+		n++
+		if lc.seenRequest(n) {
+			continue
+		}
+		if req.Group != inst.RunEnv.TestGroupID || req.Instance != inst.RunEnv.TestGroupInstanceIndex {
+			continue
+		}
+
+		inst.S().Infow("performing lifecycle request", "action", req.Action, "state", req.State)
+		if err := performLifecycle(ctx, inst, lc, req.Action, req.State); err != nil {
+			inst.S().Warnw("lifecycle request failed", "action", req.Action, "err", err)
+			continue
+		}
+		if req.Action == sync.LifecycleKill || req.Action == sync.LifecycleRestart {
+			return nil
+		}
+	}
+	return nil
+}
+
+// enforceChurn performs the churn action of the group on the instance when
+// it's selected, until the worker is stopped, or the instance is killed or
+// restarted.
+func enforceChurn(ctx context.Context, inst *Instance, lc *instanceLifecycle) error {
+	var (
+		churn  = inst.Churn
+		runenv = inst.RunEnv
+	)
+
+	for {
+		_, next := churn.Tick(time.Now())
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctx.Done():
+			return nil
+		}
+
+		tick, _ := churn.Tick(time.Now())
+		if !churn.IsSelected(runenv.TestRun, runenv.TestGroupID, tick, runenv.TestGroupInstanceCount, runenv.TestGroupInstanceIndex) {
+			continue
+		}
+
+		inst.S().Infow("churning instance", "action", churn.Action, "tick", tick)
+
+		action := sync.LifecycleAction(churn.Action)
+		if action != sync.LifecyclePause {
+			if err := performLifecycle(ctx, inst, lc, action, ""); err != nil {
+				inst.S().Warnw("churn failed", "action", action, "err", err)
+				continue
+			}
+			return nil
+		}
+
+		if err := performLifecycle(ctx, inst, lc, sync.LifecyclePause, ""); err != nil {
+			inst.S().Warnw("churn failed", "action", action, "err", err)
+			continue
+		}
+		select {
+		case <-time.After(churn.DowntimeDuration()):
+		case <-ctx.Done():
+		}
+		// unpause even if the worker is stopping; a paused container can't
+		// exit.
+		if err := performLifecycle(context.Background(), inst, lc, sync.LifecycleUnpause, ""); err != nil {
+			inst.S().Warnw("churn failed", "action", sync.LifecycleUnpause, "err", err)
+		}
+	}
+}
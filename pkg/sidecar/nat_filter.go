@@ -0,0 +1,168 @@
+//+build linux
+
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ipfs/testground/sdk/runtime"
+)
+
+// natFilterConfig describes the NAT filtering emulated in front of an
+// instance.
+//
+// Only the filtering behaviour of a NAT is emulated, with nftables, in the
+// network namespace of the instance itself: there is no gateway, and neither
+// addresses nor ports are translated. Inbound traffic on the data network that
+// doesn't belong to a connection initiated by the instance is only accepted:
+//
+//  * full-cone: on ports the instance sent from, from anyone.
+//  * restricted-cone: on ports the instance sent from, from the addresses it
+//    sent to.
+//  * port-restricted-cone: on ports the instance sent from, from the address
+//    and port it sent to.
+//
+// Symmetric NATs map ports per destination, which a filter can't reproduce, so
+// they're not supported.
+type natFilterConfig struct {
+	Type    string
+	Network string
+	Timeout time.Duration
+
+	// Subnet is the subnet of the data network.
+	Subnet *net.IPNet
+}
+
+// parseNATFilterConfig reads the NAT filter configuration of an instance from
+// the labels of its container. It returns nil if the instance is not filtered.
+func parseNATFilterConfig(labels map[string]string, params *runtime.RunParams) (*natFilterConfig, error) {
+	typ := labels["testground.nat_filter.type"]
+	if typ == "" {
+		return nil, nil
+	}
+
+	cfg := &natFilterConfig{
+		Type:    typ,
+		Network: labels["testground.nat_filter.network"],
+	}
+
+	switch cfg.Type {
+	case "full-cone", "restricted-cone", "port-restricted-cone":
+	default:
+		return nil, fmt.Errorf("unknown nat filter type %q", cfg.Type)
+	}
+
+	timeout, err := time.ParseDuration(labels["testground.nat_filter.timeout"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid nat filter timeout: %w", err)
+	}
+	cfg.Timeout = timeout
+
+	subnet := params.TestNetworks[cfg.Network]
+	if subnet == nil && cfg.Network == "default" {
+		subnet = params.TestSubnet
+	}
+	if subnet == nil {
+		return nil, fmt.Errorf("unknown subnet of nat filter network %q", cfg.Network)
+	}
+	cfg.Subnet = &subnet.IPNet
+
+	return cfg, nil
+}
+
+// natFilterRuleset is the nftables ruleset emulating the filtering of a NAT.
+// Only the traffic on the data network is affected; the control network is
+// left alone. The mapped set holds the endpoints inbound traffic is accepted
+// from, as they were last sent to.
+var natFilterRuleset = template.Must(template.New("nat_filter").Parse(`table ip testground_nat_filter
+delete table ip testground_nat_filter
+table ip testground_nat_filter {
+{{- if eq .Type "full-cone" }}
+	set mapped {
+		type inet_service
+		flags timeout
+		timeout {{ .TimeoutSecs }}s
+	}
+{{- else if eq .Type "restricted-cone" }}
+	set mapped {
+		type ipv4_addr . inet_service
+		flags timeout
+		timeout {{ .TimeoutSecs }}s
+	}
+{{- else if eq .Type "port-restricted-cone" }}
+	set mapped {
+		type ipv4_addr . inet_service . inet_service
+		flags timeout
+		timeout {{ .TimeoutSecs }}s
+	}
+{{- end }}
+
+	chain output {
+		type filter hook output priority 0; policy accept;
+{{- if eq .Type "full-cone" }}
+		ip daddr {{ .Subnet }} meta l4proto tcp update @mapped { tcp sport }
+		ip daddr {{ .Subnet }} meta l4proto udp update @mapped { udp sport }
+{{- else if eq .Type "restricted-cone" }}
+		ip daddr {{ .Subnet }} meta l4proto tcp update @mapped { ip daddr . tcp sport }
+		ip daddr {{ .Subnet }} meta l4proto udp update @mapped { ip daddr . udp sport }
+{{- else if eq .Type "port-restricted-cone" }}
+		ip daddr {{ .Subnet }} meta l4proto tcp update @mapped { ip daddr . tcp dport . tcp sport }
+		ip daddr {{ .Subnet }} meta l4proto udp update @mapped { ip daddr . udp dport . udp sport }
+{{- end }}
+	}
+
+	chain input {
+		type filter hook input priority 0; policy accept;
+		ip saddr != {{ .Subnet }} accept
+		ct state established,related accept
+{{- if eq .Type "full-cone" }}
+		tcp dport @mapped accept
+		udp dport @mapped accept
+{{- else if eq .Type "restricted-cone" }}
+		ip saddr . tcp dport @mapped accept
+		ip saddr . udp dport @mapped accept
+{{- else if eq .Type "port-restricted-cone" }}
+		ip saddr . tcp sport . tcp dport @mapped accept
+		ip saddr . udp sport . udp dport @mapped accept
+{{- end }}
+		drop
+	}
+}
+`))
+
+// ruleset renders the nftables ruleset of the NAT filter. Applying it replaces
+// the rules of a previously applied configuration.
+func (c *natFilterConfig) ruleset() (string, error) {
+	var buf bytes.Buffer
+	err := natFilterRuleset.Execute(&buf, struct {
+		*natFilterConfig
+		TimeoutSecs int
+	}{c, int(c.Timeout / time.Second)})
+	return buf.String(), err
+}
+
+// applyNATFilter applies the NAT filter configuration to the network namespace
+// of the process with the given pid. The sidecar shares the host's pid
+// namespace, so it can enter the network namespace of instances through /proc.
+func applyNATFilter(ctx context.Context, pid int, cfg *natFilterConfig) error {
+	rules, err := cfg.ruleset()
+	if err != nil {
+		return err
+	}
+
+	netns := "--net=/proc/" + strconv.Itoa(pid) + "/ns/net"
+	cmd := exec.CommandContext(ctx, "nsenter", netns, "nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(rules)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to apply nat filter rules: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
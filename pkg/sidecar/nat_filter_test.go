@@ -0,0 +1,77 @@
+//+build linux
+
+package sidecar
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/sdk/runtime"
+)
+
+func TestNATFilterRuleset(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("16.0.0.0/16")
+	params := &runtime.RunParams{TestSubnet: &runtime.IPNet{IPNet: *subnet}}
+
+	labels := map[string]string{
+		"testground.nat_filter.network": "default",
+		"testground.nat_filter.timeout": "2m0s",
+	}
+
+	// each type of nat filter renders its own ruleset.
+	rulesets := make(map[string]string)
+	for _, tt := range []struct {
+		typ      string
+		expected []string
+	}{
+		{"full-cone", []string{"type inet_service", "udp dport @mapped accept"}},
+		{"restricted-cone", []string{"type ipv4_addr . inet_service", "ip saddr . udp dport @mapped accept"}},
+		{"port-restricted-cone", []string{"type ipv4_addr . inet_service . inet_service", "ip saddr . udp sport . udp dport @mapped accept"}},
+	} {
+		labels["testground.nat_filter.type"] = tt.typ
+		cfg, err := parseNATFilterConfig(labels, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules, err := cfg.ruleset()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := append([]string{
+			"ip saddr != 16.0.0.0/16 accept",
+			"ct state established,related accept",
+			"drop",
+			"timeout 120s",
+		}, tt.expected...)
+		for _, e := range expected {
+			if !strings.Contains(rules, e) {
+				t.Errorf("expected %s nat filter rules to contain %q:\n%s", tt.typ, e, rules)
+			}
+		}
+		if strings.Contains(rules, "masquerade") {
+			t.Errorf("expected %s nat filter rules not to translate:\n%s", tt.typ, rules)
+		}
+
+		for other, r := range rulesets {
+			if r == rules {
+				t.Errorf("expected %s and %s nat filters to have different rules", tt.typ, other)
+			}
+		}
+		rulesets[tt.typ] = rules
+	}
+
+	// symmetric nats map ports, which can't be emulated by filtering.
+	for _, typ := range []string{"symmetric", "carrier-grade"} {
+		labels["testground.nat_filter.type"] = typ
+		if _, err := parseNATFilterConfig(labels, params); err == nil {
+			t.Errorf("expected an error for nat filter type %s", typ)
+		}
+	}
+
+	// instances without a nat filter.
+	if cfg, err := parseNATFilterConfig(map[string]string{}, params); cfg != nil || err != nil {
+		t.Errorf("expected no nat filter; got %+v, %v", cfg, err)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/ipfs/testground/pkg/logging"
+	"github.com/ipfs/testground/sdk/runtime"
 	"github.com/ipfs/testground/sdk/sync"
 
 	"golang.org/x/sync/errgroup"
@@ -53,6 +55,8 @@ func Run(runnerName string) error {
 
 	defer manager.Close()
 
+	lifecycles := newLifecycleTracker()
+
 	return manager.Manage(ctx, func(ctx context.Context, instance *Instance) error {
 		instance.S().Infow("managing instance", "instance", instance.Hostname)
 
@@ -64,34 +68,50 @@ func Run(runnerName string) error {
 
 		g, ctx := errgroup.WithContext(ctx)
 
+		lc := lifecycles.get(instance)
+		ready := make(chan struct{})
+
 		// Network configuration loop.
 		g.Go(func() error {
-			err := instance.Network.ConfigureNetwork(ctx, &sync.NetworkConfig{
-				Network: "default",
-				Enable:  true,
-			})
-
-			if err != nil {
-				return err
+			for _, name := range initialNetworks(instance.RunEnv) {
+				err := instance.Network.ConfigureNetwork(ctx, &sync.NetworkConfig{
+					Network: name,
+					Enable:  true,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to enable network %s: %w", name, err)
+				}
 			}
 
-			// Wait for all the sidecars to enter the "network-initialized" state.
-			const netInitState = "network-initialized"
-			if _, err = instance.Writer.SignalEntry(ctx, netInitState); err != nil {
-				return fmt.Errorf("failed to signal network ready: %w", err)
-			}
+			if lc.markInitialized() {
+				// The container was restarted; the network was initialized
+				// before.
+				instance.S().Infof("network reinitialized after restart")
+				if state := lc.takePending(); state != "" {
+					if _, err := instance.Writer.SignalEntry(ctx, state); err != nil {
+						return fmt.Errorf("failed to signal lifecycle state %s: %w", state, err)
+					}
+				}
+			} else {
+				// Wait for all the sidecars to enter the "network-initialized" state.
+				const netInitState = "network-initialized"
+				if _, err := instance.Writer.SignalEntry(ctx, netInitState); err != nil {
+					return fmt.Errorf("failed to signal network ready: %w", err)
+				}
 
-			instance.S().Infof("waiting for all networks to be ready")
+				instance.S().Infof("waiting for all networks to be ready")
 
-			if err := <-instance.Watcher.Barrier(
-				ctx,
-				netInitState,
-				int64(instance.RunEnv.TestInstanceCount),
-			); err != nil {
-				return fmt.Errorf("failed to wait for network ready: %w", err)
-			}
+				if err := <-instance.Watcher.Barrier(
+					ctx,
+					netInitState,
+					int64(instance.RunEnv.TestInstanceCount),
+				); err != nil {
+					return fmt.Errorf("failed to wait for network ready: %w", err)
+				}
 
-			instance.S().Infof("all networks ready")
+				instance.S().Infof("all networks ready")
+			}
+			close(ready)
 
 			// Now let the test case tell us how to configure the network.
 			subtree := sync.NetworkSubtree(instance.Hostname)
@@ -99,7 +119,14 @@ func Run(runnerName string) error {
 			if err := instance.Watcher.Subscribe(ctx, subtree, networkChanges); err != nil {
 				return fmt.Errorf("failed to subscribe to network changes: %s", err)
 			}
+			n := 0
 			for cfg := range networkChanges {
+				// the subscription replays the changes applied before a
+				// restart; the restarted instance applies its own.
+				n++
+				if lc.seenNetworkChange(n) {
+					continue
+				}
 				instance.S().Infow("applying network change", "network", cfg)
 				if err := instance.Network.ConfigureNetwork(ctx, cfg); err != nil {
 					return fmt.Errorf("failed to update network %s: %w", cfg.Network, err)
@@ -118,6 +145,42 @@ func Run(runnerName string) error {
 			return nil
 		})
 
+		// Lifecycle requests and churn, once the network is ready.
+		if instance.Lifecycle != nil {
+			g.Go(func() error {
+				select {
+				case <-ready:
+				case <-ctx.Done():
+					return nil
+				}
+				return handleLifecycleRequests(ctx, instance, lc)
+			})
+		}
+		if instance.Lifecycle != nil && instance.Churn != nil {
+			g.Go(func() error {
+				select {
+				case <-ready:
+				case <-ctx.Done():
+					return nil
+				}
+				return enforceChurn(ctx, instance, lc)
+			})
+		}
+
 		return g.Wait()
 	})
 }
+
+// initialNetworks returns the names of the data networks the instance starts
+// attached to: those it was given by the runner, or the default network.
+func initialNetworks(runenv *runtime.RunEnv) []string {
+	if len(runenv.TestNetworks) == 0 {
+		return []string{"default"}
+	}
+	names := make([]string, 0, len(runenv.TestNetworks))
+	for name := range runenv.TestNetworks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -10,15 +10,37 @@ import (
 
 	"github.com/docker/docker/pkg/ioutils"
 
+	"github.com/ipfs/testground/pkg/api"
+
 	"go.uber.org/zap"
 )
 
-func New(w http.ResponseWriter, log *zap.SugaredLogger) *TgWriter {
-	w.Header().Set("Content-Type", "application/json")
+const (
+	// ContentTypeNDJSON is the default content type of the message stream;
+	// each message is a JSON object terminated by a newline.
+	ContentTypeNDJSON = "application/x-ndjson"
+
+	// ContentTypeSSE is the content type of the message stream when the
+	// client requests Server-Sent Events through the Accept header.
+	ContentTypeSSE = "text/event-stream"
+)
+
+// New returns a TgWriter that streams protocol messages to w. The framing is
+// negotiated through the Accept header of r: Server-Sent Events if the client
+// asks for text/event-stream, newline-delimited JSON otherwise.
+func New(w http.ResponseWriter, r *http.Request, log *zap.SugaredLogger) *TgWriter {
+	sse := strings.Contains(r.Header.Get("Accept"), ContentTypeSSE)
+	if sse {
+		w.Header().Set("Content-Type", ContentTypeSSE)
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", ContentTypeNDJSON)
+	}
 
 	return &TgWriter{
 		output: ioutils.NewWriteFlusher(w),
 		log:    log,
+		sse:    sse,
 	}
 }
 
@@ -28,14 +50,18 @@ type TgWriter struct {
 	io.Writer
 	output io.Writer
 	log    *zap.SugaredLogger
+	sse    bool
 }
 
+var _ api.EventWriter = (*TgWriter)(nil)
+
 // Msg defines a protocol message struct sent from the Testground daemon to the Testground client.
-// For a given request, clients should expect between 1 and `n` `progress` messages, and
-// exactly 1 `result` message.
+// For a given request, clients should expect between 1 and `n` `progress` or
+// `event` messages, and exactly 1 `result` message.
 type Msg struct {
-	Type    string      `json:"type"` // progress or result or error
+	Type    string      `json:"type"` // progress or event or result or error
 	Payload interface{} `json:"payload,omitempty"`
+	Event   *api.Event  `json:"event,omitempty"`
 	Error   *Error      `json:"error,omitempty"`
 }
 
@@ -49,15 +75,24 @@ func (tgw *TgWriter) Write(p []byte) (n int, err error) {
 		Payload: p,
 	}
 
-	json, err := json.Marshal(pld)
-	if err != nil {
+	if err := tgw.write(&pld); err != nil {
 		return 0, err
 	}
+	return len(p), nil
+}
 
-	tgw.Lock()
-	defer tgw.Unlock()
+// WriteEvent sends a structured event to the client.
+func (tgw *TgWriter) WriteEvent(evt *api.Event) error {
+	pld := Msg{
+		Type:  "event",
+		Event: evt,
+	}
 
-	return tgw.output.Write(json)
+	err := tgw.write(&pld)
+	if err != nil {
+		tgw.log.Errorw("could not write event", "err", err)
+	}
+	return err
 }
 
 func (tgw *TgWriter) WriteResult(res interface{}) {
@@ -66,17 +101,7 @@ func (tgw *TgWriter) WriteResult(res interface{}) {
 		Payload: res,
 	}
 
-	json, err := json.Marshal(pld)
-	if err != nil {
-		tgw.log.Errorw("could not write result", "err", err)
-		return
-	}
-
-	tgw.Lock()
-	defer tgw.Unlock()
-
-	_, err = tgw.output.Write(json)
-	if err != nil {
+	if err := tgw.write(&pld); err != nil {
 		tgw.log.Errorw("could not write result", "err", err)
 	}
 }
@@ -100,19 +125,15 @@ func (tgw *TgWriter) WriteError(message string, keysAndValues ...interface{}) {
 		},
 	}
 
-	json, err := json.Marshal(pld)
-	if err != nil {
+	if err := tgw.write(&pld); err != nil {
 		tgw.log.Errorw("could not write error response", "err", err)
-		return
 	}
+}
 
-	tgw.Lock()
-	defer tgw.Unlock()
-
-	_, err = tgw.output.Write(json)
-	if err != nil {
-		tgw.log.Errorw("could not write error response", "err", err)
-	}
+// WriteMsg sends a previously constructed protocol message to the client. It's
+// used to replay recorded output.
+func (tgw *TgWriter) WriteMsg(msg *Msg) error {
+	return tgw.write(msg)
 }
 
 func (tgw *TgWriter) Flush() {
@@ -120,3 +141,31 @@ func (tgw *TgWriter) Flush() {
 		f.Flush()
 	}
 }
+
+// write frames and writes a message to the underlying output.
+func (tgw *TgWriter) write(msg *Msg) error {
+	json, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	var frame []byte
+	if tgw.sse {
+		typ := msg.Type
+		if msg.Event != nil {
+			typ = string(msg.Event.Type)
+		}
+		frame = make([]byte, 0, len(json)+len(typ)+16)
+		frame = append(frame, "event: "+typ+"\ndata: "...)
+		frame = append(frame, json...)
+		frame = append(frame, "\n\n"...)
+	} else {
+		frame = append(json, '\n')
+	}
+
+	tgw.Lock()
+	defer tgw.Unlock()
+
+	_, err = tgw.output.Write(frame)
+	return err
+}
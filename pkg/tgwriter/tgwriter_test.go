@@ -0,0 +1,66 @@
+package tgwriter
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/testground/pkg/api"
+	"github.com/ipfs/testground/pkg/logging"
+)
+
+func TestNDJSONFraming(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/run", nil)
+
+	tgw := New(rec, req, logging.S())
+	_, _ = tgw.Write([]byte("hello"))
+	api.WriteEvent(tgw, &api.Event{
+		Type:    api.EventTypeNetworkConfigured,
+		Network: &api.NetworkEvent{RunID: "abc", Name: "default", Subnet: "16.0.0.0/16"},
+	})
+	tgw.WriteResult("done")
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentTypeNDJSON {
+		t.Fatalf("expected content type %s, got %s", ContentTypeNDJSON, ct)
+	}
+
+	var types []string
+	for s := bufio.NewScanner(rec.Body); s.Scan(); {
+		var msg Msg
+		if err := json.Unmarshal(s.Bytes(), &msg); err != nil {
+			t.Fatalf("line is not a JSON message: %s", err)
+		}
+		types = append(types, msg.Type)
+		if msg.Type == "event" && (msg.Event == nil || msg.Event.Network == nil || msg.Event.Network.RunID != "abc") {
+			t.Fatalf("event payload not preserved: %+v", msg.Event)
+		}
+	}
+
+	if got := strings.Join(types, ","); got != "progress,event,result" {
+		t.Fatalf("unexpected message sequence: %s", got)
+	}
+}
+
+func TestSSEFraming(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/run", nil)
+	req.Header.Set("Accept", ContentTypeSSE)
+
+	tgw := New(rec, req, logging.S())
+	api.WriteEvent(tgw, &api.Event{
+		Type:        api.EventTypeRunComplete,
+		RunComplete: &api.RunCompleteEvent{RunID: "abc", Outcome: "ok"},
+	})
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentTypeSSE {
+		t.Fatalf("expected content type %s, got %s", ContentTypeSSE, ct)
+	}
+
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "event: run-complete\ndata: {") || !strings.HasSuffix(body, "}\n\n") {
+		t.Fatalf("unexpected SSE frame: %q", body)
+	}
+}
@@ -40,6 +40,9 @@ func (l *logger) init() {
 
 	paths := []string{"stdout"}
 	if l.runenv.TestOutputsPath != "" {
+		// runners may hand out a path that doesn't exist yet, e.g. a
+		// subdirectory of a volume shared by all instances.
+		_ = os.MkdirAll(l.runenv.TestOutputsPath, 0777)
 		paths = append(paths, filepath.Join(l.runenv.TestOutputsPath, "run.out"))
 	}
 
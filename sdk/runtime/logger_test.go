@@ -0,0 +1,27 @@
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoggerCreatesOutputsPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// e.g. <plan>/<run_id>/<group_id>/<instance> on a shared volume.
+	path := filepath.Join(dir, "plan", "run", "group", "0")
+
+	re := NewRunEnv(RunParams{TestOutputsPath: path})
+	re.RecordMessage("hello")
+	_ = re.SLogger().Sync()
+
+	if _, err := os.Stat(filepath.Join(path, "run.out")); err != nil {
+		t.Fatalf("expected the run log to be written to the outputs path: %s", err)
+	}
+}
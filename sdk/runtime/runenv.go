@@ -21,6 +21,7 @@ const (
 	EnvTestRun                = "TEST_RUN"
 	EnvTestRepo               = "TEST_REPO"
 	EnvTestSubnet             = "TEST_SUBNET"
+	EnvTestNetworks           = "TEST_NETWORKS"
 	EnvTestCaseSeq            = "TEST_CASE_SEQ"
 	EnvTestSidecar            = "TEST_SIDECAR"
 	EnvTestInstanceCount      = "TEST_INSTANCE_COUNT"
@@ -28,6 +29,8 @@ const (
 	EnvTestInstanceParams     = "TEST_INSTANCE_PARAMS"
 	EnvTestGroupID            = "TEST_GROUP_ID"
 	EnvTestGroupInstanceCount = "TEST_GROUP_INSTANCE_COUNT"
+	EnvTestGroupInstanceIndex = "TEST_GROUP_INSTANCE_INDEX"
+	EnvTestLifecycle          = "TEST_LIFECYCLE"
 	EnvTestOutputsPath        = "TEST_OUTPUTS_PATH"
 )
 
@@ -73,6 +76,10 @@ type RunParams struct {
 	TestBranch string `json:"branch,omitempty"`
 	TestTag    string `json:"tag,omitempty"`
 
+	// TestOutputsPath is the directory where the instance writes its
+	// outputs. It's created, along with its parents, when the run
+	// environment is set up, as runners may hand out a subdirectory of a
+	// shared volume that doesn't exist yet.
 	TestOutputsPath string `json:"outputs_path,omitempty"`
 
 	TestInstanceCount  int               `json:"instances"`
@@ -82,9 +89,17 @@ type RunParams struct {
 	TestGroupID            string `json:"group,omitempty"`
 	TestGroupInstanceCount int    `json:"group_instances,omitempty"`
 
+	// The index of this instance within its group, from 0 to
+	// TestGroupInstanceCount-1, or -1 if the runner doesn't assign one.
+	TestGroupInstanceIndex int `json:"group_instance_index"`
+
 	// true if the test has access to the sidecar.
 	TestSidecar bool `json:"test_sidecar,omitempty"`
 
+	// true if the runner answers lifecycle requests (pause, kill, restart)
+	// sent through the sync service.
+	TestLifecycle bool `json:"test_lifecycle,omitempty"`
+
 	// The subnet on which this test is running.
 	//
 	// The test instance can use this to pick an IP address and/or determine
@@ -92,6 +107,15 @@ type RunParams struct {
 	//
 	// This will be 127.1.0.0/16 when using the local exec runner.
 	TestSubnet *IPNet `json:"network,omitempty"`
+
+	// The data networks this test instance is attached to, by name, when the
+	// runner attaches it to more than one. TestSubnet is the subnet of the
+	// "default" network, or of the first network if it's not attached to the
+	// default one.
+	//
+	// The test instance can configure each network independently through
+	// the sidecar, by setting NetworkConfig.Network to its name.
+	TestNetworks map[string]*IPNet `json:"networks,omitempty"`
 }
 
 // RunEnv encapsulates the context for this test run.
@@ -144,6 +168,7 @@ func (re *RunParams) ToEnvVars() map[string]string {
 
 	out := map[string]string{
 		EnvTestSidecar:            strconv.FormatBool(re.TestSidecar),
+		EnvTestLifecycle:          strconv.FormatBool(re.TestLifecycle),
 		EnvTestPlan:               re.TestPlan,
 		EnvTestBranch:             re.TestBranch,
 		EnvTestCase:               re.TestCase,
@@ -160,6 +185,18 @@ func (re *RunParams) ToEnvVars() map[string]string {
 		EnvTestOutputsPath:        re.TestOutputsPath,
 	}
 
+	if re.TestGroupInstanceIndex >= 0 {
+		out[EnvTestGroupInstanceIndex] = strconv.Itoa(re.TestGroupInstanceIndex)
+	}
+
+	if len(re.TestNetworks) > 0 {
+		networks := make(map[string]string, len(re.TestNetworks))
+		for name, subnet := range re.TestNetworks {
+			networks[name] = subnet.String()
+		}
+		out[EnvTestNetworks] = packParams(networks)
+	}
+
 	return out
 }
 
@@ -198,6 +235,20 @@ func toNet(s string) *IPNet {
 	return &IPNet{IPNet: *ipnet}
 }
 
+// toNets parses packed named subnets, ignoring those that can't be parsed.
+func toNets(packed string) map[string]*IPNet {
+	if packed == "" {
+		return nil
+	}
+	nets := make(map[string]*IPNet)
+	for name, s := range unpackParams(packed) {
+		if n := toNet(s); n != nil {
+			nets[name] = n
+		}
+	}
+	return nets
+}
+
 // CurrentRunEnv populates a test context from environment vars.
 func CurrentRunEnv() *RunEnv {
 	re, _ := ParseRunEnv(os.Environ())
@@ -213,6 +264,7 @@ func ParseRunParams(env []string) (*RunParams, error) {
 
 	return &RunParams{
 		TestSidecar:            toBool(m[EnvTestSidecar]),
+		TestLifecycle:          toBool(m[EnvTestLifecycle]),
 		TestPlan:               m[EnvTestPlan],
 		TestCase:               m[EnvTestCase],
 		TestRun:                m[EnvTestRun],
@@ -220,12 +272,14 @@ func ParseRunParams(env []string) (*RunParams, error) {
 		TestBranch:             m[EnvTestBranch],
 		TestRepo:               m[EnvTestRepo],
 		TestSubnet:             toNet(m[EnvTestSubnet]),
+		TestNetworks:           toNets(m[EnvTestNetworks]),
 		TestCaseSeq:            toInt(m[EnvTestCaseSeq]),
 		TestInstanceCount:      toInt(m[EnvTestInstanceCount]),
 		TestInstanceRole:       m[EnvTestInstanceRole],
 		TestInstanceParams:     unpackParams(m[EnvTestInstanceParams]),
 		TestGroupID:            m[EnvTestGroupID],
 		TestGroupInstanceCount: toInt(m[EnvTestGroupInstanceCount]),
+		TestGroupInstanceIndex: toInt(m[EnvTestGroupInstanceIndex]),
 		TestOutputsPath:        m[EnvTestOutputsPath],
 	}, nil
 }
@@ -69,3 +69,58 @@ func TestParseKeyValues(t *testing.T) {
 		})
 	}
 }
+
+func TestTestNetworksRoundTrip(t *testing.T) {
+	params := RunParams{
+		TestSubnet: toNet("16.0.0.0/16"),
+		TestNetworks: map[string]*IPNet{
+			"default": toNet("16.0.0.0/16"),
+			"lan":     toNet("16.1.0.0/16"),
+		},
+	}
+
+	var env []string
+	for k, v := range params.ToEnvVars() {
+		env = append(env, k+"="+v)
+	}
+
+	parsed, err := ParseRunParams(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.TestNetworks, params.TestNetworks) {
+		t.Errorf("TestNetworks = %v, want %v", parsed.TestNetworks, params.TestNetworks)
+	}
+
+	// runs with a single network don't set TEST_NETWORKS.
+	params.TestNetworks = nil
+	if _, ok := params.ToEnvVars()[EnvTestNetworks]; ok {
+		t.Errorf("expected %s not to be set", EnvTestNetworks)
+	}
+}
+
+func TestGroupInstanceIndex(t *testing.T) {
+	params := RunParams{TestSubnet: toNet("16.0.0.0/16"), TestGroupInstanceIndex: 3, TestLifecycle: true}
+
+	var env []string
+	for k, v := range params.ToEnvVars() {
+		env = append(env, k+"="+v)
+	}
+
+	parsed, err := ParseRunParams(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.TestGroupInstanceIndex != 3 || !parsed.TestLifecycle {
+		t.Errorf("unexpected parsed params: index %d, lifecycle %t", parsed.TestGroupInstanceIndex, parsed.TestLifecycle)
+	}
+
+	// runners that don't assign indices leave it unset.
+	parsed, err = ParseRunParams([]string{"TEST_GROUP_ID=single"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.TestGroupInstanceIndex != -1 || parsed.TestLifecycle {
+		t.Errorf("unexpected parsed params: index %d, lifecycle %t", parsed.TestGroupInstanceIndex, parsed.TestLifecycle)
+	}
+}
@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/ipfs/testground/sdk/runtime"
+)
+
+// ErrLifecycleUnsupported is returned when requesting a lifecycle action from
+// a runner that doesn't answer lifecycle requests.
+var ErrLifecycleUnsupported = errors.New("the runner doesn't support lifecycle requests")
+
+// LifecycleAction is an action to perform on a test instance.
+type LifecycleAction string
+
+const (
+	// LifecyclePause freezes all processes of the instance.
+	LifecyclePause LifecycleAction = "pause"
+	// LifecycleUnpause resumes a paused instance.
+	LifecycleUnpause LifecycleAction = "unpause"
+	// LifecycleKill kills the instance with SIGKILL. It won't be restarted.
+	LifecycleKill LifecycleAction = "kill"
+	// LifecycleRestart kills the instance with SIGKILL and starts it again.
+	// The restarted instance runs the test case from the start.
+	LifecycleRestart LifecycleAction = "restart"
+)
+
+// LifecycleRequest asks the runner (or the sidecar) to perform an action on
+// an instance of the run.
+type LifecycleRequest struct {
+	// Group is the ID of the group of the instance.
+	Group string
+
+	// Instance is the index of the instance within its group, as in
+	// RunParams.TestGroupInstanceIndex.
+	Instance int
+
+	// Action is the action to perform.
+	Action LifecycleAction
+
+	// State will be signaled when the action has been performed. For
+	// restarts, it's signaled once the instance has been started again, not
+	// once it has reached any point of the test case.
+	State State
+}
+
+// LifecycleSubtree represents a subtree through which test instances request
+// lifecycle actions on other instances (or themselves).
+var LifecycleSubtree = &Subtree{
+	GroupKey:    "lifecycle",
+	PayloadType: reflect.TypeOf(&LifecycleRequest{}),
+	KeyFunc: func(val interface{}) string {
+		req := val.(*LifecycleRequest)
+		return req.Group + "/" + strconv.Itoa(req.Instance)
+	},
+}
+
+// RequestLifecycle requests a lifecycle action on an instance. If req.State is
+// set, it waits until the action has been performed. Use a distinct state for
+// every request, as the barrier fails if the state has been signaled more
+// than once.
+func RequestLifecycle(ctx context.Context, runenv *runtime.RunEnv, watcher *Watcher, writer *Writer, req *LifecycleRequest) error {
+	if !runenv.TestLifecycle {
+		return ErrLifecycleUnsupported
+	}
+
+	switch req.Action {
+	case LifecyclePause, LifecycleUnpause, LifecycleKill, LifecycleRestart:
+	default:
+		return fmt.Errorf("unknown lifecycle action %q", req.Action)
+	}
+
+	if _, err := writer.Write(ctx, LifecycleSubtree, req); err != nil {
+		return fmt.Errorf("failed to request %s of %s/%d: %w", req.Action, req.Group, req.Instance, err)
+	}
+
+	if req.State == "" {
+		return nil
+	}
+	if err := <-watcher.Barrier(ctx, req.State, 1); err != nil {
+		return fmt.Errorf("failed to wait for %s of %s/%d: %w", req.Action, req.Group, req.Instance, err)
+	}
+	return nil
+}